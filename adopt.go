@@ -0,0 +1,99 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+
+	"github.com/cznic/mathutil"
+)
+
+// adoptedRegion is a region of memory not mapped by an Allocator but owned by
+// it, see UintptrAdopt.
+type adoptedRegion struct {
+	size int
+	free func(uintptr)
+}
+
+// UintptrAdopt makes a the owner of the size bytes at p, allocated elsewhere,
+// eg. by C.malloc or another allocator. The region is then reported by
+// Contains and UsableSize of a, and Free of a, or Realloc moving the region,
+// releases it by calling free, if not nil, with p. Close and Reset release all
+// adopted regions. Adopted regions are not included in Stats.
+func (a *Allocator) UintptrAdopt(p uintptr, size int, free func(p uintptr)) error {
+	if size <= 0 {
+		return &Error{Op: "adopt", Addr: p, Size: size, Kind: ErrInvalidSize}
+	}
+
+	if p == 0 || p+uintptr(size) < p || a.Contains(p) || a.Contains(p+uintptr(size-1)) {
+		return &Error{Op: "adopt", Addr: p, Size: size, Kind: ErrInvalidPointer}
+	}
+
+	if a.adopted == nil {
+		a.adopted = map[uintptr]adoptedRegion{}
+	}
+	a.adopted[p] = adoptedRegion{size, free}
+	return nil
+}
+
+// UnsafeAdopt is like UintptrAdopt except its argument is an unsafe.Pointer.
+func (a *Allocator) UnsafeAdopt(p unsafe.Pointer, size int, free func(p unsafe.Pointer)) error {
+	var f func(uintptr)
+	if free != nil {
+		f = func(p uintptr) { free(unsafe.Pointer(p)) }
+	}
+	return a.UintptrAdopt(uintptr(p), size, f)
+}
+
+// freeAdopted releases the adopted region at p, if any, and reports whether
+// there was one.
+func (a *Allocator) freeAdopted(p uintptr) bool {
+	r, ok := a.adopted[p]
+	if !ok {
+		return false
+	}
+
+	delete(a.adopted, p)
+	if r.free != nil {
+		r.free(p)
+	}
+	return true
+}
+
+// reallocAdopted implements Realloc of the adopted region r at p. Shrinking
+// keeps the region in place, growing moves it to memory of a.
+func (a *Allocator) reallocAdopted(p uintptr, r adoptedRegion, size int) (uintptr, error) {
+	if size <= r.size && !a.ReallocMove {
+		return p, nil
+	}
+
+	q, err := a.UintptrMalloc(size)
+	if err != nil {
+		return 0, err
+	}
+
+	n := mathutil.Min(size, r.size)
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(q)), n), unsafe.Slice((*byte)(unsafe.Pointer(p)), n))
+	a.freeAdopted(p)
+	return q, nil
+}
+
+// inAdopted reports whether p points into a region adopted by a.
+func (a *Allocator) inAdopted(p uintptr) bool {
+	for b, r := range a.adopted {
+		if p-b < uintptr(r.size) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseAdopted releases all regions adopted by a.
+func (a *Allocator) releaseAdopted() {
+	for p := range a.adopted {
+		a.freeAdopted(p)
+	}
+	a.adopted = nil
+}
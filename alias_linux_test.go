@@ -0,0 +1,20 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"syscall"
+)
+
+// mapAlias maps the shared mapping at p of size bytes once more, so that its
+// contents can be inspected after p is unmapped.
+func mapAlias(p uintptr, size int) (uintptr, error) {
+	q, _, errno := syscall.Syscall6(syscall.SYS_MREMAP, p, 0, uintptr(size), _MREMAP_MAYMOVE, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return q, nil
+}
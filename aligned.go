@@ -0,0 +1,63 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// MallocAligned is like Malloc except the returned block starts at a multiple
+// of align, which must be a power of two. The slots of a size class are
+// aligned to their size, so blocks not larger than the largest size class
+// after rounding size up to align are served from shared pages, eg. 64 byte
+// blocks aligned to 256 bytes take 256 byte slots. Larger blocks with
+// alignments above CacheLineSize use a mapping of their own, like
+// MallocPageAligned, which is aligned to align if it's larger than the page
+// size of the Allocator, see Options.PageSize. Realloc does not preserve the
+// alignment of a block it moves.
+func (a *Allocator) MallocAligned(align, size int) (r []byte, err error) {
+	p, err := a.UintptrMallocAligned(align, size)
+	if p == 0 || err != nil {
+		return nil, err
+	}
+
+	return a.slice(p, size), nil
+}
+
+// UintptrMallocAligned is like MallocAligned except it returns an uintptr.
+func (a *Allocator) UintptrMallocAligned(align, size int) (r uintptr, err error) {
+	if align <= 0 || align&(align-1) != 0 {
+		return 0, a.invalidSize("align", align)
+	}
+
+	switch {
+	case align > a.pageSize() && size > 0:
+		if align > maxMalloc-size {
+			return 0, &Error{Op: "malloc", Size: size, Kind: ErrOOM}
+		}
+
+		return a.mallocPageAligned(size, align)
+	case size <= 0 || align <= mallocAllign:
+		return a.UintptrMalloc(size)
+	case size <= a.maxSlot() && roundup(size, align) <= a.maxSlot():
+		return a.UintptrMalloc(roundup(size, align))
+	case align <= CacheLineSize:
+		// Blocks of dedicated pages start at headerSize.
+		return a.UintptrMalloc(size)
+	default:
+		return a.UintptrMallocPageAligned(size)
+	}
+}
+
+// UnsafeMallocAligned is like MallocAligned except it returns an
+// unsafe.Pointer.
+func (a *Allocator) UnsafeMallocAligned(align, size int) (r unsafe.Pointer, err error) {
+	p, err := a.UintptrMallocAligned(align, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Pointer(p), nil
+}
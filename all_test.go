@@ -6,13 +6,18 @@ package memory
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/cznic/mathutil"
@@ -70,6 +75,7 @@ type block struct {
 
 func test1u(t *testing.T, max int) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	rem := quota
 	var a []block
 	srng, err := mathutil.NewFC32(0, math.MaxInt32, true)
@@ -96,7 +102,7 @@ func test1u(t *testing.T, max int) {
 			*(*byte)(unsafe.Pointer(p + uintptr(i))) = byte(vrng.Next())
 		}
 	}
-	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs, alloc.mmaps, alloc.bytes, alloc.bytes-quota, 100*float64(alloc.bytes-quota)/quota)
+	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs.Load(), alloc.mmaps.Load(), alloc.bytes.Load(), alloc.bytes.Load()-quota, 100*float64(alloc.bytes.Load()-quota)/quota)
 	srng.Seek(0)
 	vrng.Seek(0)
 	// Verify
@@ -129,9 +135,6 @@ func test1u(t *testing.T, max int) {
 			t.Fatal(err)
 		}
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func Test1USmall(t *testing.T) { test1u(t, max) }
@@ -139,6 +142,7 @@ func Test1UBig(t *testing.T)   { test1u(t, bigMax) }
 
 func test2u(t *testing.T, max int) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	rem := quota
 	var a []block
 	srng, err := mathutil.NewFC32(0, math.MaxInt32, true)
@@ -165,7 +169,7 @@ func test2u(t *testing.T, max int) {
 			*(*byte)(unsafe.Pointer(p + uintptr(i))) = byte(vrng.Next())
 		}
 	}
-	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs, alloc.mmaps, alloc.bytes, alloc.bytes-quota, 100*float64(alloc.bytes-quota)/quota)
+	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs.Load(), alloc.mmaps.Load(), alloc.bytes.Load(), alloc.bytes.Load()-quota, 100*float64(alloc.bytes.Load()-quota)/quota)
 	srng.Seek(0)
 	vrng.Seek(0)
 	// Verify & free
@@ -190,9 +194,6 @@ func test2u(t *testing.T, max int) {
 			t.Fatal(err)
 		}
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func Test2USmall(t *testing.T) { test2u(t, max) }
@@ -200,6 +201,7 @@ func Test2UBig(t *testing.T)   { test2u(t, bigMax) }
 
 func test3u(t *testing.T, max int) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	rem := quota
 	m := map[block][]byte{}
 	srng, err := mathutil.NewFC32(1, max, true)
@@ -250,7 +252,7 @@ func test3u(t *testing.T, max int) {
 			}
 		}
 	}
-	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs, alloc.mmaps, alloc.bytes, alloc.bytes-quota, 100*float64(alloc.bytes-quota)/quota)
+	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs.Load(), alloc.mmaps.Load(), alloc.bytes.Load(), alloc.bytes.Load()-quota, 100*float64(alloc.bytes.Load()-quota)/quota)
 	for b, v := range m {
 		for i, v := range v {
 			if *(*byte)(unsafe.Pointer(b.p + uintptr(i))) != v {
@@ -267,9 +269,6 @@ func test3u(t *testing.T, max int) {
 		}
 		alloc.UintptrFree(b.p)
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func Test3USmall(t *testing.T) { test3u(t, max) }
@@ -277,6 +276,7 @@ func Test3UBig(t *testing.T)   { test3u(t, bigMax) }
 
 func TestUFree(t *testing.T) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	p, err := alloc.UintptrMalloc(1)
 	if err != nil {
 		t.Fatal(err)
@@ -285,14 +285,11 @@ func TestUFree(t *testing.T) {
 	if err := alloc.UintptrFree(p); err != nil {
 		t.Fatal(err)
 	}
-
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func TestUMalloc(t *testing.T) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	p, err := alloc.UintptrMalloc(maxSlotSize)
 	if err != nil {
 		t.Fatal(err)
@@ -306,14 +303,11 @@ func TestUMalloc(t *testing.T) {
 	if err := alloc.UintptrFree(p); err != nil {
 		t.Fatal(err)
 	}
-
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func test1(t *testing.T, max int) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	rem := quota
 	var a [][]byte
 	srng, err := mathutil.NewFC32(0, math.MaxInt32, true)
@@ -340,7 +334,7 @@ func test1(t *testing.T, max int) {
 			b[i] = byte(vrng.Next())
 		}
 	}
-	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs, alloc.mmaps, alloc.bytes, alloc.bytes-quota, 100*float64(alloc.bytes-quota)/quota)
+	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs.Load(), alloc.mmaps.Load(), alloc.bytes.Load(), alloc.bytes.Load()-quota, 100*float64(alloc.bytes.Load()-quota)/quota)
 	srng.Seek(0)
 	vrng.Seek(0)
 	// Verify
@@ -372,9 +366,6 @@ func test1(t *testing.T, max int) {
 			t.Fatal(err)
 		}
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func Test1Small(t *testing.T) { test1(t, max) }
@@ -382,6 +373,7 @@ func Test1Big(t *testing.T)   { test1(t, bigMax) }
 
 func test2(t *testing.T, max int) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	rem := quota
 	var a [][]byte
 	srng, err := mathutil.NewFC32(0, math.MaxInt32, true)
@@ -408,7 +400,7 @@ func test2(t *testing.T, max int) {
 			b[i] = byte(vrng.Next())
 		}
 	}
-	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs, alloc.mmaps, alloc.bytes, alloc.bytes-quota, 100*float64(alloc.bytes-quota)/quota)
+	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs.Load(), alloc.mmaps.Load(), alloc.bytes.Load(), alloc.bytes.Load()-quota, 100*float64(alloc.bytes.Load()-quota)/quota)
 	srng.Seek(0)
 	vrng.Seek(0)
 	// Verify & free
@@ -432,9 +424,6 @@ func test2(t *testing.T, max int) {
 			t.Fatal(err)
 		}
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func Test2Small(t *testing.T) { test2(t, max) }
@@ -442,6 +431,7 @@ func Test2Big(t *testing.T)   { test2(t, bigMax) }
 
 func test3(t *testing.T, max int) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	rem := quota
 	m := map[*[]byte][]byte{}
 	srng, err := mathutil.NewFC32(1, max, true)
@@ -489,7 +479,7 @@ func test3(t *testing.T, max int) {
 			}
 		}
 	}
-	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs, alloc.mmaps, alloc.bytes, alloc.bytes-quota, 100*float64(alloc.bytes-quota)/quota)
+	t.Logf("allocs %v, mmaps %v, bytes %v, overhead %v (%.2f%%).", alloc.allocs.Load(), alloc.mmaps.Load(), alloc.bytes.Load(), alloc.bytes.Load()-quota, 100*float64(alloc.bytes.Load()-quota)/quota)
 	for k, v := range m {
 		b := *k
 		if !bytes.Equal(b, v) {
@@ -505,9 +495,6 @@ func test3(t *testing.T, max int) {
 		}
 		alloc.Free(b)
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func Test3Small(t *testing.T) { test3(t, max) }
@@ -515,6 +502,7 @@ func Test3Big(t *testing.T)   { test3(t, bigMax) }
 
 func TestFree(t *testing.T) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	b, err := alloc.Malloc(1)
 	if err != nil {
 		t.Fatal(err)
@@ -523,14 +511,11 @@ func TestFree(t *testing.T) {
 	if err := alloc.Free(b[:0]); err != nil {
 		t.Fatal(err)
 	}
-
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func TestMalloc(t *testing.T) {
 	var alloc Allocator
+	CheckLeaks(t, &alloc)
 	b, err := alloc.Malloc(maxSlotSize)
 	if err != nil {
 		t.Fatal(err)
@@ -544,14 +529,11 @@ func TestMalloc(t *testing.T) {
 	if err := alloc.Free(b[:0]); err != nil {
 		t.Fatal(err)
 	}
-
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		t.Fatalf("%+v", alloc)
-	}
 }
 
 func benchmarkFree(b *testing.B, size int) {
 	var alloc Allocator
+	CheckLeaks(b, &alloc)
 	a := make([][]byte, b.N)
 	for i := range a {
 		p, err := alloc.Malloc(size)
@@ -566,9 +548,6 @@ func benchmarkFree(b *testing.B, size int) {
 		alloc.Free(b)
 	}
 	b.StopTimer()
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		b.Fatalf("%+v", alloc)
-	}
 }
 
 func BenchmarkFree16(b *testing.B) { benchmarkFree(b, 1<<4) }
@@ -577,6 +556,7 @@ func BenchmarkFree64(b *testing.B) { benchmarkFree(b, 1<<6) }
 
 func benchmarkCalloc(b *testing.B, size int) {
 	var alloc Allocator
+	CheckLeaks(b, &alloc)
 	a := make([][]byte, b.N)
 	b.ResetTimer()
 	for i := range a {
@@ -591,9 +571,6 @@ func benchmarkCalloc(b *testing.B, size int) {
 	for _, b := range a {
 		alloc.Free(b)
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		b.Fatalf("%+v", alloc)
-	}
 }
 
 func BenchmarkCalloc16(b *testing.B) { benchmarkCalloc(b, 1<<4) }
@@ -616,6 +593,7 @@ func BenchmarkGoCalloc64(b *testing.B) { benchmarkGoCalloc(b, 1<<6) }
 
 func benchmarkMalloc(b *testing.B, size int) {
 	var alloc Allocator
+	CheckLeaks(b, &alloc)
 	a := make([][]byte, b.N)
 	b.ResetTimer()
 	for i := range a {
@@ -630,9 +608,6 @@ func benchmarkMalloc(b *testing.B, size int) {
 	for _, b := range a {
 		alloc.Free(b)
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		b.Fatalf("%+v", alloc)
-	}
 }
 
 func BenchmarkMalloc16(b *testing.B) { benchmarkMalloc(b, 1<<4) }
@@ -641,6 +616,7 @@ func BenchmarkMalloc64(b *testing.B) { benchmarkMalloc(b, 1<<6) }
 
 func benchmarkUintptrFree(b *testing.B, size int) {
 	var alloc Allocator
+	CheckLeaks(b, &alloc)
 	a := make([]uintptr, b.N)
 	for i := range a {
 		p, err := alloc.UintptrMalloc(size)
@@ -655,9 +631,6 @@ func benchmarkUintptrFree(b *testing.B, size int) {
 		alloc.UintptrFree(p)
 	}
 	b.StopTimer()
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		b.Fatalf("%+v", alloc)
-	}
 }
 
 func BenchmarkUintptrFree16(b *testing.B) { benchmarkUintptrFree(b, 1<<4) }
@@ -666,6 +639,7 @@ func BenchmarkUintptrFree64(b *testing.B) { benchmarkUintptrFree(b, 1<<6) }
 
 func benchmarkUintptrCalloc(b *testing.B, size int) {
 	var alloc Allocator
+	CheckLeaks(b, &alloc)
 	a := make([]uintptr, b.N)
 	b.ResetTimer()
 	for i := range a {
@@ -680,9 +654,6 @@ func benchmarkUintptrCalloc(b *testing.B, size int) {
 	for _, p := range a {
 		alloc.UintptrFree(p)
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		b.Fatalf("%+v", alloc)
-	}
 }
 
 func BenchmarkUintptrCalloc16(b *testing.B) { benchmarkUintptrCalloc(b, 1<<4) }
@@ -691,6 +662,7 @@ func BenchmarkUintptrCalloc64(b *testing.B) { benchmarkUintptrCalloc(b, 1<<6) }
 
 func benchmarkUintptrMalloc(b *testing.B, size int) {
 	var alloc Allocator
+	CheckLeaks(b, &alloc)
 	a := make([]uintptr, b.N)
 	b.ResetTimer()
 	for i := range a {
@@ -705,11 +677,5752 @@ func benchmarkUintptrMalloc(b *testing.B, size int) {
 	for _, p := range a {
 		alloc.UintptrFree(p)
 	}
-	if alloc.allocs != 0 || alloc.mmaps != 0 || alloc.bytes != 0 || len(alloc.regs) != 0 {
-		b.Fatalf("%+v", alloc)
-	}
 }
 
 func BenchmarkUintptrMalloc16(b *testing.B) { benchmarkUintptrMalloc(b, 1<<4) }
 func BenchmarkUintptrMalloc32(b *testing.B) { benchmarkUintptrMalloc(b, 1<<5) }
 func BenchmarkUintptrMalloc64(b *testing.B) { benchmarkUintptrMalloc(b, 1<<6) }
+
+func TestStats(t *testing.T) {
+	var alloc Allocator
+	b, err := alloc.Malloc(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := alloc.Calloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err = alloc.Realloc(b, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	s := alloc.Stats()
+	if g, e := s.Allocs, 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := s.Mallocs, uint64(3); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := s.Frees, uint64(1); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := s.Reallocs, uint64(1); g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Free(c); err != nil {
+		t.Fatal(err)
+	}
+
+	s = alloc.Stats()
+	if s.Allocs != 0 || s.Bytes != 0 || s.Mmaps != 0 {
+		t.Fatalf("%+v", s)
+	}
+
+	if g, e := s.Frees, uint64(3); g != e {
+		t.Fatal(g, e)
+	}
+
+	if s.BytesAllocated == 0 || s.BytesAllocated != s.BytesFreed {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	alloc := Allocator{Options: Options{TrackSizes: true}}
+	var a []uintptr
+	for i := 0; i < 10; i++ {
+		p, err := alloc.UintptrMalloc(17)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a = append(a, p)
+	}
+	f := alloc.Fragmentation()
+	if g, e := f.Requested, 10*17; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := f.Usable, 10*32; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := f.Internal, 10*15; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := f.PartialPages, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := f.FreeSlots, alloc.cap[5]-10; g != e {
+		t.Fatal(g, e)
+	}
+
+	for _, p := range a {
+		if err := alloc.UintptrFree(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f := alloc.Fragmentation(); f != (Fragmentation{}) {
+		t.Fatalf("%+v", f)
+	}
+
+	if err := alloc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !alloc.TrackSizes {
+		t.Fatal("Close must preserve Options")
+	}
+}
+
+func TestDump(t *testing.T) {
+	var alloc Allocator
+	p, err := alloc.UintptrMalloc(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := alloc.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := alloc.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	s := buf.String()
+	t.Logf("\n%s", s)
+	for _, v := range []string{"allocs 2, mmaps 2", "size classes:", "pages:", fmt.Sprintf("%#x", q&^uintptr(pageMask))} {
+		if !strings.Contains(s, v) {
+			t.Fatalf("missing %q", v)
+		}
+	}
+
+	alloc.UintptrFree(p)
+	alloc.UintptrFree(q)
+
+	// Headerless blocks and cached pages are listed as well.
+	alloc2 := Allocator{Options: Options{Headerless: true, LargeCache: 1 << 30}}
+	defer alloc2.Close()
+
+	if p, err = alloc2.UintptrMalloc(maxSlotSize + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if q, err = alloc2.UintptrMalloc(maxSlotSize + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	alloc2.Headerless = false
+	r, err := alloc2.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc2.UintptrFree(r)
+	buf.Reset()
+	if err := alloc2.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	s = buf.String()
+	t.Logf("\n%s", s)
+	for _, v := range []string{"mmaps 3", fmt.Sprintf("%#x", p), fmt.Sprintf("%#x", q), fmt.Sprintf("%#x", r&^uintptr(pageMask)), "bare", "cached"} {
+		if !strings.Contains(s, v) {
+			t.Fatalf("missing %q", v)
+		}
+	}
+
+	alloc2.UintptrFree(p)
+	alloc2.UintptrFree(q)
+}
+
+func TestWriteDOT(t *testing.T) {
+	var alloc Allocator
+	var a []uintptr
+	for i := 0; i < 4; i++ {
+		p, err := alloc.UintptrMalloc(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a = append(a, p)
+	}
+	alloc.UintptrFree(a[1])
+	alloc.UintptrFree(a[2])
+	var buf bytes.Buffer
+	if err := alloc.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	s := buf.String()
+	t.Logf("\n%s", s)
+	pg := a[0] &^ uintptr(pageMask)
+	for _, v := range []string{"digraph heap {", fmt.Sprintf("c4 -> p%x [label=\"2\"]", pg), "brk 4/"} {
+		if !strings.Contains(s, v) {
+			t.Fatalf("missing %q", v)
+		}
+	}
+
+	alloc.UintptrFree(a[0])
+	alloc.UintptrFree(a[3])
+
+	alloc2 := Allocator{Options: Options{Headerless: true, LargeCache: 1 << 30}}
+	defer alloc2.Close()
+
+	p, err := alloc2.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc2.Headerless = false
+	q, err := alloc2.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc2.UintptrFree(q)
+	buf.Reset()
+	if err := alloc2.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	s = buf.String()
+	t.Logf("\n%s", s)
+	for _, v := range []string{fmt.Sprintf("p%x [label=\"%#x|bare|", p, p), fmt.Sprintf("p%x [label=\"%#x|cached|", q&^uintptr(pageMask), q&^uintptr(pageMask))} {
+		if !strings.Contains(s, v) {
+			t.Fatalf("missing %q", v)
+		}
+	}
+
+	alloc2.UintptrFree(p)
+}
+
+func TestDumpHeap(t *testing.T) {
+	var alloc Allocator
+	var a []uintptr
+	for i := 0; i < 3; i++ {
+		p, err := alloc.UintptrMalloc(20)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		*(*byte)(unsafe.Pointer(p)) = byte(i + 1)
+		a = append(a, p)
+	}
+	big, err := alloc.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc.UintptrFree(a[1])
+	for _, contents := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := alloc.DumpHeap(&buf, contents); err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := ReadHeapDump(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g, e := d.Stats, alloc.Stats(); g != e {
+			t.Fatalf("%+v %+v", g, e)
+		}
+
+		if g, e := len(d.Pages), 2; g != e {
+			t.Fatal(g, e)
+		}
+
+		pg := d.Page(uint64(a[2]))
+		if pg == nil || pg.Log != 5 || pg.Brk != 3 || pg.Used != 2 || d.FreeSlots(pg) != 1 {
+			t.Fatalf("%+v", pg)
+		}
+
+		if g, e := d.Lists[5], []uint64{uint64(a[1])}; len(g) != 1 || g[0] != e[0] {
+			t.Fatal(g, e)
+		}
+
+		if pg := d.Page(uint64(big)); pg == nil || pg.Log != 0 {
+			t.Fatalf("%+v", pg)
+		}
+
+		if d.Page(0) != nil {
+			t.Fatal("unexpected page")
+		}
+
+		if contents {
+			if g, e := pg.Data[a[2]-uintptr(pg.Addr)], byte(3); g != e {
+				t.Fatal(g, e)
+			}
+		} else if pg.Data != nil {
+			t.Fatal("unexpected contents")
+		}
+	}
+	if _, err := ReadHeapDump(strings.NewReader("foo")); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	alloc.UintptrFree(a[0])
+	alloc.UintptrFree(a[2])
+	alloc.UintptrFree(big)
+
+	// Headerless blocks and cached pages are dumped as well.
+	alloc2 := Allocator{Options: Options{Headerless: true, LargeCache: 1 << 30}}
+	defer alloc2.Close()
+
+	p, err := alloc2.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc2.Headerless = false
+	q, err := alloc2.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc2.UintptrFree(q)
+	var buf bytes.Buffer
+	if err := alloc2.DumpHeap(&buf, true); !errors.Is(err, ErrUnsupported) {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := alloc2.DumpHeap(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := ReadHeapDump(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for _, v := range d.Pages {
+		n += v.Size
+	}
+	if g, e := n, alloc2.Stats().Bytes; g != e {
+		t.Fatal(g, e)
+	}
+
+	if pg := d.Page(uint64(p)); pg == nil || !pg.Bare || pg.Cached {
+		t.Fatalf("%+v", pg)
+	}
+
+	if pg := d.Page(uint64(q)); pg == nil || pg.Bare || !pg.Cached {
+		t.Fatalf("%+v", pg)
+	}
+
+	alloc2.UintptrFree(p)
+	buf.Reset()
+	if err := alloc2.DumpHeap(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, err = ReadHeapDump(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := len(d.Pages), 1; g != e || !d.Pages[0].Cached || len(d.Pages[0].Data) != d.Pages[0].Size {
+		t.Fatalf("%+v", d.Pages)
+	}
+}
+
+func TestMmapFault(t *testing.T) {
+	e := fmt.Errorf("injected")
+	alloc := Allocator{Options: Options{MmapFault: FailNthMmap(2, e)}}
+	p, err := alloc.UintptrMalloc(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.UintptrMalloc(maxSlotSize + 1); !errors.Is(err, e) || !errors.Is(err, ErrOOM) {
+		t.Fatal(err)
+	}
+
+	q, err := alloc.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc.UintptrFree(p)
+	alloc.UintptrFree(q)
+	if alloc.allocs.Load() != 0 || alloc.mmaps.Load() != 0 || alloc.bytes.Load() != 0 || len(alloc.regs) != 0 {
+		t.Fatalf("%+v", alloc.Stats())
+	}
+
+	alloc.MmapFault = FailMmapAbove(pageSize, e)
+	if p, err = alloc.UintptrMalloc(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.UintptrMalloc(maxSlotSize + 1); !errors.Is(err, e) || !errors.Is(err, ErrOOM) {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.UintptrMalloc(100); !errors.Is(err, e) {
+		t.Fatal(err)
+	}
+
+	alloc.UintptrFree(p)
+	if alloc.allocs.Load() != 0 || alloc.mmaps.Load() != 0 || alloc.bytes.Load() != 0 || len(alloc.regs) != 0 {
+		t.Fatalf("%+v", alloc.Stats())
+	}
+}
+
+func TestLimitedAllocator(t *testing.T) {
+	for i, v := range []struct {
+		maxAllocs, maxBytes int
+		sizes               []int
+		fail                int // Index of the first failing allocation, -1 if none.
+	}{
+		{0, 0, []int{1, 2, 3}, -1},
+		{2, 0, []int{1, 2, 3}, 2},
+		{0, 5, []int{1, 2, 3}, 2},
+		{0, 6, []int{1, 2, 3}, -1},
+		{1, 0, []int{maxSlotSize + 1, 1}, 1},
+	} {
+		alloc := LimitedAllocator{MaxAllocs: v.maxAllocs, MaxBytes: v.maxBytes}
+		var a [][]byte
+		fail := -1
+		for j, size := range v.sizes {
+			b, err := alloc.Malloc(size)
+			if err != nil {
+				if !errors.Is(err, ErrOOM) {
+					t.Fatal(i, j, err)
+				}
+
+				fail = j
+				break
+			}
+
+			a = append(a, b)
+		}
+		if g, e := fail, v.fail; g != e {
+			t.Errorf("%v: %v %v", i, g, e)
+		}
+
+		for _, b := range a {
+			alloc.Free(b)
+		}
+		if alloc.allocs.Load() != 0 || alloc.mmaps.Load() != 0 || alloc.bytes.Load() != 0 || len(alloc.regs) != 0 {
+			t.Fatalf("%v: %+v", i, alloc.Stats())
+		}
+	}
+}
+
+type leakTB struct {
+	testing.TB
+	cleanup func()
+	errors  []string
+}
+
+func (t *leakTB) Cleanup(f func())          { t.cleanup = f }
+func (t *leakTB) Error(args ...interface{}) { t.errors = append(t.errors, fmt.Sprint(args...)) }
+func (t *leakTB) Helper()                   {}
+func (t *leakTB) Errorf(s string, a ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(s, a...))
+}
+
+func TestCheckLeaks(t *testing.T) {
+	var alloc Allocator
+	tb := &leakTB{}
+	CheckLeaks(tb, &alloc)
+	p, err := alloc.UintptrMalloc(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb.cleanup()
+	if g, e := len(tb.errors), 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if !strings.Contains(tb.errors[0], "leaked 1 allocations") {
+		t.Fatal(tb.errors[0])
+	}
+
+	alloc.UintptrFree(p)
+	tb.errors = nil
+	tb.cleanup()
+	if len(tb.errors) != 0 {
+		t.Fatal(tb.errors)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	p, err := alloc.UintptrMalloc(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := alloc.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []uintptr{p + 1, p + 16, q + 16} {
+		err := alloc.UintptrFree(v)
+		if !errors.Is(err, ErrInvalidPointer) {
+			t.Fatalf("%#x: %v", v, err)
+		}
+
+		var e *Error
+		if !errors.As(err, &e) || e.Op != "free" || e.Addr != v {
+			t.Fatalf("%#x: %v", v, err)
+		}
+	}
+	alloc.UintptrFree(p)
+	alloc.UintptrFree(q)
+
+	errFault := errors.New("fault")
+	alloc.MmapFault = FailNthMmap(1, errFault)
+	_, err = alloc.UintptrMalloc(1)
+	if !errors.Is(err, ErrOOM) || !errors.Is(err, errFault) {
+		t.Fatal(err)
+	}
+
+	t.Log(err)
+}
+
+func TestNoPanic(t *testing.T) {
+	alloc := Allocator{Options: Options{NoPanic: true}}
+	CheckLeaks(t, &alloc)
+	if _, err := alloc.Malloc(-1); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.UnsafeCalloc(-1); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	p, err := alloc.UnsafeMalloc(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.UnsafeRealloc(p, -1); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	alloc.UnsafeFree(p)
+
+	alloc.NoPanic = false
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+
+	alloc.Malloc(-1)
+}
+
+func TestMallocHuge(t *testing.T) {
+	alloc := Allocator{Options: Options{NoPanic: true}}
+	CheckLeaks(t, &alloc)
+	for _, v := range []int{math.MaxInt, math.MaxInt - headerSize, math.MaxInt - 2*pageSize} {
+		if _, err := alloc.UintptrMalloc(v); !errors.Is(err, ErrOOM) {
+			t.Fatalf("%#x: %v", v, err)
+		}
+
+		if _, err := alloc.UintptrCalloc(v); !errors.Is(err, ErrOOM) {
+			t.Fatalf("%#x: %v", v, err)
+		}
+	}
+	if unsafe.Sizeof(uintptr(0)) < 8 {
+		t.Skip("32 bit platform")
+	}
+
+	if _, err := alloc.UintptrMalloc(math.MaxInt/2 + 1); !errors.Is(err, ErrOOM) {
+		t.Fatal(err)
+	}
+
+	sh := 30
+	size := 3 << sh
+	b, err := alloc.Malloc(size)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	if g, e := len(b), size; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g := UsableSize(&b[0]); g < size {
+		t.Fatal(g)
+	}
+
+	b[0], b[size-1] = 1, 2
+	if b, err = alloc.Realloc(b, size+1); err != nil {
+		alloc.Free(b)
+		t.Skip(err)
+	}
+
+	if b[0] != 1 || b[size-1] != 2 {
+		t.Fatal(b[0], b[size-1])
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallocZero(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	b, err := alloc.Calloc(0)
+	if b != nil || err != nil {
+		t.Fatal(b, err)
+	}
+
+	if b, err = alloc.Calloc(10); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := len(b), 10; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := cap(b), 16; g != e {
+		t.Fatal(g, e)
+	}
+
+	alloc.Free(b)
+}
+
+type countingBackend struct {
+	OSBackend
+	maps, unmaps int
+}
+
+func (b *countingBackend) Map(size, align int) (uintptr, int, error) {
+	b.maps++
+	return b.OSBackend.Map(size, align)
+}
+
+func (b *countingBackend) Unmap(addr uintptr, size int) error {
+	b.unmaps++
+	return b.OSBackend.Unmap(addr, size)
+}
+
+func TestBackend(t *testing.T) {
+	be := &countingBackend{}
+	alloc := Allocator{Options: Options{Backend: be}}
+	CheckLeaks(t, &alloc)
+	p, err := alloc.UintptrMalloc(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := alloc.UintptrMalloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc.UintptrFree(p)
+	alloc.UintptrFree(q)
+	if be.maps != 2 || be.unmaps != 2 {
+		t.Fatal(be.maps, be.unmaps)
+	}
+}
+
+func TestGoBackend(t *testing.T) {
+	alloc := Allocator{Options: Options{Backend: &GoBackend{}}}
+	CheckLeaks(t, &alloc)
+	var a [][]byte
+	for _, size := range []int{1, 100, 1000, maxSlotSize + 1, 3 * pageSize} {
+		b, err := alloc.Malloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range b {
+			b[i] = byte(i)
+		}
+		a = append(a, b)
+	}
+	runtime.GC()
+	for _, b := range a {
+		for i, v := range b {
+			if v != byte(i) {
+				t.Fatal(i, v)
+			}
+		}
+		if err := alloc.Free(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(alloc.Backend.(*GoBackend).maps) != 0 {
+		t.Fatal("leaked mapping")
+	}
+}
+
+func TestConceal(t *testing.T) {
+	alloc := Allocator{Options: Options{Backend: &OSBackend{Conceal: true}}}
+	CheckLeaks(t, &alloc)
+	p, err := alloc.UintptrMalloc(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer alloc.UintptrFree(p)
+
+	*(*byte)(unsafe.Pointer(p)) = 42
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	b, err := os.ReadFile("/proc/self/smaps")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var in bool
+	for _, line := range strings.Split(string(b), "\n") {
+		var lo, hi uintptr
+		if n, _ := fmt.Sscanf(line, "%x-%x", &lo, &hi); n == 2 {
+			in = p >= lo && p < hi
+			continue
+		}
+
+		if in && strings.HasPrefix(line, "VmFlags:") {
+			if !strings.Contains(line+" ", " dd ") {
+				t.Fatal(line)
+			}
+
+			return
+		}
+	}
+	t.Fatal("mapping not found")
+}
+
+func TestMmapAlign(t *testing.T) {
+	var b OSBackend
+	for _, align := range []int{osPageSize, pageSize, 4 * pageSize} {
+		for _, size := range []int{1, osPageSize + 1, pageSize, 3 * pageSize} {
+			p, n, err := b.Map(size, align)
+			if err != nil {
+				t.Fatal(align, size, err)
+			}
+
+			if p&uintptr(align-1) != 0 || n < size {
+				t.Fatalf("align %#x size %#x: %#x %#x", align, size, p, n)
+			}
+
+			s := unsafe.Slice((*byte)(unsafe.Pointer(p)), n)
+			s[0], s[n-1] = 1, 1
+			if err := b.Unmap(p, n); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestArenaBackend(t *testing.T) {
+	arena, err := NewArenaBackend(16 * pageSize)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer arena.Close()
+
+	alloc := Allocator{Options: Options{Backend: arena}}
+	CheckLeaks(t, &alloc)
+	var a []uintptr
+	for _, size := range []int{1, 100, maxSlotSize + 1, 3 * pageSize, 1} {
+		p, err := alloc.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(size, err)
+		}
+
+		if !arena.Contains(p) || !alloc.Contains(p) || !alloc.Contains(p+uintptr(size-1)) {
+			t.Fatalf("%#x", p)
+		}
+
+		s := unsafe.Slice((*byte)(unsafe.Pointer(p)), size)
+		for i := range s {
+			s[i] = 0xff
+		}
+		a = append(a, p)
+	}
+	if alloc.Contains(arena.Base()-1) || alloc.Contains(arena.Base()+uintptr(arena.Size())) {
+		t.Fatal("Contains")
+	}
+
+	if _, err := alloc.UintptrMalloc(16 * pageSize); !errors.Is(err, ErrOOM) {
+		t.Fatal(err)
+	}
+
+	for _, p := range a {
+		if err := alloc.UintptrFree(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, e := len(arena.free), 1; g != e {
+		t.Fatalf("free list %v", arena.free)
+	}
+
+	p, err := alloc.UintptrMalloc(3 * pageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range unsafe.Slice((*byte)(unsafe.Pointer(p)), 3*pageSize) {
+		if v != 0 {
+			t.Fatal(i, v)
+		}
+	}
+	alloc.UintptrFree(p)
+}
+
+func TestHandle(t *testing.T) {
+	var plain Allocator
+	if _, err := plain.HandleMalloc(1); !errors.Is(err, ErrUnsupported) {
+		t.Fatal(err)
+	}
+
+	arena, err := NewArenaBackend(4 * pageSize)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer arena.Close()
+
+	alloc := Allocator{Options: Options{Backend: arena}}
+	CheckLeaks(t, &alloc)
+	h, err := alloc.HandleCalloc(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := alloc.Resolve(h)
+	if p == 0 || alloc.HandleOf(p) != h || uint64(h) != uint64(p-arena.Base()) {
+		t.Fatalf("%#x %#x", h, p)
+	}
+
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(p)), 10), "0123456789")
+	if h, err = alloc.HandleRealloc(h, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(unsafe.Slice((*byte)(unsafe.Pointer(alloc.Resolve(h))), 10)), "0123456789"; g != e {
+		t.Fatalf("got %q, expected %q", g, e)
+	}
+
+	if alloc.Resolve(0) != 0 || alloc.Resolve(Handle(arena.Size())) != 0 {
+		t.Fatal("Resolve")
+	}
+
+	if err := alloc.HandleFree(Handle(arena.Size())); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+
+	if err := alloc.HandleFree(h); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompactingHeap(t *testing.T) {
+	h, err := NewCompactingHeap(64 * pageSize)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer h.Close()
+
+	rng, err := mathutil.NewFC32(4, 1000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var refs []Ref
+	for i := 0; i < 10000; i++ {
+		r, err := h.Malloc(rng.Next())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := h.Resolve(r)
+		*(*uint32)(unsafe.Pointer(p)) = uint32(r)
+		refs = append(refs, r)
+	}
+	for i := 0; i < len(refs); i += 2 {
+		if err := h.Free(refs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mmaps := h.Stats().Mmaps
+	if err := h.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := h.Len(), len(refs)/2; g != e {
+		t.Fatalf("got %v, expected %v", g, e)
+	}
+
+	if g := h.Stats().Mmaps; g >= mmaps {
+		t.Fatalf("mmaps %v -> %v", mmaps, g)
+	}
+
+	for i := 1; i < len(refs); i += 2 {
+		r := refs[i]
+		if err := h.Realloc(r, 2000); err != nil {
+			t.Fatal(err)
+		}
+
+		if g, e := *(*uint32)(unsafe.Pointer(h.Resolve(r))), uint32(r); g != e {
+			t.Fatalf("got %v, expected %v", g, e)
+		}
+	}
+	if err := h.Free(refs[0]); !errors.Is(err, ErrStale) {
+		t.Fatal(err)
+	}
+
+	if err := h.Free(Ref(len(refs) + 1)); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+}
+
+// A Handle or Ref of a freed object must not resolve to, nor free, the object
+// reusing its memory.
+func TestStaleHandle(t *testing.T) {
+	t.Run("SharedHeap", func(t *testing.T) {
+		name := fmt.Sprintf("memory-test-stale-%d", os.Getpid())
+		h, err := OpenSharedHeap(name, 1<<20)
+		if err != nil {
+			t.Skip(err)
+		}
+
+		defer RemoveSharedHeap(name)
+		defer h.Close()
+
+		r, err := h.Malloc(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g := h.Handle(h.Resolve(r)); g != r {
+			t.Fatalf("got %v, expected %v", g, r)
+		}
+
+		if err := h.Free(r); err != nil {
+			t.Fatal(err)
+		}
+
+		// A double free through a Handle without a generation.
+		if err := h.Free(r & sharedOffMask); !errors.Is(err, ErrStale) {
+			t.Fatal(err)
+		}
+
+		r2, err := h.Malloc(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r2&sharedOffMask != r&sharedOffMask || r2 == r {
+			t.Fatalf("%v %v", r, r2)
+		}
+
+		if h.Resolve(r) != 0 {
+			t.Fatal("stale handle resolved")
+		}
+
+		if err := h.Free(r); !errors.Is(err, ErrStale) {
+			t.Fatal(err)
+		}
+
+		if h.Resolve(r2) == 0 {
+			t.Fatal("handle not resolved")
+		}
+
+		if err := h.Free(r2); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("CompactingHeap", func(t *testing.T) {
+		h, err := NewCompactingHeap(1 << 24)
+		if err != nil {
+			t.Skip(err)
+		}
+
+		defer h.Close()
+
+		r, err := h.Malloc(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := h.Free(r); err != nil {
+			t.Fatal(err)
+		}
+
+		r2, err := h.Malloc(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r2&(1<<refGenShift-1) != r || r2 == r {
+			t.Fatalf("%v %v", r, r2)
+		}
+
+		if h.Resolve(r) != 0 {
+			t.Fatal("stale ref resolved")
+		}
+
+		if err := h.Free(r); !errors.Is(err, ErrStale) {
+			t.Fatal(err)
+		}
+
+		if err := h.Realloc(r, 200); !errors.Is(err, ErrStale) {
+			t.Fatal(err)
+		}
+
+		if err := h.Compact(); err != nil {
+			t.Fatal(err)
+		}
+
+		if h.Resolve(r) != 0 || h.Resolve(r2) == 0 {
+			t.Fatal(h.Resolve(r), h.Resolve(r2))
+		}
+
+		if err := h.Free(r2); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Allocator", func(t *testing.T) {
+		arena, err := NewArenaBackend(1 << 24)
+		if err != nil {
+			t.Skip(err)
+		}
+
+		defer arena.Close()
+
+		alloc := Allocator{Options: Options{Backend: arena}}
+		defer alloc.Close()
+
+		// The arena hands out the range of a freed page again.
+		h, err := alloc.HandleMalloc(maxSlotSize + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := alloc.HandleFree(h); err != nil {
+			t.Fatal(err)
+		}
+
+		h2, err := alloc.HandleMalloc(maxSlotSize + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h2&handleOffMask != h&handleOffMask || h2 == h {
+			t.Fatalf("%v %v", h, h2)
+		}
+
+		if alloc.Resolve(h) != 0 || arena.Resolve(h) != 0 {
+			t.Fatal("stale handle resolved")
+		}
+
+		if err := alloc.HandleFree(h); !errors.Is(err, ErrStale) {
+			t.Fatal(err)
+		}
+
+		if _, err := alloc.HandleRealloc(h, 200); !errors.Is(err, ErrStale) {
+			t.Fatal(err)
+		}
+
+		if p := alloc.Resolve(h2); p == 0 || alloc.HandleOf(p) != h2 {
+			t.Fatal(p)
+		}
+
+		if err := alloc.HandleFree(h2); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSaveRestore(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	var a []uintptr
+	for i, size := range []int{1, 16, 17, 100, 1000, 100, maxSlotSize + 1, 2 * pageSize} {
+		p, err := alloc.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		*(*byte)(unsafe.Pointer(p)) = byte(i)
+		a = append(a, p)
+	}
+	alloc.UintptrFree(a[3])
+	var buf bytes.Buffer
+	if err := alloc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var restored Allocator
+	CheckLeaks(t, &restored)
+	reloc, err := restored.Restore(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := restored.Stats(), alloc.Stats(); g != e {
+		t.Fatalf("got %+v, expected %+v", g, e)
+	}
+
+	var b1 bytes.Buffer
+	if err := restored.DumpHeap(&b1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := ReadHeapDump(&b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := d.Lists[7]; len(l) != 1 || uintptr(l[0]) != reloc.Addr(a[3]) {
+		t.Fatalf("free list not restored: %#x", l)
+	}
+
+	for i := 0; i < 3; i++ {
+		p, err := alloc.UintptrMalloc(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, err := restored.UintptrMalloc(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if q != reloc.Addr(p) {
+			t.Fatalf("%v: %#x %#x", i, q, reloc.Addr(p))
+		}
+
+		defer alloc.UintptrFree(p)
+		defer restored.UintptrFree(q)
+	}
+	for i, p := range a {
+		if i == 3 {
+			continue
+		}
+
+		q := reloc.Addr(p)
+		if q == 0 || q == p || *(*byte)(unsafe.Pointer(q)) != byte(i) || UintptrUsableSize(q) != UintptrUsableSize(p) {
+			t.Fatalf("%v: %#x %#x", i, p, q)
+		}
+
+		alloc.UintptrFree(p)
+		if err := restored.UintptrFree(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reloc.Addr(1) != 0 {
+		t.Fatal("Addr")
+	}
+
+	if _, err := restored.Restore(bytes.NewReader(nil)); err == nil {
+		t.Fatal("expected error")
+	}
+
+	var b2 bytes.Buffer
+	p, _ := restored.UintptrMalloc(1)
+	restored.DumpHeap(&b2, false)
+	restored.UintptrFree(p)
+	var r2 Allocator
+	if _, err := r2.Restore(&b2); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Cached pages are not restored.
+	cached := Allocator{Options: Options{LargeCache: 1 << 30}}
+	defer cached.Close()
+
+	if p, err = cached.UintptrMalloc(maxSlotSize + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	cached.UintptrFree(p)
+	b2.Reset()
+	if err := cached.Save(&b2); err != nil {
+		t.Fatal(err)
+	}
+
+	var r3 Allocator
+	defer r3.Close()
+
+	if _, err := r3.Restore(&b2); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := r3.Stats().Mmaps; g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestSharedHeapFlush(t *testing.T) {
+	name := fmt.Sprintf("memory-test-flush-%v", os.Getpid())
+	h, err := OpenSharedHeap(name, 1<<20)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer RemoveSharedHeap(name)
+	defer h.Close()
+
+	r, err := h.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := unsafe.Pointer(h.Resolve(r))
+	copy(unsafe.Slice((*byte)(p), 100), "flushed")
+	if err := h.Flush(p, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := os.ReadFile(SharedHeapPath(name)); err != nil || !bytes.Contains(b, []byte("flushed")) {
+		t.Fatal(err)
+	}
+
+	if err := h.Flush(p, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var x int
+	for _, v := range []struct {
+		p    unsafe.Pointer
+		size int
+	}{
+		{p, -1},
+		{p, h.Size()},
+		{unsafe.Pointer(&x), 1},
+	} {
+		if err := h.Flush(v.p, v.size); !errors.Is(err, ErrInvalidPointer) {
+			t.Fatal(v, err)
+		}
+	}
+
+	if err := h.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Free(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedHeap(t *testing.T) {
+	name := fmt.Sprintf("memory-test-%v", os.Getpid())
+	h1, err := OpenSharedHeap(name, 1<<20)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer RemoveSharedHeap(name)
+	defer h1.Close()
+
+	// A second mapping of the same heap, as another process would see it.
+	h2, err := OpenSharedHeap(name, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer h2.Close()
+
+	if h2.Size() != 1<<20 || h1.Resolve(16) == h2.Resolve(16) {
+		t.Fatal(h2.Size())
+	}
+
+	r, err := h1.Calloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(h1.Resolve(r))), 100), "hello")
+	h1.SetRoot(r)
+	r2 := h2.Root()
+	if g, e := string(unsafe.Slice((*byte)(unsafe.Pointer(h2.Resolve(r2))), 5)), "hello"; g != e {
+		t.Fatalf("got %q, expected %q", g, e)
+	}
+
+	if err := h1.Flush(unsafe.Pointer(h1.Resolve(r)), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h2.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h1.Flush(unsafe.Pointer(h1.Resolve(r)), 1<<20); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+
+	if b, err := os.ReadFile(SharedHeapPath(name)); err != nil || !bytes.Contains(b, []byte("hello")) {
+		t.Fatal(err)
+	}
+
+	if g, e := h2.Handle(h2.Resolve(r2)), r; g != e {
+		t.Fatalf("got %v, expected %v", g, e)
+	}
+
+	if err := h2.Free(r2); err != nil {
+		t.Fatal(err)
+	}
+
+	r3, err := h1.Malloc(90)
+	if err != nil || r3&sharedOffMask != r&sharedOffMask || r3 == r {
+		t.Fatalf("%v %v %v", r3, r, err)
+	}
+
+	// r is stale, its block was reused by r3.
+	if h1.Resolve(r) != 0 || h1.Resolve(r3) == 0 || h1.Resolve(r&sharedOffMask) != h1.Resolve(r3) {
+		t.Fatal(h1.Resolve(r), h1.Resolve(r3))
+	}
+
+	if err := h1.Free(r); !errors.Is(err, ErrStale) {
+		t.Fatal(err)
+	}
+
+	if _, err := h1.Malloc(1 << 20); !errors.Is(err, ErrOOM) {
+		t.Fatal(err)
+	}
+
+	if err := h1.Free(r + 1); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+
+	h1.Lock()
+	h2.Unlock()
+	h2.Lock()
+	h1.Unlock()
+}
+
+func TestRingBuffer(t *testing.T) {
+	b, err := RingBuffer(100)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := len(b) / 2
+	if n != osPageSize {
+		t.Fatal(len(b))
+	}
+
+	for i := 0; i < n; i++ {
+		b[i] = byte(i)
+	}
+	copy(b[n-2:], "abcd")
+	for i := 0; i < n; i++ {
+		if b[i] != b[i+n] {
+			t.Fatal(i)
+		}
+	}
+	if g, e := string(b[:2]), "cd"; g != e {
+		t.Fatalf("got %q, expected %q", g, e)
+	}
+
+	if err := FreeRingBuffer(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMMap(t *testing.T) {
+	f, err := os.CreateTemp("", "memory-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := MapFile(f, MapWrite)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(m.Bytes(), data) {
+		t.Fatal("content")
+	}
+
+	copy(m.Bytes(), "abc")
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	copy(m.Bytes()[5000:], "def")
+	if err := m.FlushRange(5000, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.FlushRange(len(data), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range [][2]int{{-1, 1}, {0, -1}, {len(data), 1}, {1, len(data)}} {
+		if err := m.FlushRange(v[0], v[1]); !errors.Is(err, ErrInvalidPointer) {
+			t.Fatal(v, err)
+		}
+	}
+
+	if err := m.Lock(); err != nil && !errors.Is(err, ErrUnsupported) {
+		t.Log(err) // RLIMIT_MEMLOCK may be too low.
+	} else if err == nil {
+		if err := m.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Unmap(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil || string(b[:4]) != "abc3" || string(b[5000:5004]) != "def3" {
+		t.Fatalf("%q %q %v", b[:4], b[5000:5004], err)
+	}
+
+	m, err = MapFileRegion(f, 5003, 10, MapCopy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(m.Bytes()), "3456789012"; g != e {
+		t.Fatalf("got %q, expected %q", g, e)
+	}
+
+	copy(m.Bytes(), "xyz")
+	if err := m.Unmap(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(f.Name()); string(b[5003:5006]) != "345" {
+		t.Fatalf("%q", b[5003:5006])
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	b := NewBuffer(&alloc)
+	defer b.Close()
+
+	var _ io.ReadWriter = b
+	var e []byte
+	for i := 0; i < 10000; i++ {
+		s := fmt.Sprint(i)
+		if _, err := b.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+
+		e = append(e, s...)
+	}
+	if !bytes.Equal(b.Bytes(), e) {
+		t.Fatal("content")
+	}
+
+	c, err := b.ReadByte()
+	if err != nil || c != '0' {
+		t.Fatal(c, err)
+	}
+
+	g, err := io.ReadAll(b)
+	if err != nil || !bytes.Equal(g, e[1:]) {
+		t.Fatal(err)
+	}
+
+	if b.Len() != 0 || b.Cap() == 0 {
+		t.Fatal(b.Len(), b.Cap())
+	}
+
+	if _, err := b.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.WriteByte('!'); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := b.String(), "hello!"; g != e {
+		t.Fatalf("got %q, expected %q", g, e)
+	}
+
+	b.Reset()
+	if _, err := b.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal(err)
+	}
+}
+
+func TestVector(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	type point struct {
+		x, y int32
+		tag  [3]byte
+	}
+
+	v, err := NewVector[point](&alloc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer v.Close()
+
+	for i := 0; i < 10000; i++ {
+		if err := v.Append(point{x: int32(i), y: -int32(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v.Len() != 10000 || v.Cap() < v.Len() {
+		t.Fatal(v.Len(), v.Cap())
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if p := v.At(i); p.x != int32(i) || p.y != -int32(i) {
+			t.Fatal(i, p)
+		}
+	}
+	v.Set(1, point{tag: [3]byte{1, 2, 3}})
+	v.Ptr(2).x = 42
+	v.Truncate(3)
+	if g := v.Slice(); len(g) != 3 || g[1].tag[2] != 3 || g[2].x != 42 {
+		t.Fatal(g)
+	}
+
+	z, err := NewVector[struct{}](&alloc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z.Append(struct{}{}, struct{}{})
+	if z.Len() != 2 {
+		t.Fatal(z.Len())
+	}
+
+	z.Close()
+
+	if _, err := NewVector[string](&alloc); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := NewVector[struct {
+		n int
+		p *int
+	}](&alloc); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestMap(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	type key struct {
+		a int32
+		b [4]byte
+	}
+
+	m, err := NewMap[key, int](&alloc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer m.Close()
+
+	const n = 10000
+	if err := m.Reserve(n / 2); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := m.Put(key{a: int32(i)}, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Put(key{a: 1}, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Len() != n {
+		t.Fatal(m.Len())
+	}
+
+	for i := 0; i < n; i += 2 {
+		if !m.Delete(key{a: int32(i)}) {
+			t.Fatal(i)
+		}
+	}
+	if m.Delete(key{a: 0}) || m.Len() != n/2 {
+		t.Fatal(m.Len())
+	}
+
+	for i := 0; i < n; i++ {
+		v, ok := m.Get(key{a: int32(i)})
+		switch {
+		case i&1 == 0:
+			if ok {
+				t.Fatal(i)
+			}
+		case i == 1:
+			if !ok || v != -1 {
+				t.Fatal(i, v, ok)
+			}
+		default:
+			if !ok || v != i {
+				t.Fatal(i, v, ok)
+			}
+		}
+	}
+	var cnt int
+	m.Range(func(k key, v int) bool {
+		if k.a&1 == 0 {
+			t.Fatal(k)
+		}
+
+		cnt++
+		return true
+	})
+	if cnt != n/2 {
+		t.Fatal(cnt)
+	}
+
+	for _, f := range []func() error{
+		func() error { _, err := NewMap[string, int](&alloc); return err },
+		func() error { _, err := NewMap[int, []byte](&alloc); return err },
+		func() error { _, err := NewMap[float64, int](&alloc); return err },
+		func() error {
+			_, err := NewMap[struct {
+				a byte
+				b int64
+			}, int](&alloc)
+			return err
+		},
+	} {
+		if f() == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestInterner(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	in := NewInterner(&alloc)
+	defer in.Close()
+
+	const n = 20000
+	syms := map[Symbol]string{}
+	for i := 0; i < 2*n; i++ {
+		s := fmt.Sprint(i % n)
+		if i%1000 == 0 {
+			s = strings.Repeat(s, 10000)
+		}
+		sym, err := in.Intern(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if x, ok := syms[sym]; ok && x != s {
+			t.Fatalf("%v: %q %q", sym, x, s)
+		}
+
+		syms[sym] = s
+	}
+	if g, e := in.Len(), n; g != e {
+		t.Fatalf("got %v, expected %v", g, e)
+	}
+
+	for sym, s := range syms {
+		if g := in.String(sym); g != s {
+			t.Fatalf("got %q, expected %q", g, s)
+		}
+
+		if x, ok := in.Lookup(s); !ok || x != sym {
+			t.Fatal(s, x, ok)
+		}
+	}
+	if _, ok := in.Lookup("foo"); ok {
+		t.Fatal("Lookup")
+	}
+
+	e, err := in.InternBytes(nil)
+	if err != nil || in.String(e) != "" {
+		t.Fatal(err)
+	}
+
+	if e2, _ := in.Intern(""); e2 != e {
+		t.Fatal(e, e2)
+	}
+}
+
+func TestBTree(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	tr, err := NewBTree[int, int](&alloc, func(a, b int) int { return a - b })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tr.Close()
+
+	const n = 50000
+	rng, err := mathutil.NewFC32(0, n-1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		k := rng.Next()
+		if err := tr.Set(k, -k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Set(42, 42); err != nil || tr.Len() != n {
+		t.Fatal(tr.Len(), err)
+	}
+
+	for i := 0; i < n; i += 3 {
+		k := rng.Next()
+		if k%2 == 0 && !tr.Delete(k) {
+			t.Fatal(k)
+		}
+	}
+	for i := 0; i < n; i++ {
+		k := rng.Next()
+		if k%2 == 0 {
+			tr.Delete(k)
+		}
+	}
+	if tr.Delete(0) || tr.Len() != n/2 {
+		t.Fatal(tr.Len())
+	}
+
+	prev := -1
+	tr.Ascend(func(k, v int) bool {
+		if k <= prev || k%2 == 0 || v != -k {
+			t.Fatal(prev, k, v)
+		}
+
+		prev = k
+		return true
+	})
+	if prev != n-1 {
+		t.Fatal(prev)
+	}
+
+	var got []int
+	tr.AscendFrom(100, func(k, v int) bool {
+		got = append(got, k)
+		return len(got) < 3
+	})
+	if fmt.Sprint(got) != "[101 103 105]" {
+		t.Fatal(got)
+	}
+
+	if v, ok := tr.Get(7); !ok || v != -7 {
+		t.Fatal(v, ok)
+	}
+
+	if _, ok := tr.Get(8); ok {
+		t.Fatal(8)
+	}
+
+	for i := 1; i < n; i += 2 {
+		if !tr.Delete(i) {
+			t.Fatal(i)
+		}
+	}
+	if tr.Len() != 0 || tr.root != nil {
+		t.Fatal(tr.Len())
+	}
+
+	b, err := NewBTree[[4]byte, struct{}](&alloc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer b.Close()
+
+	for _, s := range []string{"dddd", "aaaa", "cccc", "bbbb"} {
+		var k [4]byte
+		copy(k[:], s)
+		b.Set(k, struct{}{})
+	}
+	var s []string
+	b.Ascend(func(k [4]byte, _ struct{}) bool { s = append(s, string(k[:])); return true })
+	if g, e := strings.Join(s, " "), "aaaa bbbb cccc dddd"; g != e {
+		t.Fatalf("got %q, expected %q", g, e)
+	}
+
+	if _, err := NewBTree[string, int](&alloc, strings.Compare); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRefCounted(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	r, err := alloc.NewRefCounted(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Size() != 100 || len(r.Bytes()) != 100 || r.Refs() != 1 || r.Bytes()[99] != 0 {
+		t.Fatal(r.Size(), r.Refs())
+	}
+
+	copy(r.Bytes(), "shared")
+	r2 := r.Retain()
+	r2.Retain()
+	if r.Refs() != 3 || string(r2.Bytes()[:6]) != "shared" {
+		t.Fatal(r.Refs())
+	}
+
+	for i := 0; i < 3; i++ {
+		freed, err := r.Release()
+		if err != nil || freed != (i == 2) {
+			t.Fatal(i, freed, err)
+		}
+	}
+}
+
+func TestDeferFree(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	alloc.Epochs = &Epochs{}
+	r := alloc.Epochs.NewReader()
+	defer r.Close()
+
+	p, err := alloc.UintptrMalloc(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Pin()
+	alloc.DeferFree(p)
+	for i := 0; i < 5; i++ {
+		if n, err := alloc.Advance(); n != 0 || err != nil {
+			t.Fatal(n, err)
+		}
+	}
+	if alloc.Deferred() != 1 || alloc.Stats().Allocs != 1 {
+		t.Fatal(alloc.Deferred())
+	}
+
+	r.Unpin()
+	r.Pin() // Pinning again at the newer epoch does not prevent the free.
+	n := 0
+	for i := 0; i < 3; i++ {
+		m, err := alloc.Advance()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n += m
+		r.Unpin()
+		r.Pin()
+	}
+	r.Unpin()
+	if n != 1 || alloc.Deferred() != 0 {
+		t.Fatal(n, alloc.Deferred())
+	}
+
+	alloc.Epochs = nil
+	p, _ = alloc.UintptrMalloc(10)
+	alloc.DeferFree(p)
+	if n, err := alloc.Advance(); n != 1 || err != nil {
+		t.Fatal(n, err)
+	}
+}
+
+func TestAuto(t *testing.T) {
+	var alloc Allocator
+	defer alloc.Close()
+
+	kept, err := alloc.CallocAuto(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		for i := 0; i < 10; i++ {
+			if _, err := alloc.MallocAuto(100); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+	for i := 0; i < 100 && alloc.Stats().Reclaimed != 10; i++ {
+		runtime.GC()
+		if _, err := alloc.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, e := alloc.Stats().Reclaimed, uint64(10); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := alloc.Stats().Allocs, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	for _, v := range kept.Bytes() {
+		if v != 0 {
+			t.Fatal(v)
+		}
+	}
+	if err := kept.Free(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kept.Free(); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Allocs, 0; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestCheckPointers(t *testing.T) {
+	type node struct {
+		N    int
+		Next *node
+		Name string
+		Kids []int
+		F    func()
+	}
+
+	var alloc Allocator
+	defer alloc.Close()
+
+	p, err := alloc.UnsafeCalloc(int(unsafe.Sizeof(node{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := (*node)(p)
+	if err := Store(&alloc, n, node{N: 42, Next: n}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckPointers(&alloc, n); err != nil || n.N != 42 {
+		t.Fatal(err, n.N)
+	}
+
+	for i, v := range []node{
+		{Next: &node{}},
+		{Name: strings.Repeat("x", 10)},
+		{Kids: make([]int, 1)},
+		{F: func() {}},
+	} {
+		err := Store(&alloc, n, v)
+		if !errors.Is(err, ErrInvalidPointer) {
+			t.Fatal(i, err)
+		}
+
+		t.Log(err)
+	}
+	if n.N != 42 {
+		t.Fatal(n.N)
+	}
+
+	var x node
+	if err := Store(&alloc, &x, node{}); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+
+	if err := CheckPointers(&alloc, &[4]int{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMallocBatch(t *testing.T) {
+	var alloc Allocator
+	defer alloc.Close()
+
+	for _, size := range []int{16, 100, 4000, maxSlotSize + 1} {
+		n := 3*pageAvail/size + 7
+		if size > maxSlotSize {
+			n = 5
+		}
+		var kept []uintptr
+		for i := 0; i < n/2; i++ { // Leave holes in the free list.
+			p, err := alloc.UintptrMalloc(size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if i%2 == 0 {
+				alloc.UintptrFree(p)
+				continue
+			}
+
+			kept = append(kept, p)
+		}
+		b, err := alloc.MallocBatch(size, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g, e := len(b), n; g != e {
+			t.Fatal(g, e)
+		}
+
+		seen := map[uintptr]bool{}
+		for _, p := range kept {
+			seen[p] = true
+		}
+		for i, v := range b {
+			if g, e := len(v), size; g != e {
+				t.Fatal(i, g, e)
+			}
+
+			p := uintptr(unsafe.Pointer(&v[0]))
+			if seen[p] {
+				t.Fatal(i, size)
+			}
+
+			seen[p] = true
+			v[0], v[size-1] = byte(i), byte(i)
+		}
+		if g, e := alloc.Stats().Allocs, len(kept)+n; g != e {
+			t.Fatal(size, g, e)
+		}
+
+		for i, v := range b {
+			if v[0] != byte(i) || v[size-1] != byte(i) {
+				t.Fatal(i, size)
+			}
+
+			if err := alloc.Free(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, p := range kept {
+			if err := alloc.UintptrFree(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if g, e := alloc.Stats().Allocs, 0; g != e {
+			t.Fatal(size, g, e)
+		}
+	}
+	if alloc.Stats().Mmaps != 0 {
+		t.Fatal(alloc.Stats().Mmaps)
+	}
+
+	alloc.MmapFault = FailNthMmap(2, errors.New("fault"))
+	if _, err := alloc.UintptrMallocBatch(1000, 2*pageAvail/1024); !errors.Is(err, ErrOOM) {
+		t.Fatal(err)
+	}
+
+	if s := alloc.Stats(); s.Allocs != 0 || s.Mmaps != 0 {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestFreeBatch(t *testing.T) {
+	var alloc Allocator
+	defer alloc.Close()
+
+	alloc.TrackSizes = true
+	var p []uintptr
+	for _, size := range []int{16, 100, 4000, maxSlotSize + 1} {
+		q, err := alloc.UintptrMallocBatch(size, 2*pageAvail/size+3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = append(p, q...)
+	}
+	rng, err := mathutil.NewFC32(0, len(p)-1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range p { // Shuffle.
+		j := rng.Next()
+		p[i], p[j] = p[j], p[i]
+	}
+	n := len(p)
+	if err := alloc.UintptrFree(p[n-1]); err != nil {
+		t.Fatal(err)
+	}
+
+	p[n-1] = 0
+	keep := p[:n/3]
+	if err := alloc.UintptrFreeBatch(p[n/3:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Allocs, len(keep); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := alloc.UintptrFreeBatch([]uintptr{keep[0], keep[0]}), ErrInvalidPointer; !errors.Is(g, e) {
+		t.Fatal(g, e)
+	}
+
+	// Reuse of the freed slots must not corrupt the heap.
+	b, err := alloc.MallocBatch(100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.FreeBatch(b); err != nil {
+		t.Fatal(err)
+	}
+
+	q := make([]unsafe.Pointer, len(keep))
+	for i, v := range keep {
+		q[i] = unsafe.Pointer(v)
+	}
+	if err := alloc.UnsafeFreeBatch(q); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := alloc.Stats(); s.Allocs != 0 || s.Mmaps != 0 || s.Bytes != 0 {
+		t.Fatalf("%+v", s)
+	}
+
+	if g, e := alloc.Fragmentation().Requested, 0; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	var a, b Allocator
+	defer a.Close()
+	defer b.Close()
+
+	big, err := a.Malloc(maxSlotSize + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	big[0] = 42
+	small, err := a.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Transfer(&b, small); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	if err := b.Transfer(&a, big); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+
+	arena, err := NewArenaBackend(1 << 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer arena.Close()
+	c := Allocator{Options: Options{Backend: arena}}
+	if err := a.Transfer(&c, big); !errors.Is(err, ErrUnsupported) {
+		t.Fatal(err)
+	}
+
+	if err := a.Transfer(&b, big); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := a.Stats(); s.Allocs != 1 || s.Mmaps != 1 {
+		t.Fatalf("%+v", s)
+	}
+
+	if s := b.Stats(); s.Allocs != 1 || s.Mmaps != 1 || s.Bytes < maxSlotSize {
+		t.Fatalf("%+v", s)
+	}
+
+	if big[0] != 42 {
+		t.Fatal(big[0])
+	}
+
+	if err := a.Free(small); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Free(big); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := b.Stats(); s.Allocs != 0 || s.Mmaps != 0 || s.Bytes != 0 {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestClone(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	alloc.TrackSizes = true
+	var a []uintptr
+	for i, size := range []int{1, 16, 17, 100, 1000, 100, maxSlotSize + 1} {
+		p, err := alloc.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		*(*byte)(unsafe.Pointer(p)) = byte(i)
+		a = append(a, p)
+	}
+	alloc.UintptrFree(a[3])
+	c, reloc, err := alloc.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CheckLeaks(t, c)
+	if g, e := c.Stats(), alloc.Stats(); g != e {
+		t.Fatalf("got %+v, expected %+v", g, e)
+	}
+
+	if g, e := c.Fragmentation(), alloc.Fragmentation(); g != e {
+		t.Fatalf("got %+v, expected %+v", g, e)
+	}
+
+	// The clone is independent of the original.
+	*(*byte)(unsafe.Pointer(a[0])) = 99
+	p, err := alloc.UintptrMalloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := c.UintptrMalloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q != reloc.Addr(p) {
+		t.Fatalf("%#x %#x", q, reloc.Addr(p))
+	}
+
+	alloc.UintptrFree(p)
+	c.UintptrFree(q)
+	for i, p := range a {
+		if i == 3 {
+			continue
+		}
+
+		q := reloc.Addr(p)
+		if i != 0 && *(*byte)(unsafe.Pointer(q)) != byte(i) || i == 0 && *(*byte)(unsafe.Pointer(q)) != 0 {
+			t.Fatal(i)
+		}
+
+		alloc.UintptrFree(p)
+		if err := c.UintptrFree(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	for i := 0; i < 3*pageAvail/1024; i++ {
+		if _, err := alloc.Malloc(1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := alloc.UintptrMalloc(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc.UintptrFree(p)
+	if _, err := alloc.Malloc(100); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.Malloc(maxSlotSize + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	mmaps := alloc.Stats().Mmaps
+	if err := alloc.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := alloc.Stats()
+	if s.Allocs != 0 || s.Mmaps != mmaps-1 || s.Frees != s.Mallocs || s.BytesFreed != s.BytesAllocated {
+		t.Fatalf("%+v", s)
+	}
+
+	for i := 0; i < 3*pageAvail/1024; i++ {
+		if _, err := alloc.Malloc(1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := alloc.Malloc(100); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, mmaps-1; g != e {
+		t.Fatal(g, e)
+	}
+
+	c, _, err := alloc.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+	if err := alloc.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3*pageAvail/1024; i++ {
+		if _, err := c.Malloc(1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, e := c.Stats().Mmaps, mmaps-1; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestMark(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	alloc.TrackSizes = true
+	before, err := alloc.UintptrMalloc(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := alloc.Mark()
+	var p []uintptr
+	for _, size := range []int{10, 100, 1000, maxSlotSize + 1} {
+		q, err := alloc.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = append(p, q)
+	}
+	alloc.UintptrFree(p[0])
+	if p[2], err = alloc.UintptrRealloc(p[2], 2000); err != nil {
+		t.Fatal(err)
+	}
+
+	m2 := alloc.Mark()
+	b, err := alloc.UintptrMallocBatch(50, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.UintptrFreeBatch(b[:5]); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := alloc.Rollback(m2); n != 5 || err != nil {
+		t.Fatal(n, err)
+	}
+
+	if _, err := alloc.Rollback(m2); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if n, err := alloc.Rollback(m); n != 3 || err != nil {
+		t.Fatal(n, err)
+	}
+
+	if g, e := alloc.Stats().Allocs, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := alloc.Fragmentation().Requested, 10; g != e {
+		t.Fatal(g, e)
+	}
+
+	m = alloc.Mark()
+	q, _ := alloc.UintptrMalloc(10)
+	if err := alloc.Release(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if alloc.marked != nil {
+		t.Fatal("marks not dropped")
+	}
+
+	alloc.UintptrFree(q)
+	alloc.UintptrFree(before)
+}
+
+func TestSyncAllocator(t *testing.T) {
+	var alloc SyncAllocator
+	defer alloc.Close()
+
+	const (
+		goroutines = 8
+		rounds     = 20000
+	)
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			var live [][]byte
+			for i := 0; i < rounds; i++ {
+				size := 1 + (i*7+g*13)%300
+				if i%1000 == 0 {
+					size = maxSlotSize + 1
+				}
+				b, err := alloc.Malloc(size)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				for j := range b {
+					b[j] = byte(g)
+				}
+				live = append(live, b)
+				if len(live) > 50 {
+					v := live[0]
+					live = live[1:]
+					for _, c := range v {
+						if c != byte(g) {
+							errs <- fmt.Errorf("corrupted block")
+							return
+						}
+					}
+
+					if err := alloc.Free(v); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+			for _, v := range live {
+				if err := alloc.Free(v); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	s := alloc.Stats()
+	if s.Allocs != 0 || s.Mallocs != goroutines*rounds || s.BytesAllocated != s.BytesFreed {
+		t.Fatalf("%+v", s)
+	}
+
+	b, err := alloc.Calloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range b {
+		if v != 0 {
+			t.Fatal(v)
+		}
+	}
+	if b, err = alloc.Realloc(b, 1000); err != nil || len(b) != 1000 {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncAllocatorStriping(t *testing.T) {
+	var alloc SyncAllocator
+	defer alloc.Close()
+
+	// A held class lock must not block allocations of other size classes.
+	alloc.classes[4].Lock()
+	done := make(chan error)
+	go func() {
+		b, err := alloc.Malloc(1000)
+		if err == nil {
+			err = alloc.Free(b)
+		}
+		done <- err
+	}()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_, err := alloc.Malloc(16)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatal("not blocked", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	alloc.classes[4].Unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncAllocatorRelease(t *testing.T) {
+	var alloc SyncAllocator
+	defer alloc.Close()
+
+	var p []uintptr
+	for i := 0; i < 1020; i++ {
+		q, err := alloc.UintptrMalloc(4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = append(p, q)
+	}
+	if g, e := alloc.Stats().Mmaps, 4; g != e {
+		t.Fatal(g, e)
+	}
+
+	for _, q := range p {
+		if err := alloc.UintptrFree(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := alloc.Stats(); s.Mmaps != 0 || s.Bytes != 0 {
+		t.Fatalf("%+v", s)
+	}
+
+	// Pages are released while other goroutines allocate and free.
+	const goroutines = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for round := 0; round < 10; round++ {
+				var live [][]byte
+				for i := 0; i < 300; i++ {
+					b, err := alloc.Malloc(4000)
+					if err != nil {
+						errs <- err
+						return
+					}
+
+					b[0], b[len(b)-1] = byte(g), byte(i)
+					live = append(live, b)
+				}
+				for i, b := range live {
+					if b[0] != byte(g) || b[len(b)-1] != byte(i) {
+						errs <- fmt.Errorf("corrupted block")
+						return
+					}
+
+					if err := alloc.Free(b); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// Releasing is opportunistic, how many pages remain depends on the
+	// scheduling. A forced release keeps only the current page.
+	c := &alloc.classes[12]
+	c.Lock()
+	err := alloc.release(12)
+	c.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := alloc.Stats(); s.Allocs != 0 || s.Mmaps > 1 {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestNewSyncAllocator(t *testing.T) {
+	e := errors.New("injected")
+	alloc := NewSyncAllocator(Options{NoPanic: true, MaxAlloc: 1 << 20, ZeroOnFree: true, MmapFault: FailNthMmap(1, e)})
+	defer alloc.Close()
+
+	if _, err := alloc.UintptrMalloc(-1); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.UintptrRealloc(0, -1); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.UintptrMalloc(1<<20 + 1); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.UintptrMalloc(16); !errors.Is(err, e) {
+		t.Fatal(err)
+	}
+
+	if g := alloc.Stats().MmapFailures; g != 1 {
+		t.Fatal(g)
+	}
+
+	p, err := alloc.UintptrMalloc(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the page of p mapped.
+	q, err := alloc.UintptrMalloc(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := unsafe.Slice((*byte)(unsafe.Pointer(p)), 16)
+	for i := range b {
+		b[i] = 0xa5
+	}
+	if err := alloc.UintptrFree(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// The link word of the free slot is not wiped.
+	for i, v := range b[unsafe.Sizeof(uintptr(0)):] {
+		if v != 0 {
+			t.Fatalf("%d: %#x", i, v)
+		}
+	}
+
+	if err := alloc.UintptrFree(q); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !alloc.alloc.NoPanic || alloc.alloc.MaxAlloc != 1<<20 {
+		t.Fatal("options lost by Close")
+	}
+}
+
+func TestSyncAllocatorSpill(t *testing.T) {
+	var alloc SyncAllocator
+	defer alloc.Close()
+
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		// A slot above 2^48, eg. with 5-level paging, does not fit
+		// an lfstack head.
+		var s lfstack
+		if s.push(uintptr(1)<<(6*unsafe.Sizeof(uintptr(0))) | 1<<4) {
+			t.Fatal("pushed")
+		}
+	}
+
+	p, err := alloc.UintptrMalloc(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Such slots are kept on the spill list of the class.
+	c := &alloc.classes[4]
+	c.spill = append(c.spill, p)
+	c.nfree.Add(1)
+	alloc.frees++
+	alloc.freed += 16
+	q, err := alloc.UintptrMalloc(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q != p {
+		t.Fatalf("%#x %#x", q, p)
+	}
+
+	if err := alloc.UintptrFree(q); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := alloc.Stats(); s.Allocs != 0 {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestStatsConcurrent(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	done := make(chan struct{})
+	var polls int
+	go func() {
+		defer close(done)
+
+		for alloc.Stats().Mallocs < 10000 {
+			polls++
+			runtime.Gosched()
+		}
+	}()
+	for i := 0; i < 10000; i++ {
+		p, err := alloc.UintptrMalloc(1 + i%5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := alloc.UintptrFree(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	t.Log(polls)
+}
+
+func TestTrim(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	size := 8 * osPageSize
+	var p []uintptr
+	for i := 0; i < 8; i++ {
+		q, err := alloc.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b := unsafe.Slice((*byte)(unsafe.Pointer(q)), size)
+		for j := range b {
+			b[j] = 0xff
+		}
+		p = append(p, q)
+	}
+	for _, q := range p[:4] {
+		alloc.UintptrFree(q)
+	}
+	n, err := alloc.Trim()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log(n)
+	if runtime.GOOS == "linux" {
+		if n != 4*(size-osPageSize) {
+			t.Fatal(n)
+		}
+
+		// The purged parts of the slots read as zeroes.
+		for _, q := range p[:4] {
+			b := unsafe.Slice((*byte)(unsafe.Pointer(q)), size)
+			for j, v := range b[osPageSize:] {
+				if v != 0 {
+					t.Fatal(j, v)
+				}
+			}
+		}
+	}
+
+	// Purged slots must still be usable.
+	for range p[:4] {
+		q, err := alloc.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b := unsafe.Slice((*byte)(unsafe.Pointer(q)), size)
+		for j := range b {
+			b[j] = 1
+		}
+		alloc.UintptrFree(q)
+	}
+
+	alloc.Reset()
+	mmaps := alloc.Stats().Mmaps
+	alloc.Pressure = func() bool { return false }
+	if ok, err := alloc.MaybeTrim(); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	alloc.Pressure = func() bool { return true }
+	if ok, err := alloc.MaybeTrim(); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	if g := alloc.Stats().Mmaps; g >= mmaps {
+		t.Fatal(g, mmaps)
+	}
+}
+
+func TestParsePSI(t *testing.T) {
+	v, err := parsePSI("some avg10=12.50 avg60=1.00 avg300=0.00 total=123\nfull avg10=3.00 avg60=0.00 avg300=0.00 total=0\n")
+	if err != nil || v != 12.5 {
+		t.Fatal(v, err)
+	}
+
+	if _, err := parsePSI("foo"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if p, err := MemoryPressure(); err == nil {
+		t.Log(p)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	alloc.Limit = 3 * pageSize
+	var p []uintptr
+	for {
+		q, err := alloc.UintptrMalloc(1000)
+		if err != nil {
+			if !errors.Is(err, ErrLimit) {
+				t.Fatal(err)
+			}
+
+			break
+		}
+
+		p = append(p, q)
+	}
+	if g := alloc.Stats().Bytes; g > alloc.Limit || len(p) == 0 {
+		t.Fatal(g, len(p))
+	}
+
+	// Empty pages retained by Reset are released when the limit is near.
+	alloc.Reset()
+	if _, err := alloc.Malloc(100); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	for _, v := range []struct {
+		s string
+		n int
+	}{
+		{"max\n", 0},
+		{"1073741824\n", 1 << 30},
+		{"9223372036854771712\n", 0},
+	} {
+		if n, err := parseCgroupLimit(v.s); err != nil || n != v.n {
+			t.Fatal(v.s, n, err)
+		}
+	}
+	if _, err := parseCgroupLimit("foo"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	t.Log(CgroupLimit())
+	t.Log(GoMemLimit(), MemoryLimit(0.5))
+}
+
+func TestMmapRetry(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	errFault := errors.New("fault")
+	fails := 2
+	alloc.MmapFault = func(size, mapped int) error {
+		if fails > 0 {
+			fails--
+			return errFault
+		}
+
+		return nil
+	}
+	if _, err := alloc.Malloc(100); !errors.Is(err, errFault) || !errors.Is(err, ErrOOM) {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().MmapFailures, uint64(1); g != e || alloc.LastMmapError() != errFault {
+		t.Fatal(g, e, alloc.LastMmapError())
+	}
+
+	alloc.MmapRetry = RetryPolicy{Retries: 2, Backoff: time.Millisecond, Trim: true}
+	b, err := alloc.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().MmapFailures, uint64(2); g != e {
+		t.Fatal(g, e)
+	}
+
+	alloc.Free(b)
+}
+
+func TestMaxAlloc(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	alloc.MaxAlloc = 1000
+	b, err := alloc.Malloc(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.Realloc(b, 2000); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.Malloc(math.MaxInt); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	if _, err := alloc.MallocBatch(2000, 2); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	if s := alloc.Stats(); s.Mmaps != 1 || s.MmapFailures != 0 {
+		t.Fatalf("%+v", s)
+	}
+
+	alloc.Free(b)
+}
+
+func TestRandomize(t *testing.T) {
+	alloc := Allocator{Options: Options{Backend: &OSBackend{Randomize: true}}}
+	CheckLeaks(t, &alloc)
+	var p []uintptr
+	for i := 0; i < 16; i++ {
+		q, err := alloc.UintptrMalloc(maxSlotSize + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if q&uintptr(pageMask) != uintptr(headerSize) {
+			t.Fatalf("%#x", q)
+		}
+
+		*(*byte)(unsafe.Pointer(q)) = 1
+		p = append(p, q)
+	}
+	adjacent := 0
+	for i := 1; i < len(p); i++ {
+		if d := int(p[i] - p[i-1]); d == 2*pageSize || d == -2*pageSize {
+			adjacent++
+		}
+	}
+	if adjacent == len(p)-1 {
+		t.Fatal("layout not randomized")
+	}
+
+	for _, q := range p {
+		if err := alloc.UintptrFree(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	run := func() (r []uintptr) {
+		alloc := Allocator{Options: Options{Deterministic: true}}
+		defer alloc.Close()
+
+		var p []uintptr
+		for i := 0; i < 2000; i++ {
+			q, err := alloc.UintptrMalloc(1 + i*37%70000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p = append(p, q)
+			if i%3 == 0 {
+				alloc.UintptrFree(p[i/2])
+				p[i/2] = 0
+			}
+		}
+		alloc.Reset()
+		for i := 0; i < 2000; i++ {
+			q, err := alloc.UintptrMalloc(1 + i*53%5000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p = append(p, q)
+		}
+		if alloc.own == nil {
+			t.Skip("address space reservation not supported")
+		}
+
+		base := uintptr(roundup(int(alloc.own.Base()), pageSize))
+		for _, q := range p {
+			if q != 0 {
+				q -= base
+			}
+			r = append(r, q)
+		}
+		return r
+	}
+	a, b := run(), run()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("%v: %#x %#x", i, a[i], b[i])
+		}
+	}
+}
+
+func TestCallocFresh(t *testing.T) {
+	dirty := func(b []byte) {
+		for i := range b {
+			b[i] = 0xff
+		}
+	}
+	zeroed := func(b []byte) {
+		t.Helper()
+		for i, v := range b {
+			if v != 0 {
+				t.Fatalf("%#x: %#x", i, v)
+			}
+		}
+	}
+
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	for _, size := range []int{16, 1000, maxSlotSize + 1} {
+		b, err := alloc.Calloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zeroed(b)
+		dirty(b)
+		c, err := alloc.Calloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zeroed(c)
+		dirty(c)
+		if err := alloc.Free(b); err != nil {
+			t.Fatal(err)
+		}
+
+		if b, err = alloc.Calloc(size); err != nil {
+			t.Fatal(err)
+		}
+
+		zeroed(b)
+		dirty(b)
+	}
+	if err := alloc.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{16, 1000} {
+		for i := 0; i < 2; i++ {
+			b, err := alloc.Calloc(size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			zeroed(b)
+		}
+	}
+
+	var s SyncAllocator
+	defer s.Close()
+	for _, size := range []int{16, maxSlotSize + 1} {
+		b, err := s.Calloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zeroed(b)
+		dirty(b)
+		if err := s.Free(b); err != nil {
+			t.Fatal(err)
+		}
+
+		if b, err = s.Calloc(size); err != nil {
+			t.Fatal(err)
+		}
+
+		zeroed(b)
+		if err := s.Free(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Calloc of a reused shared slot or a reused dedicated page must clear what
+// the previous owner left there.
+func TestCallocReuse(t *testing.T) {
+	type allocator interface {
+		Calloc(int) ([]byte, error)
+		Free([]byte) error
+	}
+
+	test := func(t *testing.T, a allocator) {
+		for _, size := range []int{100, maxSlotSize + 1} {
+			b, err := a.Calloc(size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range b {
+				b[i] = 0xa5
+			}
+			p := &b[0]
+			if err := a.Free(b); err != nil {
+				t.Fatal(err)
+			}
+
+			if b, err = a.Calloc(size); err != nil {
+				t.Fatal(err)
+			}
+
+			if &b[0] != p {
+				t.Fatalf("size %v: memory not reused", size)
+			}
+
+			for i, v := range b {
+				if v != 0 {
+					t.Fatalf("size %v: %#x: %#x", size, i, v)
+				}
+			}
+			if err := a.Free(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("Allocator", func(t *testing.T) {
+		alloc := Allocator{Options: Options{LargeCache: 4 * pageSize}}
+		defer alloc.Close()
+
+		// Fill the page of the shared slots but one, so that the next
+		// Calloc takes its last fresh slot and the one after it reuses
+		// the slot.
+		for i := 0; i < alloc.cap[7]-1; i++ {
+			if _, err := alloc.Malloc(100); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		test(t, &alloc)
+	})
+	t.Run("SyncAllocator", func(t *testing.T) {
+		alloc := NewSyncAllocator(Options{LargeCache: 4 * pageSize})
+		defer alloc.Close()
+
+		test(t, alloc)
+	})
+}
+
+func TestLargeCache(t *testing.T) {
+	alloc := Allocator{Options: Options{LargeCache: 5 * pageSize}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	size := 2*pageSize - 100
+	b, err := alloc.Malloc(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range b {
+		b[i] = 0xff
+	}
+	p := &b[0]
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if alloc.Contains(uintptr(unsafe.Pointer(p))) {
+		t.Fatal("cached page reported as allocated")
+	}
+
+	if b, err = alloc.Calloc(size - 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if &b[0] != p {
+		t.Fatal("cached page not reused")
+	}
+
+	for i, v := range b {
+		if v != 0 {
+			t.Fatalf("%#x: %#x", i, v)
+		}
+	}
+
+	var c [][]byte
+	for i := 0; i < 4; i++ {
+		b, err := alloc.Malloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c = append(c, b)
+	}
+	c = append(c, b)
+	if err := alloc.FreeBatch(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	n, err := alloc.Trim()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := alloc.Stats(); n < 2*size || s.Mmaps != 0 || s.Bytes != 0 {
+		t.Fatal(n, s)
+	}
+
+	alloc.LargeCacheAge = time.Millisecond
+	if b, err = alloc.Malloc(size); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if b, err = alloc.Malloc(4 * pageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetainEmpty(t *testing.T) {
+	alloc := Allocator{Options: Options{RetainEmpty: -1}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	n := pageAvail / 1024
+	for i := 0; i < 10; i++ {
+		var p []uintptr
+		for j := 0; j <= n; j++ {
+			q, err := alloc.UintptrMalloc(1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p = append(p, q)
+		}
+		if g, e := alloc.Stats().Mmaps, 2; g != e {
+			t.Fatal(i, g, e)
+		}
+
+		if err := alloc.UintptrFree(p[n]); err != nil {
+			t.Fatal(err)
+		}
+
+		if g, e := alloc.Stats().Mmaps, 2; g != e {
+			t.Fatal(i, g, e)
+		}
+
+		if i%2 == 0 {
+			if err := alloc.UintptrFreeBatch(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			for _, q := range p[:n] {
+				if err := alloc.UintptrFree(q); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if g, e := alloc.Stats().Mmaps, 1; g != e {
+			t.Fatal(i, g, e)
+		}
+	}
+
+	alloc.RetainEmpty = time.Millisecond
+	p, err := alloc.UintptrMalloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.UintptrFree(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if p, err = alloc.UintptrMalloc(10000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.UintptrFree(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if n, err := alloc.Trim(); err != nil || n == 0 {
+		t.Fatal(n, err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, 0; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestPageTeardown(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	n := pageAvail / 16
+	p, err := alloc.UintptrMallocBatch(16, 3*n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Free every other slot of all pages, then the rest of the middle page.
+	for i := 0; i < len(p); i += 2 {
+		if err := alloc.UintptrFree(p[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, e := alloc.listLen(4), (len(p)+1)/2; g != e {
+		t.Fatal(g, e)
+	}
+
+	for i := n + 1; i < 2*n; i += 2 {
+		if err := alloc.UintptrFree(p[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, e := alloc.Stats().Mmaps, 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := alloc.listLen(4), (len(p)+1)/2-(n+1)/2; g != e {
+		t.Fatal(g, e)
+	}
+
+	for pg := alloc.lists[4]; pg != nil; pg = pg.next {
+		if pg.free == nil || pg.next != nil && pg.next.prev != pg {
+			t.Fatal("corrupted page list")
+		}
+	}
+	var q []uintptr
+	for i := 0; i < len(p); i++ {
+		if i%2 == 0 && (i < n || i >= 2*n) {
+			r, err := alloc.UintptrMalloc(16)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q = append(q, r)
+			continue
+		}
+
+		if i >= n && i < 2*n {
+			continue
+		}
+
+		q = append(q, p[i])
+	}
+	if g, e := alloc.Stats().Mmaps, 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.UintptrFreeBatch(q); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFreeListLocality(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	n := pageAvail / 16
+	p, err := alloc.UintptrMallocBatch(16, 2*n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := p[:3]
+	b := p[n]
+	for _, v := range append(a[:3:3], b) {
+		if err := alloc.UintptrFree(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The page being allocated from is preferred until it's full.
+	for i := 0; i < len(a); i++ {
+		q, err := alloc.UintptrMalloc(16)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if q&^uintptr(pageMask) != a[0]&^uintptr(pageMask) {
+			t.Fatalf("%v: %#x %#x", i, q, a[0])
+		}
+	}
+	q, err := alloc.UintptrMalloc(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q != b {
+		t.Fatalf("%#x %#x", q, b)
+	}
+
+	if err := alloc.UintptrFreeBatch(p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequestedSize(t *testing.T) {
+	alloc := Allocator{Options: Options{TrackSizes: true}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	b, err := alloc.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.RequestedSize(&b[0]), 100; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := alloc.UnsafeRequestedSize(unsafe.Pointer(&b[0])), 100; g != e {
+		t.Fatal(g, e)
+	}
+
+	for i := range b[:cap(b)] {
+		b[:cap(b)][i] = byte(i)
+	}
+	if b, err = alloc.Realloc(b, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.RequestedSize(&b[0]), 50; g != e {
+		t.Fatal(g, e)
+	}
+
+	if b, err = alloc.Realloc(b, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.RequestedSize(&b[0]), 1000; g != e {
+		t.Fatal(g, e)
+	}
+
+	for i, v := range b[:50] {
+		if v != byte(i) {
+			t.Fatal(i, v)
+		}
+	}
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var plain Allocator
+	defer plain.Close()
+	p, err := plain.UintptrMalloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := plain.UintptrRequestedSize(p), UintptrUsableSize(p); g != e {
+		t.Fatal(g, e)
+	}
+
+	plain.UintptrFree(p)
+}
+
+func TestAllocatorUsableSize(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	for _, size := range []int{1, 16, 17, 1000, maxSlotSize, maxSlotSize + 1} {
+		b, err := alloc.Malloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g := alloc.UsableSize(&b[0])
+		if e := UsableSize(&b[0]); g != e || g < size {
+			t.Fatal(size, g, e)
+		}
+
+		if e := alloc.UnsafeUsableSize(unsafe.Pointer(&b[0])); g != e {
+			t.Fatal(size, g, e)
+		}
+
+		if err := alloc.Free(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMallocCacheAligned(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	var b [][]byte
+	for _, size := range []int{1, 8, 16, 63, 64, 65, 1000, maxSlotSize, maxSlotSize + 1} {
+		for i := 0; i < 3; i++ {
+			c, err := alloc.MallocCacheAligned(size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := uintptr(unsafe.Pointer(&c[0]))
+			if len(c) != size || p%CacheLineSize != 0 || UsableSize(&c[0])%CacheLineSize != 0 {
+				t.Fatalf("size %v: %#x %v", size, p, UsableSize(&c[0]))
+			}
+
+			b = append(b, c)
+		}
+	}
+	if err := alloc.FreeBatch(b); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := alloc.MallocPerCPU(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := len(r), runtime.GOMAXPROCS(0); g != e {
+		t.Fatal(g, e)
+	}
+
+	lines := map[uintptr]bool{}
+	for _, v := range r {
+		p := uintptr(unsafe.Pointer(&v[0]))
+		if len(v) != 8 || p%CacheLineSize != 0 || lines[p] {
+			t.Fatalf("%#x", p)
+		}
+
+		lines[p] = true
+	}
+	if err := alloc.Free(r[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	small := Allocator{Options: Options{PageSize: 1000}}
+	big := Allocator{Options: Options{PageSize: 3 << 20}}
+	var def Allocator
+	for _, v := range []*Allocator{&small, &big, &def} {
+		CheckLeaks(t, v)
+		defer v.Close()
+	}
+
+	if g, e := small.pageSize(), minPageSize; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := big.pageSize(), 4<<20; g != e {
+		t.Fatal(g, e)
+	}
+
+	sizes := []int{1, 100, 20000, 40000, 1 << 20, 3 << 20}
+	var b [][]byte
+	for i := 0; i < 3; i++ {
+		for _, v := range []*Allocator{&small, &big, &def} {
+			for _, size := range sizes {
+				c, err := v.Malloc(size)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				p := uintptr(unsafe.Pointer(&c[0]))
+				if !v.Contains(p) {
+					t.Fatalf("%#x", p)
+				}
+
+				us := UsableSize(&c[0])
+				if us < size || us != v.UsableSize(&c[0]) || us != cap(c) {
+					t.Fatal(size, us, v.UsableSize(&c[0]), cap(c))
+				}
+
+				if pg := pageOf(p); uintptr(unsafe.Pointer(pg))%uintptr(v.pageSize()) != 0 {
+					t.Fatalf("%#x %p", p, pg)
+				}
+
+				b = append(b, c)
+			}
+		}
+	}
+	if g := small.Stats().Mmaps; g < 2 {
+		t.Fatal(g)
+	}
+
+	for i, c := range b {
+		v := []*Allocator{&small, &big, &def}[i/len(sizes)%3]
+		if err := v.Free(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g := indexed.Load(); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestPool(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	p := NewPool(&alloc, 2)
+	b, err := p.Get(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != 100 || cap(b) < 100 {
+		t.Fatal(len(b), cap(b))
+	}
+
+	q := &b[0]
+	if err := p.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err = p.Get(128); err != nil {
+		t.Fatal(err)
+	}
+
+	if &b[0] != q || len(b) != 128 {
+		t.Fatal("idle slice not reused")
+	}
+
+	var c [][]byte
+	for i := 0; i < 4; i++ {
+		d, err := p.Get(maxSlotSize + 1000*i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c = append(c, d)
+	}
+	c = append(c, b)
+	mallocs := alloc.Stats().Mallocs
+	for _, v := range c {
+		if err := p.Put(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, e := alloc.Stats().Allocs, 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	if b, err = p.Get(maxSlotSize + 500); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mallocs, mallocs; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := p.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				b, err := p.Get(16 + (i*j)%5000)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if err := p.Put(b); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpillBuffer(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	b := NewSpillBuffer(&alloc, 1000, t.TempDir())
+	defer b.Close()
+
+	rng, err := mathutil.NewFC32(0, math.MaxInt32, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []byte
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10; i++ {
+			p := make([]byte, rng.Next()%500)
+			for j := range p {
+				p[j] = byte(rng.Next())
+			}
+			if n, err := b.Write(p); n != len(p) || err != nil {
+				t.Fatal(n, err)
+			}
+
+			want = append(want, p...)
+		}
+		if !b.Spilled() || b.Len() != int64(len(want)) {
+			t.Fatal(b.Spilled(), b.Len(), len(want))
+		}
+
+		got, err := io.ReadAll(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Fatal(round, len(got), len(want))
+		}
+
+		if b.Spilled() || b.Len() != 0 {
+			t.Fatal(b.Spilled(), b.Len())
+		}
+
+		want = want[:0]
+	}
+	if _, err := b.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Spilled() {
+		t.Fatal("spilled")
+	}
+}
+
+func TestLifetimes(t *testing.T) {
+	alloc := Allocator{Options: Options{LifetimeSample: 2}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	var p []uintptr
+	for i := 0; i < 100; i++ {
+		q, err := alloc.UintptrMalloc(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = append(p, q)
+	}
+	if g, e := alloc.Lifetimes().Live, 50; g != e {
+		t.Fatal(g, e)
+	}
+
+	for _, q := range p[:50] {
+		if err := alloc.UintptrFree(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := alloc.UintptrFreeBatch(p[50:]); err != nil {
+		t.Fatal(err)
+	}
+
+	l := alloc.Lifetimes()
+	if l.Live != 0 {
+		t.Fatal(l.Live)
+	}
+
+	var n, long uint64
+	for i, v := range l.Counts {
+		n += v
+		if lo, _ := l.Bucket(i); lo >= 5*time.Millisecond {
+			long += v
+		}
+	}
+	if n != 50 || long != 25 {
+		t.Fatal(n, long)
+	}
+}
+
+func TestHeapProfile(t *testing.T) {
+	alloc := Allocator{Options: Options{ProfileRate: 4096, ProfileStacks: true}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	const n, size = 10000, 100
+	var p []uintptr
+	for i := 0; i < n; i++ {
+		q, err := alloc.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = append(p, q)
+	}
+	prof := alloc.HeapProfile()
+	total := 0
+	for _, v := range prof {
+		total += v.Bytes
+	}
+	if e := n * size; total < e*7/10 || total > e*13/10 {
+		t.Fatal(len(prof), total, e)
+	}
+
+	frames := runtime.CallersFrames(prof[0].Stack)
+	found := false
+	for {
+		f, more := frames.Next()
+		if strings.HasSuffix(f.Function, "TestHeapProfile") {
+			found = true
+		}
+		if !more {
+			break
+		}
+	}
+	if !found {
+		t.Fatal("caller not found in the stack")
+	}
+
+	if err := alloc.UintptrFreeBatch(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := len(alloc.HeapProfile()); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestRaceRecycle(t *testing.T) {
+	var alloc SyncAllocator
+	defer alloc.Close()
+
+	// Blocks written by one goroutine are freed there and reused by
+	// another one without any other synchronization. Built with -race,
+	// the allocator annotations order the accesses.
+	const n = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(c byte) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				b, err := alloc.Malloc(64)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				for k := range b {
+					b[k] = c
+				}
+				if err := alloc.Free(b); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(byte(i))
+	}
+	wg.Wait()
+	if g := alloc.Stats().Allocs; g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestSanitizerRecycle(t *testing.T) {
+	var alloc Allocator
+	defer alloc.Close()
+
+	// Built with -asan or -msan, freed slots are poisoned. The allocator
+	// must still be able to link, reuse, save and clone them.
+	var p []uintptr
+	for i := 0; i < 100; i++ {
+		q, err := alloc.UintptrMalloc(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = append(p, q)
+	}
+	for _, q := range p[:50] {
+		if err := alloc.UintptrFree(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := alloc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _, err := alloc.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	var r Allocator
+	defer r.Close()
+	if _, err := r.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range []*Allocator{&alloc, c, &r} {
+		for i := 0; i < 50; i++ {
+			b, err := a.Calloc(100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for j, v := range b {
+				if v != 0 {
+					t.Fatal(i, j, v)
+				}
+			}
+		}
+	}
+}
+
+func TestMemoryTagging(t *testing.T) {
+	alloc := Allocator{Options: Options{MemoryTagging: true, TrackSizes: true}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	p, err := alloc.UintptrMalloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !alloc.tagging() && untag(p) != p {
+		t.Fatalf("%#x", p)
+	}
+
+	if g, e := alloc.UintptrRequestedSize(p), 100; g != e {
+		t.Fatal(g, e)
+	}
+
+	if !alloc.Contains(p) {
+		t.Fatal("allocation not contained")
+	}
+
+	b := unsafe.Slice((*byte)(unsafe.Pointer(p)), 100)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	if p, err = alloc.UintptrRealloc(p, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	b = unsafe.Slice((*byte)(unsafe.Pointer(p)), 1000)
+	for i := 0; i < 100; i++ {
+		if g, e := b[i], byte(i); g != e {
+			t.Fatal(i, g, e)
+		}
+	}
+
+	q, err := alloc.UintptrMallocBatch(50, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.UintptrFreeBatch(q); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.UintptrFree(p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZeroOnFree(t *testing.T) {
+	alloc := Allocator{Options: Options{ZeroOnFree: true, LargeCache: 1 << 30}}
+	defer alloc.Close()
+
+	for _, size := range []int{100, 10 * pageSize} {
+		b, err := alloc.Malloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range b {
+			b[i] = 0xff
+		}
+		b2, err := alloc.Malloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := alloc.Free(b); err != nil {
+			t.Fatal(err)
+		}
+
+		// The first word of a free slot links it.
+		for i, v := range b[8:] {
+			if v != 0 {
+				t.Fatal(size, i, v)
+			}
+		}
+
+		for i := range b2 {
+			b2[i] = 0xff
+		}
+		if err := alloc.Reset(); err != nil {
+			t.Fatal(err)
+		}
+
+		if size < pageSize {
+			for i, v := range b2 {
+				if v != 0 {
+					t.Fatal(size, i, v)
+				}
+			}
+		}
+	}
+}
+
+type scrubBackend struct {
+	OSBackend
+	dirty int
+}
+
+func (b *scrubBackend) Unmap(addr uintptr, size int) error {
+	for _, v := range unsafe.Slice((*byte)(unsafe.Pointer(addr+uintptr(headerSize))), size-headerSize) {
+		if v != 0 {
+			b.dirty++
+			break
+		}
+	}
+	return b.OSBackend.Unmap(addr, size)
+}
+
+func TestScrubOnClose(t *testing.T) {
+	for _, scrub := range []bool{false, true} {
+		be := &scrubBackend{}
+		alloc := Allocator{Options: Options{Backend: be, ScrubOnClose: scrub, LargeCache: 1 << 30}}
+		for _, size := range []int{100, 1000, 10 * pageSize, 20 * pageSize} {
+			b, err := alloc.Malloc(size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range b {
+				b[i] = 0xff
+			}
+		}
+		b, err := alloc.Malloc(30 * pageSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range b {
+			b[i] = 0xff
+		}
+		if err := alloc.Free(b); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := alloc.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if g, e := be.dirty == 0, scrub; g != e {
+			t.Fatal(scrub, be.dirty)
+		}
+	}
+}
+
+func TestDebugEnv(t *testing.T) {
+	if g, e := parseDebug("trace, canary,,junk,leaks"), debugCanary|debugJunk|debugLeaks|debugTrace; g != e {
+		t.Fatal(g, e)
+	}
+
+	defer func(f int) { debugFlags = f }(debugFlags)
+	debugFlags = debugCanary | debugJunk
+
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	b, err := alloc.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the page mapped after b is freed.
+	b2, err := alloc.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer alloc.Free(b2)
+	if g, e := cap(b), 100; g != e {
+		t.Fatal(g, e)
+	}
+
+	b = unsafe.Slice(&b[0], UsableSize(&b[0]))
+	for i, v := range b {
+		e := byte(junkAllocByte)
+		if i >= 100 {
+			e = canaryByte
+		}
+		if v != e {
+			t.Fatal(i, v, e)
+		}
+	}
+
+	b[100] = 0
+	if err := alloc.Free(b); !errors.Is(err, ErrCorrupted) {
+		t.Fatal(err)
+	}
+
+	b[100] = canaryByte
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first word of a free slot links it.
+	for i, v := range b[8:] {
+		if v != junkFreeByte {
+			t.Fatal(i, v)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	live := map[uintptr]int{}
+	var allocs, frees int
+	alloc := Allocator{Options: Options{
+		TrackSizes: true,
+		OnAlloc: func(p uintptr, size, class int) {
+			allocs++
+			live[p] = size
+			if class != 0 && 1<<class < size {
+				t.Errorf("%#x %v %v", p, size, class)
+			}
+		},
+		OnFree: func(p uintptr, size, class int) {
+			frees++
+			if g, e := size, live[p]; g != e {
+				t.Errorf("%#x %v %v", p, g, e)
+			}
+			delete(live, p)
+		},
+	}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	var p []uintptr
+	for _, size := range []int{1, 100, 1000, 10 * pageSize} {
+		q, err := alloc.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p = append(p, q)
+	}
+	q, err := alloc.UintptrMallocBatch(50, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p[0], err = alloc.UintptrRealloc(p[0], 500); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.UintptrFreeBatch(append(p, q...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if allocs != 15 || frees != 15 || len(live) != 0 {
+		t.Fatal(allocs, frees, live)
+	}
+}
+
+func TestOnOOM(t *testing.T) {
+	var held []uintptr
+	var calls int
+	alloc := Allocator{Options: Options{Limit: 3*pageSize + pageSize/2}}
+	alloc.OnOOM = func(size int) bool {
+		calls++
+		if len(held) == 0 {
+			return false
+		}
+
+		if err := alloc.UintptrFree(held[0]); err != nil {
+			t.Error(err)
+		}
+		held = held[1:]
+		return true
+	}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	for i := 0; i < 3; i++ {
+		p, err := alloc.UintptrMalloc(pageSize)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+
+		held = append(held, p)
+	}
+	if calls != 0 {
+		t.Fatal(calls)
+	}
+
+	p, err := alloc.UintptrMalloc(pageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 || len(held) != 2 {
+		t.Fatal(calls, len(held))
+	}
+
+	held = append(held, p)
+	if _, err := alloc.UintptrMalloc(10 * pageSize); !errors.Is(err, ErrLimit) {
+		t.Fatal(err)
+	}
+
+	if calls != 2 || len(held) != 2 {
+		t.Fatal(calls, len(held))
+	}
+
+	for _, p := range held {
+		if err := alloc.UintptrFree(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestQuota(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	alloc.SetQuota("cache", 1000)
+	var p []uintptr
+	for i := 0; i < 10; i++ {
+		q, err := alloc.UintptrMallocTag("cache", 100)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+
+		p = append(p, q)
+	}
+	if g, e := alloc.TagUsage("cache"), 1000; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := alloc.TagOf(p[0]), "cache"; g != e {
+		t.Fatal(g, e)
+	}
+
+	_, err := alloc.UintptrMallocTag("cache", 1)
+	var qe *QuotaError
+	if !errors.Is(err, ErrLimit) || !errors.As(err, &qe) || qe.Tag != "cache" || qe.Used != 1000 {
+		t.Fatal(err)
+	}
+
+	// Other tags and untagged allocations are not affected.
+	q, err := alloc.UintptrMallocTag("other", 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p = append(p, q)
+	if q, err = alloc.UintptrMalloc(10000); err != nil {
+		t.Fatal(err)
+	}
+
+	p = append(p, q)
+	if err := alloc.UintptrFree(p[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.TagUsage("cache"), 900; g != e {
+		t.Fatal(g, e)
+	}
+
+	if p[1], err = alloc.UintptrRealloc(p[1], 50); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.TagUsage("cache"), 850; g != e {
+		t.Fatal(g, e)
+	}
+
+	if p[1], err = alloc.UintptrRealloc(p[1], 120); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.TagUsage("cache"), 920; g != e || alloc.TagOf(p[1]) != "cache" {
+		t.Fatal(g, e)
+	}
+
+	// Growing a block near the quota counts only the growth.
+	if p[1], err = alloc.UintptrRealloc(p[1], 200); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.TagUsage("cache"), 1000; g != e {
+		t.Fatal(g, e)
+	}
+
+	// So is growing in place.
+	if _, err = alloc.UintptrRealloc(p[1], 201); !errors.Is(err, ErrLimit) {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.TagUsage("cache"), 1000; g != e || alloc.TagOf(p[1]) != "cache" {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.UintptrFreeBatch(p[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := alloc.TagUsage("cache") + alloc.TagUsage("other"); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestChild(t *testing.T) {
+	parent := Allocator{Options: Options{Limit: 8 * pageSize}}
+	defer parent.Close()
+
+	c1 := parent.NewChild()
+	c2 := parent.NewChild()
+	if _, err := c1.Malloc(2 * pageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c2.Malloc(2 * pageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := int(parent.childBytes.Load()), c1.Stats().Bytes+c2.Stats().Bytes; g != e || g == 0 {
+		t.Fatal(g, e)
+	}
+
+	// The children share the limit of the parent.
+	_, err := c1.Malloc(4 * pageSize)
+	if !errors.Is(err, ErrLimit) {
+		t.Fatal(err)
+	}
+
+	if err := c2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := parent.children[c2]; ok {
+		t.Fatal("closed child not detached")
+	}
+
+	if _, err := c1.Malloc(4 * pageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := parent.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := c1.Stats().Bytes + int(parent.childBytes.Load()); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestStatsTree(t *testing.T) {
+	var parent Allocator
+	defer parent.Close()
+
+	c1 := parent.NewChild()
+	c2 := parent.NewChild()
+	c3 := c2.NewChild()
+	if _, err := parent.Malloc(10); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c1.Malloc(10); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c3.Malloc(pageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	st := parent.StatsTree()
+	if g, e := st.Total.Allocs, 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := st.Total.Bytes, parent.Stats().Bytes+c1.Stats().Bytes+c3.Stats().Bytes; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := len(st.Children), 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	// c2 has no memory of its own, but its child does and it's larger than
+	// the memory of c1.
+	if c := st.Children[0]; c.Allocator != c2 || c.Own.Bytes != 0 || len(c.Children) != 1 || c.Children[0].Allocator != c3 {
+		t.Fatalf("%+v", c)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var alloc Allocator
+	defer alloc.Close()
+
+	prev := alloc.Snapshot()
+	for i := 0; i < 10; i++ {
+		if _, err := alloc.Malloc(100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := alloc.Snapshot()
+	s.Time = prev.Time.Add(2 * time.Second)
+	d := s.Sub(prev)
+	if g, e := d.Mallocs, uint64(10); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := d.Allocs, 10; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := d.Rate(d.Mallocs), 5.0; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := d.Stats.Add(prev.Stats), s.Stats; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	var alloc Allocator
+	defer alloc.Close()
+
+	rng, err := mathutil.NewFC32(0, math.MaxInt32, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a []uintptr
+	for i := 0; i < 1000; i++ {
+		if len(a) != 0 && rng.Next()%3 == 0 {
+			j := rng.Next() % len(a)
+			if err := alloc.UintptrFree(a[j]); err != nil {
+				t.Fatal(err)
+			}
+
+			a[j] = a[len(a)-1]
+			a = a[:len(a)-1]
+			continue
+		}
+
+		p, err := alloc.UintptrMalloc(1 + rng.Next()%(2*pageSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a = append(a, p)
+	}
+	if g, e := len(alloc.regs), int(alloc.mmaps.Load()); g != e {
+		t.Fatal(g, e)
+	}
+
+	for i, pg := range alloc.regs {
+		if pg.reg != i || !alloc.registered(pg) {
+			t.Fatal(i, pg.reg)
+		}
+	}
+	for _, p := range a {
+		if !alloc.Contains(p) {
+			t.Fatalf("%#x", p)
+		}
+	}
+}
+
+func TestOwner(t *testing.T) {
+	var a, b Allocator
+	defer a.Close()
+	defer b.Close()
+
+	p, err := a.UintptrMalloc(3 * pageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := b.UintptrMalloc(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []uintptr{p, p + uintptr(pageSize), p + uintptr(3*pageSize-1)} {
+		if !a.Contains(v) || b.Contains(v) {
+			t.Fatalf("%#x", v)
+		}
+	}
+
+	if a.Contains(q) || !b.Contains(q) {
+		t.Fatalf("%#x", q)
+	}
+
+	defer func(f int) { debugFlags = f }(debugFlags)
+	debugFlags = debugCanary
+
+	// An interior pointer of a large block and a pointer of another
+	// Allocator are rejected without reading page headers.
+	if err := a.UintptrFree(p + uintptr(pageSize)); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+
+	if err := a.UintptrFree(q); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+}
+
+func TestHeaderless(t *testing.T) {
+	alloc := Allocator{Options: Options{Headerless: true, TrackSizes: true}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	size := 2*pageSize + 1
+	b, err := alloc.Calloc(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := uintptr(unsafe.Pointer(&b[0]))
+	if p&uintptr(pageSize-1) != 0 {
+		t.Fatalf("%#x", p)
+	}
+
+	us := alloc.UsableSize(&b[0])
+	if us < size || us != roundup(size, osPageSize) {
+		t.Fatal(us, size)
+	}
+
+	b = b[:us]
+	for i := range b {
+		b[i] = byte(i)
+	}
+	if !alloc.Contains(p+uintptr(us-1)) || alloc.Contains(p+uintptr(us)) {
+		t.Fatal("Contains")
+	}
+
+	if err := alloc.DumpHeap(io.Discard, true); !errors.Is(err, ErrUnsupported) {
+		t.Fatal(err)
+	}
+
+	if b, err = alloc.Realloc(b, 2*size); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range b[:size] {
+		if v != byte(i) {
+			t.Fatal(i, v)
+		}
+	}
+
+	var dst Allocator
+	CheckLeaks(t, &dst)
+	if err := alloc.Transfer(&dst, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Allocs+dst.Stats().Allocs, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := dst.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Small allocations keep their headers.
+	s, err := alloc.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err = alloc.Malloc(size); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.FreeBatch([][]byte{s, b}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMallocPageAligned(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	var a [][]byte
+	for _, size := range []int{1, 512, osPageSize, osPageSize + 1, 3 * pageSize} {
+		b, err := alloc.MallocPageAligned(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p := uintptr(unsafe.Pointer(&b[0])); p&uintptr(osPageMask) != 0 || len(b) != size || cap(b)%osPageSize != 0 {
+			t.Fatalf("%#x %v %v", p, len(b), cap(b))
+		}
+
+		for i, v := range b[:cap(b)] {
+			if v != 0 {
+				t.Fatal(i, v)
+			}
+		}
+		a = append(a, b)
+	}
+	for _, b := range a {
+		if err := alloc.Free(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMallocIovec(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	sizes := []int{10, 0, 100, 1, 4096}
+	v, err := alloc.MallocIovec(sizes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Allocs, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := v.Len(), 4207; g != e {
+		t.Fatal(g, e)
+	}
+
+	for i, b := range v.Bufs {
+		if len(b) != sizes[i] || cap(b) != sizes[i] {
+			t.Fatal(i, len(b), cap(b))
+		}
+
+		if len(b) != 0 && uintptr(unsafe.Pointer(&b[0]))&(mallocAllign-1) != 0 {
+			t.Fatal(i)
+		}
+
+		for j := range b {
+			b[j] = byte(i)
+		}
+	}
+	for i, b := range v.Bufs {
+		for _, c := range b {
+			if c != byte(i) {
+				t.Fatal(i, c)
+			}
+		}
+	}
+	if err := v.Free(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Free(); err != nil || v.Bufs != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	var alloc, other Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+	defer other.Close()
+
+	var freed []uintptr
+	adopt := func(size int) uintptr {
+		p, err := other.UintptrMalloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := alloc.UintptrAdopt(p, size, func(p uintptr) {
+			freed = append(freed, p)
+			if err := other.UintptrFree(p); err != nil {
+				t.Error(err)
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		return p
+	}
+
+	p := adopt(100)
+	if err := alloc.UintptrAdopt(p, 100, nil); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+
+	if !alloc.Contains(p+99) || alloc.Contains(p+100) || alloc.UintptrUsableSize(p) != 100 {
+		t.Fatal(alloc.UintptrUsableSize(p))
+	}
+
+	if err := alloc.UintptrFree(p); err != nil || len(freed) != 1 || freed[0] != p {
+		t.Fatal(err, freed)
+	}
+
+	p = adopt(10)
+	*(*byte)(unsafe.Pointer(p + 9)) = 42
+	q, err := alloc.UintptrRealloc(p, 1000)
+	if err != nil || len(freed) != 2 || *(*byte)(unsafe.Pointer(q + 9)) != 42 {
+		t.Fatal(err, freed)
+	}
+
+	p = adopt(10)
+	if err := alloc.UintptrFreeBatch([]uintptr{p, q}); err != nil || len(freed) != 3 {
+		t.Fatal(err, freed)
+	}
+
+	adopt(10)
+	if _, _, err := alloc.Clone(); !errors.Is(err, ErrUnsupported) {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Close(); err != nil || len(freed) != 4 {
+		t.Fatal(err, freed)
+	}
+
+	if g := other.Stats().Allocs; g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestMemoryHighwater(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	if g := alloc.MemoryUsed(); g != 0 {
+		t.Fatal(g)
+	}
+
+	b, err := alloc.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := alloc.Malloc(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := alloc.MemoryUsed()
+	if g, e := used, alloc.UsableSize(&b[0])+alloc.UsableSize(&c[0]); g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.Free(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.MemoryHighwater(false), used; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := alloc.MemoryHighwater(true), used; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := alloc.MemoryHighwater(false), alloc.MemoryUsed(); g != e || g >= used {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := alloc.MemoryUsed(); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g := alloc.SoftHeapLimit(1 << 20); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g := alloc.SoftHeapLimit(-1); g != 1<<20 {
+		t.Fatal(g)
+	}
+}
+
+func TestSoftLimit(t *testing.T) {
+	alloc := Allocator{Options: Options{SoftLimit: 1, LargeCache: 1 << 30}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	b, err := alloc.Malloc(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	cached := alloc.Stats().Bytes
+	if cached == 0 {
+		t.Skip("block not cached")
+	}
+
+	// Exceeding the soft limit trims the cache but the request succeeds.
+	if b, err = alloc.Malloc(4 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Bytes, alloc.UsableSize(&b[0]); g > e+alloc.pageSize() {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrimmer(t *testing.T) {
+	alloc := Allocator{Options: Options{RetainEmpty: -1, LargeCache: 1 << 30}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	var mu sync.Mutex
+	tr := alloc.StartTrimmer(&mu, time.Millisecond, 20*time.Millisecond)
+	mu.Lock()
+	b, err := alloc.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := alloc.Malloc(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Free(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Mmaps, 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	mu.Unlock()
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		mu.Lock()
+		n := alloc.Stats().Mmaps
+		mu.Unlock()
+		if n == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal(n)
+		}
+	}
+
+	if err := tr.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrefault(t *testing.T) {
+	alloc := Allocator{Options: Options{Backend: &OSBackend{Prefault: true}}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	const size = 1 << 22
+	p, err := alloc.UintptrMalloc(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer alloc.UintptrFree(p)
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	b, err := os.ReadFile("/proc/self/smaps")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var in bool
+	for _, line := range strings.Split(string(b), "\n") {
+		var lo, hi uintptr
+		if n, _ := fmt.Sscanf(line, "%x-%x", &lo, &hi); n == 2 {
+			in = p >= lo && p < hi
+			continue
+		}
+
+		var rss int
+		if n, _ := fmt.Sscanf(line, "Rss: %d kB", &rss); in && n == 1 {
+			if rss < size>>10 {
+				t.Fatal(line)
+			}
+
+			return
+		}
+	}
+	t.Fatal("mapping not found")
+}
+
+func TestSparse(t *testing.T) {
+	size := 1 << 30
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		size <<= 10
+	}
+	s, err := NewSparse(size)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Skip(err) // Address space may be limited, eg. by ulimit -v.
+	}
+
+	defer s.Close()
+
+	if g, e := s.Size(), size; g != e {
+		t.Fatal(g, e)
+	}
+
+	b := s.Bytes()
+	for _, off := range []int{0, size / 3, size - 1} {
+		if err := s.Commit(off, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if b[off] != 0 {
+			t.Fatal(off)
+		}
+
+		b[off] = 42
+	}
+
+	off := size / 3
+	if err := s.Decommit(off, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Commit(off, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if b[off] != 0 || b[size-1] != 42 {
+		t.Fatal(b[off], b[size-1])
+	}
+
+	if err := s.Commit(size-1, 2); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCOWBackend(t *testing.T) {
+	b, err := NewCOWBackend()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer b.Close()
+
+	alloc := Allocator{Options: Options{Backend: b}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	p, err := alloc.UintptrMalloc(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := alloc.UintptrMalloc(3 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := func(v byte) {
+		*(*byte)(unsafe.Pointer(p)) = v
+		*(*byte)(unsafe.Pointer(q + 2<<20)) = v
+	}
+	check := func(v *HeapView, e byte) {
+		t.Helper()
+		if g := *(*byte)(unsafe.Pointer(v.Addr(p))); g != e {
+			t.Fatal(g, e)
+		}
+
+		if g := *(*byte)(unsafe.Pointer(v.Addr(q + 2<<20))); g != e {
+			t.Fatal(g, e)
+		}
+	}
+
+	set(1)
+	v1, err := b.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g := v1.Addr(42); g != 0 {
+		t.Fatal(g)
+	}
+
+	set(2)
+	check(v1, 1)
+	v2, err := b.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set(3)
+	check(v1, 1)
+	check(v2, 2)
+	if err := v1.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := *(*byte)(unsafe.Pointer(p)); g != 3 {
+		t.Fatal(g)
+	}
+
+	v3, err := b.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer v3.Close()
+
+	set(4)
+	check(v3, 3)
+	if err := alloc.UintptrFree(q); err != nil {
+		t.Fatal(err)
+	}
+
+	check(v3, 3)
+	if err := alloc.UintptrFree(p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStringBuilder(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	s := NewStringBuilder(&alloc)
+	var e strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(s, "%d,", i)
+		fmt.Fprintf(&e, "%d,", i)
+		s.WriteRune('ž')
+		e.WriteRune('ž')
+	}
+	if g, e := s.String(), e.String(); g != e {
+		t.Fatal(len(g), len(e))
+	}
+
+	p, err := s.CString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := GoString(p), e.String(); g != e {
+		t.Fatal(len(g), len(e))
+	}
+
+	if err := alloc.UintptrFree(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Len() != 0 || s.Cap() != 0 {
+		t.Fatal(s.Len(), s.Cap())
+	}
+
+	if p, err = s.CString(); err != nil || GoString(p) != "" {
+		t.Fatal(err)
+	}
+
+	if err := alloc.UintptrFree(p); err != nil {
+		t.Fatal(err)
+	}
+
+	s.WriteString("foo")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeque(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	if _, err := NewDeque[string](&alloc); err == nil {
+		t.Fatal("expected error")
+	}
+
+	d, err := NewDeque[int64](&alloc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer d.Close()
+
+	if _, ok := d.PopFront(); ok {
+		t.Fatal("expected empty")
+	}
+
+	// Mirror the deque by e[lo:hi].
+	const n = 100000
+	e := make([]int64, 2*n)
+	lo, hi := n, n
+	rng, err := mathutil.NewFC32(0, 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := int64(0); i < n; i++ {
+		switch rng.Next() {
+		case 0, 4:
+			if err := d.PushBack(i); err != nil {
+				t.Fatal(err)
+			}
+
+			e[hi] = i
+			hi++
+		case 1, 5:
+			if err := d.PushFront(i); err != nil {
+				t.Fatal(err)
+			}
+
+			lo--
+			e[lo] = i
+		case 2:
+			g, ok := d.PopFront()
+			if ok != (hi > lo) || ok && g != e[lo] {
+				t.Fatal(i, g, ok)
+			}
+
+			if ok {
+				lo++
+			}
+		case 3:
+			g, ok := d.PopBack()
+			if ok != (hi > lo) || ok && g != e[hi-1] {
+				t.Fatal(i, g, ok)
+			}
+
+			if ok {
+				hi--
+			}
+		}
+		if d.Len() != hi-lo {
+			t.Fatal(i, d.Len(), hi-lo)
+		}
+	}
+	for i, v := range e[lo:hi] {
+		if g := d.At(i); g != v {
+			t.Fatal(i, g, v)
+		}
+	}
+}
+
+func TestFixedPool(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	p, err := NewFixedPool(&alloc, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := p.BlockSize(), 48; g != e {
+		t.Fatal(g, e)
+	}
+
+	for round := 0; round < 3; round++ {
+		m := map[uintptr]struct{}{}
+		var a []uintptr
+		for i := 0; i < 100000; i++ {
+			b, err := p.UintptrMalloc()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := m[b]; ok || b%mallocAllign != 0 {
+				t.Fatalf("%v: %#x", i, b)
+			}
+
+			m[b] = struct{}{}
+			a = append(a, b)
+			*(*uintptr)(unsafe.Pointer(b + 40)) = b
+			if i%3 == 0 {
+				b = a[len(a)/2]
+				a = append(a[:len(a)/2], a[len(a)/2+1:]...)
+				delete(m, b)
+				p.UintptrFree(b)
+			}
+		}
+		for _, b := range a {
+			if g := *(*uintptr)(unsafe.Pointer(b + 40)); g != b {
+				t.Fatalf("%#x %#x", g, b)
+			}
+		}
+		if g, e := p.Len(), len(a); g != e {
+			t.Fatal(g, e)
+		}
+
+		if err := p.ReleaseAll(); err != nil {
+			t.Fatal(err)
+		}
+
+		if g := alloc.Stats().Allocs; g != 0 {
+			t.Fatal(g)
+		}
+	}
+}
+
+func TestRegionBackend(t *testing.T) {
+	var outer Allocator
+	defer outer.Close()
+
+	const size = 1 << 20
+	buf, err := outer.Malloc(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range buf {
+		buf[i] = 0xff
+	}
+	b, err := NewBufferBackend(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc := Allocator{Options: Options{Backend: b, PageSize: minPageSize}}
+	CheckLeaks(t, &alloc)
+	var p []uintptr
+	for {
+		q, err := alloc.UintptrCalloc(1000)
+		if errors.Is(err, ErrOOM) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !b.Contains(q) || !b.Contains(q+999) {
+			t.Fatalf("%#x", q)
+		}
+
+		for i := uintptr(0); i < 1000; i++ {
+			if *(*byte)(unsafe.Pointer(q + i)) != 0 {
+				t.Fatalf("%#x", q+i)
+			}
+		}
+		p = append(p, q)
+	}
+	if len(p) < size/minPageSize {
+		t.Fatal(len(p))
+	}
+
+	if err := alloc.UintptrFreeBatch(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := outer.Free(buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStack(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	s := NewStack(&alloc)
+	defer s.Close()
+
+	rng, err := mathutil.NewFC32(1, 100000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for round := 0; round < 3; round++ {
+		var a [][]byte
+		for i := 0; i < 1000; i++ {
+			b, err := s.Push(rng.Next())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for j := range b {
+				b[j] = byte(i)
+			}
+			a = append(a, b)
+		}
+		for i := len(a) - 1; i >= 500; i-- {
+			if err := s.Pop(a[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		a = a[:500]
+		for i, b := range a {
+			for _, v := range b {
+				if v != byte(i) {
+					t.Fatal(i, v)
+				}
+			}
+		}
+		if debugFlags != 0 {
+			if err := s.Pop(a[0]); !errors.Is(err, ErrInvalidPointer) {
+				t.Fatal(err)
+			}
+		} else {
+			if err := s.Pop(a[1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Reset(); err != nil {
+			t.Fatal(err)
+		}
+
+		if g := alloc.Stats().Allocs; g != 1 {
+			t.Fatal(g)
+		}
+	}
+	if err := s.UintptrPop(42); !errors.Is(err, ErrInvalidPointer) {
+		t.Fatal(err)
+	}
+}
+
+func TestWithChild(t *testing.T) {
+	var parent Allocator
+	CheckLeaks(t, &parent)
+	defer parent.Close()
+
+	if a := FromContext(context.Background()); a != nil {
+		t.Fatal(a)
+	}
+
+	ctx, cancel := context.WithCancel(WithAllocator(context.Background(), &parent))
+	defer cancel()
+
+	if a := FromContext(ctx); a != &parent {
+		t.Fatal(a)
+	}
+
+	ctx2, c, release := WithChild(ctx, FromContext(ctx))
+	if a := FromContext(ctx2); a != c {
+		t.Fatal(a)
+	}
+
+	// The child is used while ctx is canceled, it is closed only by
+	// release.
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			b, err := c.Malloc(100 + i)
+			if err != nil {
+				done <- err
+				return
+			}
+
+			b[0] = 1
+			if i%2 == 0 {
+				if err := c.Free(b); err != nil {
+					done <- err
+					return
+				}
+			}
+		}
+		done <- nil
+	}()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if parent.childBytes.Load() == 0 {
+		t.Fatal("child memory not accounted")
+	}
+
+	release()
+	release()
+	if g := parent.childBytes.Load(); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestMallocAligned(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	var p []uintptr
+	for i := 0; i < 1000; i++ {
+		q, err := alloc.UintptrMallocAligned(256, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if q%256 != 0 {
+			t.Fatalf("%#x", q)
+		}
+
+		p = append(p, q)
+	}
+	if g, e := alloc.Stats().Mmaps, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.UintptrFreeBatch(p); err != nil {
+		t.Fatal(err)
+	}
+
+	for align := 1; align <= 4*pageSize; align <<= 1 {
+		for _, size := range []int{1, 64, 100, 4000, alloc.maxSlot(), alloc.maxSlot() + 1, 3 * pageSize} {
+			b, err := alloc.MallocAligned(align, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if q := uintptr(unsafe.Pointer(&b[0])); q%uintptr(align) != 0 || len(b) != size {
+				t.Fatalf("%v %v %#x %v", align, size, q, len(b))
+			}
+
+			b[0], b[size-1] = 1, 1
+			if err := alloc.Free(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, err := alloc.UintptrMallocAligned(2*pageSize, maxMalloc); !errors.Is(err, ErrOOM) {
+		t.Fatal(err)
+	}
+}
+
+func TestReallocShrink(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	const size = 1 << 24
+	b, err := alloc.Malloc(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range b {
+		b[i] = byte(i)
+	}
+	bytes := alloc.Stats().Bytes
+	c, err := alloc.Realloc(b, size/4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if &c[0] != &b[0] {
+		t.Fatal("moved")
+	}
+
+	switch runtime.GOOS {
+	case "aix", "js", "plan9", "solaris", "wasip1":
+		// Not supported.
+	default:
+		if g, e := alloc.Stats().Bytes, bytes-3*size/4; g != e {
+			t.Fatal(g, e)
+		}
+
+		if g, e := UintptrUsableSize(uintptr(unsafe.Pointer(&c[0]))), size/4; g < e || g >= size/2 {
+			t.Fatal(g, e)
+		}
+	}
+	for i, v := range c {
+		if v != byte(i) {
+			t.Fatal(i, v)
+		}
+	}
+
+	// Shrinking by less than a half keeps the mapping.
+	bytes = alloc.Stats().Bytes
+	if c, err = alloc.Realloc(c, size/6); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Bytes, bytes; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := alloc.Free(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// With ZeroOnFree the released tail is zeroed first.
+	for _, zero := range []bool{false, true} {
+		a := Allocator{Options: Options{ZeroOnFree: zero}}
+		b, err := a.Malloc(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range b {
+			b[i] = 0xff
+		}
+		pg := a.pageOf(uintptr(unsafe.Pointer(&b[0])))
+		n, end := pg.size, int(uintptr(unsafe.Pointer(&b[0]))-uintptr(unsafe.Pointer(pg)))+size
+		alias, err := mapAlias(uintptr(unsafe.Pointer(pg)), n)
+		if err != nil && !errors.Is(err, ErrUnsupported) {
+			t.Fatal(err)
+		}
+
+		if c, err = a.Realloc(b, size/4); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, v := range c {
+			if v != 0xff {
+				t.Fatal(zero, i, v)
+			}
+		}
+
+		if alias != 0 {
+			e := byte(0xff)
+			if zero {
+				e = 0
+			}
+			for i, v := range unsafe.Slice((*byte)(unsafe.Pointer(alias)), n)[n/2 : end] {
+				if v != e {
+					t.Fatal(zero, i, v)
+				}
+			}
+			if err := unmap(alias, n); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := a.Free(c); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReallocPolicy(t *testing.T) {
+	alloc := Allocator{Options: Options{ReallocShrink: 4}}
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	b, err := alloc.Malloc(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range b {
+		b[i] = byte(i)
+	}
+	// 300 > 1024/4, the block stays.
+	c, err := alloc.Realloc(b, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if &c[0] != &b[0] {
+		t.Fatal("moved")
+	}
+
+	if b, err = alloc.Realloc(c, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	if &c[0] == &b[0] || UsableSize(&b[0]) != 256 {
+		t.Fatal(UsableSize(&b[0]))
+	}
+
+	for i, v := range b {
+		if v != byte(i) {
+			t.Fatal(i, v)
+		}
+	}
+
+	// Blocks staying above the largest size class are not moved.
+	if b, err = alloc.Realloc(b, 4*alloc.maxSlot()); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err = alloc.Realloc(b, alloc.maxSlot()+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if &c[0] != &b[0] {
+		t.Fatal("moved")
+	}
+
+	if err := alloc.Free(c); err != nil {
+		t.Fatal(err)
+	}
+
+	alloc.ReallocShrink, alloc.ReallocMove = 0, true
+	if b, err = alloc.Malloc(100); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range b {
+		b[i] = byte(i)
+	}
+	for _, size := range []int{100, 50, 10} {
+		if c, err = alloc.Realloc(b, size); err != nil {
+			t.Fatal(err)
+		}
+
+		if &c[0] == &b[0] {
+			t.Fatal("not moved")
+		}
+
+		for i, v := range c {
+			if v != byte(i) {
+				t.Fatal(i, v)
+			}
+		}
+		b = c
+	}
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+var errArenaFull = errors.New("memory: arena exhausted")
+
+// ArenaBackend is a Backend handing out mappings from a single contiguous
+// address range reserved up front. The memory of a mapping is committed by
+// Map and decommitted by Unmap, so an Allocator using an ArenaBackend grows
+// without creating new OS mappings and all its memory is within
+// [Base, Base+Size), which makes Contains a range comparison.
+//
+// ArenaBackend implements Committer. It is safe for concurrent use.
+type ArenaBackend struct {
+	base uintptr
+	size int
+	user bool // The range is memory of the caller, see NewRegionBackend.
+
+	mu      sync.Mutex
+	free    []span             // Free ranges ordered by address.
+	gens    map[uintptr]uint16 // Generations of freed addresses, see Handle.
+	handles atomic.Bool        // Handle was called, frees update gens.
+}
+
+type span struct {
+	addr uintptr
+	size int
+}
+
+// NewArenaBackend reserves size bytes, rounded up to the OS page size, of
+// address space. It returns an error wrapping ErrUnsupported on platforms
+// which can not reserve address space without committing it.
+func NewArenaBackend(size int) (*ArenaBackend, error) {
+	if size <= 0 || size > maxMalloc {
+		return nil, &Error{Op: "reserve", Size: size, Kind: ErrInvalidSize}
+	}
+
+	size = roundup(size, osPageSize)
+	p, err := reserve(size)
+	if err != nil {
+		return nil, &Error{Op: "reserve", Size: size, Kind: ErrOOM, Err: err}
+	}
+
+	return &ArenaBackend{base: p, size: size, free: []span{{p, size}}}, nil
+}
+
+// NewBufferBackend returns an ArenaBackend handing out mappings from b
+// instead of reserving address space, eg. for carving allocations out of a
+// mapped shared memory segment. See NewRegionBackend for details.
+func NewBufferBackend(b []byte) (*ArenaBackend, error) {
+	if len(b) == 0 {
+		return nil, &Error{Op: "reserve", Kind: ErrInvalidSize}
+	}
+
+	return NewRegionBackend(uintptr(unsafe.Pointer(&b[0])), len(b))
+}
+
+// NewRegionBackend returns an ArenaBackend handing out mappings from the size
+// bytes at p, memory provided by the caller, eg. a pre-mapped shared memory
+// segment or a part of the wasm linear memory. No memory is mapped by the
+// ArenaBackend. Map zeroes the memory it hands out, Commit zeroes the range
+// and Decommit and Close do nothing. The mappings are aligned to the page
+// size of the Allocator, see Options.PageSize, which the region must be able
+// to accommodate. The memory must stay valid until all Allocators using the
+// ArenaBackend are closed and must not hold Go pointers.
+func NewRegionBackend(p uintptr, size int) (*ArenaBackend, error) {
+	if size <= 0 || size > maxMalloc || p == 0 || p+uintptr(size) < p {
+		return nil, &Error{Op: "reserve", Addr: p, Size: size, Kind: ErrInvalidSize}
+	}
+
+	return &ArenaBackend{base: p, size: size, user: true, free: []span{{p, size}}}, nil
+}
+
+// Base returns the address of the reserved range.
+func (b *ArenaBackend) Base() uintptr { return b.base }
+
+// Size returns the size of the reserved range.
+func (b *ArenaBackend) Size() int { return b.size }
+
+// Contains reports whether p is within the reserved range.
+func (b *ArenaBackend) Contains(p uintptr) bool { return p-b.base < uintptr(b.size) }
+
+// Map implements Backend.
+func (b *ArenaBackend) Map(size, align int) (addr uintptr, n int, err error) {
+	if size <= 0 || size > b.size {
+		return 0, 0, errArenaFull
+	}
+
+	size = roundup(size, osPageSize)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, s := range b.free {
+		p := (s.addr + uintptr(align-1)) &^ uintptr(align-1)
+		if p < s.addr || p-s.addr > uintptr(s.size) || s.size-int(p-s.addr) < size {
+			continue
+		}
+
+		if err := b.commit(p, size); err != nil {
+			return 0, 0, err
+		}
+
+		var r []span
+		if p != s.addr {
+			r = append(r, span{s.addr, int(p - s.addr)})
+		}
+		if end := p + uintptr(size); end != s.addr+uintptr(s.size) {
+			r = append(r, span{end, int(s.addr + uintptr(s.size) - end)})
+		}
+		b.free = append(b.free[:i], append(r, b.free[i+1:]...)...)
+		return p, size, nil
+	}
+	return 0, 0, errArenaFull
+}
+
+// Unmap implements Backend.
+func (b *ArenaBackend) Unmap(addr uintptr, size int) error {
+	if !b.Contains(addr) || size <= 0 || size > b.size-int(addr-b.base) || addr&uintptr(osPageMask) != 0 || size&osPageMask != 0 {
+		return syscall.EINVAL
+	}
+
+	if !b.user {
+		if err := decommit(addr, size); err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i := 0
+	for i < len(b.free) && b.free[i].addr < addr {
+		i++
+	}
+	b.free = append(b.free, span{})
+	copy(b.free[i+1:], b.free[i:])
+	b.free[i] = span{addr, size}
+	if i+1 < len(b.free) && addr+uintptr(size) == b.free[i+1].addr {
+		b.free[i].size += b.free[i+1].size
+		b.free = append(b.free[:i+1], b.free[i+2:]...)
+	}
+	if i > 0 && b.free[i-1].addr+uintptr(b.free[i-1].size) == addr {
+		b.free[i-1].size += b.free[i].size
+		b.free = append(b.free[:i], b.free[i+1:]...)
+	}
+	return nil
+}
+
+// Commit implements Committer.
+func (b *ArenaBackend) Commit(addr uintptr, size int) error {
+	if !b.Contains(addr) || size > b.size-int(addr-b.base) {
+		return syscall.EINVAL
+	}
+
+	return b.commit(addr, size)
+}
+
+func (b *ArenaBackend) commit(addr uintptr, size int) error {
+	if b.user {
+		clear(unsafe.Slice((*byte)(unsafe.Pointer(addr)), size))
+		return nil
+	}
+
+	return commit(addr, size)
+}
+
+// Decommit implements Committer.
+func (b *ArenaBackend) Decommit(addr uintptr, size int) error {
+	if !b.Contains(addr) || size > b.size-int(addr-b.base) {
+		return syscall.EINVAL
+	}
+
+	if b.user {
+		return nil
+	}
+
+	return decommit(addr, size)
+}
+
+// Close releases the reserved range. All Allocators using b must have been
+// closed before.
+func (b *ArenaBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.size == 0 {
+		return nil
+	}
+
+	var err error
+	if !b.user {
+		err = release(b.base, b.size)
+	}
+	b.base, b.size, b.free, b.gens = 0, 0, nil, nil
+	return err
+}
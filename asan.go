@@ -0,0 +1,29 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build asan
+// +build asan
+
+package memory
+
+/*
+#include <sanitizer/asan_interface.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+const sanEnabled = true
+
+// sanPoison makes the size bytes at p inaccessible to the address sanitizer.
+func sanPoison(p uintptr, size int) {
+	C.__asan_poison_memory_region(unsafe.Pointer(p), C.size_t(size))
+}
+
+// sanUnpoison makes the size bytes at p accessible to the address sanitizer.
+func sanUnpoison(p uintptr, size int) {
+	C.__asan_unpoison_memory_region(unsafe.Pointer(p), C.size_t(size))
+}
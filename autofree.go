@@ -0,0 +1,118 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// orphans queues the memory of Auto values collected by the Go garbage
+// collector. Finalizers run on their own goroutine, so they only queue the
+// address. The owning Allocator frees it later, see Reclaim.
+type orphans struct {
+	n  int32 // len(p), accessed atomically.
+	mu sync.Mutex
+	p  []uintptr
+}
+
+func (q *orphans) push(p uintptr) {
+	q.mu.Lock()
+	q.p = append(q.p, p)
+	atomic.StoreInt32(&q.n, int32(len(q.p)))
+	q.mu.Unlock()
+}
+
+func (q *orphans) take() (r []uintptr) {
+	q.mu.Lock()
+	r, q.p = q.p, nil
+	atomic.StoreInt32(&q.n, 0)
+	q.mu.Unlock()
+	return r
+}
+
+// Auto is an allocation which is freed automatically if its owner forgets to
+// Free it. It is a safety net, not a replacement of Free: the memory is
+// reclaimed only after the Go garbage collector finds the Auto unreachable and
+// the Allocator is used again or Reclaim is called. Stats.Reclaimed counts how
+// many times the safety net fired.
+//
+// The memory returned by Bytes must not be used after the Auto becomes
+// unreachable, use runtime.KeepAlive where necessary.
+type Auto struct {
+	a *Allocator
+	b []byte
+}
+
+// CallocAuto is like MallocAuto except the allocated memory is zeroed.
+func (a *Allocator) CallocAuto(size int) (*Auto, error) {
+	b, err := a.Calloc(size)
+	return a.auto(b, err)
+}
+
+// MallocAuto is like Malloc except the memory is owned by the returned Auto.
+func (a *Allocator) MallocAuto(size int) (*Auto, error) {
+	b, err := a.Malloc(size)
+	return a.auto(b, err)
+}
+
+func (a *Allocator) auto(b []byte, err error) (*Auto, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Auto{a: a, b: b}
+	if b == nil {
+		return r, nil
+	}
+
+	if a.orphans == nil {
+		a.orphans = &orphans{}
+	}
+	q := a.orphans
+	runtime.SetFinalizer(r, func(r *Auto) { q.push(uintptr(unsafe.Pointer(&r.b[0]))) })
+	return r, nil
+}
+
+// Bytes returns the memory owned by r.
+func (r *Auto) Bytes() []byte { return r.b }
+
+// Free frees the memory owned by r. It's safe to call Free more than once.
+func (r *Auto) Free() error {
+	if r.b == nil {
+		return nil
+	}
+
+	runtime.SetFinalizer(r, nil)
+	b := r.b
+	r.b = nil
+	return r.a.Free(b)
+}
+
+// Reclaim frees the memory of all Auto values found unreachable by the Go
+// garbage collector so far and returns their number. It's called
+// automatically by the allocation and free methods of a.
+func (a *Allocator) Reclaim() (n int, err error) {
+	if a.orphans == nil {
+		return 0, nil
+	}
+
+	for _, p := range a.orphans.take() {
+		a.noteFree(p)
+		if e := a.free(p); e != nil && err == nil {
+			err = e
+		}
+		a.reclaimed.Add(1)
+		n++
+	}
+	return n, err
+}
+
+// orphaned reports whether Reclaim has anything to do.
+func (a *Allocator) orphaned() bool {
+	return a.orphans != nil && atomic.LoadInt32(&a.orphans.n) != 0
+}
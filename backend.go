@@ -0,0 +1,121 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"unsafe"
+)
+
+// Backend provides the memory an Allocator manages.
+type Backend interface {
+	// Map returns the address and size of a new mapping of at least size
+	// bytes. The address must be aligned to align, which is a power of
+	// two not smaller than the OS page size. The memory of the mapping
+	// must be readable, writable and zeroed.
+	Map(size, align int) (addr uintptr, n int, err error)
+
+	// Unmap releases a mapping. The arguments are the address and size
+	// returned by Map.
+	Unmap(addr uintptr, size int) error
+}
+
+// Committer is an optional interface of a Backend which can release the
+// physical memory of a part of a mapping while keeping its address range
+// reserved and vice versa. Both addr and size must be multiples of the OS
+// page size. The memory of a committed range is zeroed.
+type Committer interface {
+	Commit(addr uintptr, size int) error
+	Decommit(addr uintptr, size int) error
+}
+
+// Flags of mmap.
+const (
+	mmapConceal = 1 << iota // Exclude the mapping from core dumps.
+	mmapRandom              // Place the mapping at a random address.
+)
+
+// randomSlots is the number of aligned positions mmapRandom chooses from on
+// platforms where it over-reserves address space.
+const randomSlots = 64
+
+// OSBackend is the Backend used by an Allocator when Options.Backend is nil.
+// It maps anonymous memory using mmap or VirtualAlloc.
+type OSBackend struct {
+	// Conceal excludes the mappings from core dumps, for allocators
+	// holding sensitive data. It uses MAP_CONCEAL on OpenBSD, MAP_NOCORE
+	// on FreeBSD and DragonFly and madvise(MADV_DONTDUMP) on Linux. It's
+	// ignored on other platforms.
+	Conceal bool
+
+	// Randomize places the mappings at random addresses, making the heap
+	// layout less predictable, eg. for allocators holding data handled
+	// from untrusted inputs. On Windows it passes random address hints to
+	// VirtualAlloc, on Unix systems it places the mapping at one of 64
+	// random aligned positions within a larger reservation. It's ignored
+	// on other platforms.
+	Randomize bool
+
+	// Prefault faults in the physical memory of the mappings when they
+	// are created, so that latency critical code does not take page
+	// faults on the first access to a new page. It uses
+	// madvise(MADV_POPULATE_WRITE), the equivalent of MAP_POPULATE for an
+	// already aligned mapping, on Linux 5.14 and later and writes to
+	// every OS page elsewhere. Pages reused by the Allocator are not
+	// faulted in again.
+	Prefault bool
+}
+
+var defaultBackend Backend = &OSBackend{}
+
+// Map implements Backend.
+func (b *OSBackend) Map(size, align int) (addr uintptr, n int, err error) {
+	if addr, n, err = mmap(size, align, b.flags()); err == nil && b.Prefault {
+		prefault(addr, n)
+	}
+	return addr, n, err
+}
+
+// Unmap implements Backend.
+func (b *OSBackend) Unmap(addr uintptr, size int) error { return unmap(addr, size) }
+
+func (b *OSBackend) flags() (r int) {
+	if b.Conceal {
+		r |= mmapConceal
+	}
+	if b.Randomize {
+		r |= mmapRandom
+	}
+	return r
+}
+
+// touch writes to every OS page of the zeroed range, faulting it in.
+func touch(addr uintptr, size int) {
+	for p := addr; p < addr+uintptr(size); p += uintptr(osPageSize) {
+		*(*byte)(unsafe.Pointer(p)) = 0
+	}
+}
+
+func randomInt(n int) int {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	return int(binary.LittleEndian.Uint64(b[:]) % uint64(n))
+}
+
+func (a *Allocator) backend() Backend {
+	if a.Backend != nil {
+		return a.Backend
+	}
+
+	if a.Deterministic {
+		return a.ownBackend()
+	}
+
+	return defaultBackend
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+// mallocBare maps a block of size bytes without a page header, see
+// Options.Headerless. The block starts at the start of the mapping, which is
+// aligned to align.
+func (a *Allocator) mallocBare(size, align int) (uintptr, error) {
+	if err := a.checkLimit(size); err != nil {
+		return 0, err
+	}
+
+	p, n, err := a.mapRetry(size, align)
+	if err != nil {
+		return 0, &Error{Op: "mmap", Size: size, Kind: ErrOOM, Err: err}
+	}
+
+	if a.tagging() {
+		if err := mteProtect(p, n); err != nil {
+			a.backend().Unmap(p, n)
+			return 0, &Error{Op: "mmap", Size: size, Kind: ErrUnsupported, Err: err}
+		}
+	}
+
+	a.mmaps.Add(1)
+	a.bytes.Add(int64(n))
+	if a.bare == nil {
+		a.bare = map[uintptr]int{}
+	}
+	a.bare[p] = n
+	a.allocs.Add(1)
+	a.mallocs.Add(1)
+	a.allocated.Add(uint64(n))
+	return p, nil
+}
+
+// freeBare unmaps the headerless block p of n bytes.
+func (a *Allocator) freeBare(p uintptr, n int) error {
+	a.allocs.Add(-1)
+	a.frees.Add(1)
+	a.freed.Add(uint64(n))
+	return a.unmapBare(p, n)
+}
+
+// unmapBare releases the mapping of the headerless block p of n bytes.
+func (a *Allocator) unmapBare(p uintptr, n int) error {
+	delete(a.bare, p)
+	a.mmaps.Add(-1)
+	a.bytes.Add(-int64(n))
+	if sanEnabled {
+		sanUnpoison(p, n)
+	}
+	if a.ZeroOnFree {
+		a.wipeRange(p, n)
+	}
+	return a.backend().Unmap(p, n)
+}
+
+// usable returns the usable size of the block at p.
+func (a *Allocator) usable(p uintptr) int {
+	if a.bare != nil {
+		if n, ok := a.bare[untag(p)]; ok {
+			return n
+		}
+	}
+
+	return usableSizeOf(a.pageOf(p))
+}
+
+// class returns the size class of the block at p, zero for blocks with a
+// mapping of their own.
+func (a *Allocator) class(p uintptr) uint {
+	if a.bare != nil {
+		if _, ok := a.bare[untag(p)]; ok {
+			return 0
+		}
+	}
+
+	return a.pageOf(p).log
+}
+
+// inBare reports whether p points into a headerless block of a.
+func (a *Allocator) inBare(p uintptr) bool {
+	for b, n := range a.bare {
+		if p-b < uintptr(n) {
+			return true
+		}
+	}
+	return false
+}
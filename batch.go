@@ -0,0 +1,263 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sort"
+	"unsafe"
+
+	"github.com/cznic/mathutil"
+)
+
+// MallocBatch allocates n blocks of size bytes each. It is equivalent to n
+// calls of Malloc, but slots of shared pages are handed out in a single pass.
+// If any of the allocations fails, the blocks allocated so far are freed and
+// the error is returned.
+func (a *Allocator) MallocBatch(size, n int) (r [][]byte, err error) {
+	p, err := a.UintptrMallocBatch(size, n)
+	if err != nil {
+		return nil, err
+	}
+
+	r = make([][]byte, n)
+	if size == 0 {
+		return r, nil
+	}
+
+	for i, v := range p {
+		r[i] = a.slice(v, size)
+	}
+	return r, nil
+}
+
+// UintptrMallocBatch is like MallocBatch except it returns uintptrs.
+func (a *Allocator) UintptrMallocBatch(size, n int) (r []uintptr, err error) {
+	if size < 0 {
+		return nil, a.invalidSize("malloc", size)
+	}
+
+	if n < 0 {
+		return nil, a.invalidSize("malloc", n)
+	}
+
+	r = make([]uintptr, 0, n)
+	if size == 0 {
+		return r[:n], nil
+	}
+
+	if a.orphaned() {
+		if _, err := a.Reclaim(); err != nil {
+			return nil, err
+		}
+	}
+
+	if r, err = a.mallocBatch(size, n, r); err != nil && a.retryOOM(size, err) {
+		r, err = a.mallocBatch(size, n, r)
+	}
+	if err != nil {
+		for _, p := range r {
+			a.free(p)
+		}
+		return nil, err
+	}
+
+	for i, p := range r {
+		a.noteAlloc(p, size)
+		if a.tagging() {
+			r[i] = mteTag(p, a.usable(p))
+		}
+	}
+	return r, nil
+}
+
+// UnsafeMallocBatch is like MallocBatch except it returns unsafe.Pointers.
+func (a *Allocator) UnsafeMallocBatch(size, n int) (r []unsafe.Pointer, err error) {
+	p, err := a.UintptrMallocBatch(size, n)
+	if err != nil {
+		return nil, err
+	}
+
+	r = make([]unsafe.Pointer, n)
+	for i, v := range p {
+		r[i] = unsafe.Pointer(v)
+	}
+	return r, nil
+}
+
+func (a *Allocator) mallocBatch(size, n int, r []uintptr) ([]uintptr, error) {
+	if err := a.checkSize(size); err != nil {
+		return r, err
+	}
+
+	log := uint(mathutil.BitLen(roundup(size, mallocAllign) - 1))
+	if uint64(1)<<log > uint64(a.maxSlot()) {
+		for len(r) < n {
+			p, err := a.malloc(size)
+			if err != nil {
+				return r, err
+			}
+
+			r = append(r, p)
+		}
+		return r, nil
+	}
+
+	for len(r) < n {
+		if a.lists[log] == nil && a.pages[log] == nil {
+			if _, err := a.newSharedPage(log); err != nil {
+				return r, err
+			}
+		}
+
+		if p := a.pages[log]; p != nil {
+			k := mathutil.Min(n-len(r), a.cap[log]-p.brk)
+			base := uintptr(unsafe.Pointer(p)) + uintptr(slotBase(log))
+			for i := 0; i < k; i++ {
+				r = append(r, base+uintptr((p.brk+i)<<log))
+			}
+			p.brk += k
+			p.used += k
+			if p.brk == a.cap[log] {
+				a.pages[log] = nil
+			}
+			a.allocs.Add(int64(k))
+			a.mallocs.Add(uint64(k))
+			a.allocated.Add(uint64(k) << log)
+			continue
+		}
+
+		for len(r) < n && a.lists[log] != nil {
+			r = append(r, a.popFree(log))
+			a.allocs.Add(1)
+			a.mallocs.Add(1)
+			a.allocated.Add(1 << log)
+		}
+	}
+	return r, nil
+}
+
+// FreeBatch frees all blocks in b. It is equivalent to calling Free for every
+// element, but the blocks are sorted by page first, so that the free lists and
+// pages are updated once per page instead of once per block. All blocks are
+// checked before any of them is freed. Nil elements are ignored.
+func (a *Allocator) FreeBatch(b [][]byte) error {
+	p := make([]uintptr, 0, len(b))
+	for _, v := range b {
+		if cap(v) != 0 {
+			p = append(p, uintptr(unsafe.Pointer(&v[:1][0])))
+		}
+	}
+	return a.freeBatch(p)
+}
+
+// UintptrFreeBatch is like FreeBatch except its argument is a slice of
+// uintptrs.
+func (a *Allocator) UintptrFreeBatch(p []uintptr) error {
+	return a.freeBatch(append([]uintptr(nil), p...))
+}
+
+// UnsafeFreeBatch is like FreeBatch except its argument is a slice of
+// unsafe.Pointers.
+func (a *Allocator) UnsafeFreeBatch(p []unsafe.Pointer) error {
+	q := make([]uintptr, len(p))
+	for i, v := range p {
+		q[i] = uintptr(v)
+	}
+	return a.freeBatch(q)
+}
+
+// freeBatch frees the blocks in p, which it sorts in place.
+func (a *Allocator) freeBatch(p []uintptr) (err error) {
+	if a.orphaned() {
+		if _, err := a.Reclaim(); err != nil {
+			return err
+		}
+	}
+
+	for i, v := range p {
+		p[i] = untag(v)
+	}
+	sort.Slice(p, func(i, j int) bool { return p[i] < p[j] })
+	for len(p) != 0 && p[0] == 0 {
+		p = p[1:]
+	}
+	for i, v := range p {
+		if i != 0 && v == p[i-1] {
+			return &Error{Op: "free", Addr: v, Kind: ErrInvalidPointer}
+		}
+
+		if _, ok := a.adopted[v]; ok {
+			continue
+		}
+
+		if err := a.checkFree(v); err != nil {
+			return err
+		}
+
+		if debugFlags&debugCanary != 0 {
+			if err := a.checkCanary("free", v); err != nil {
+				return err
+			}
+		}
+	}
+	for len(p) != 0 {
+		if a.adopted != nil && a.freeAdopted(p[0]) {
+			p = p[1:]
+			continue
+		}
+
+		if _, ok := a.bare[p[0]]; ok {
+			a.noteFree(p[0])
+			if e := a.free(p[0]); e != nil && err == nil {
+				err = e
+			}
+			p = p[1:]
+			continue
+		}
+
+		pg := a.pageOf(p[0])
+		k := 1
+		for k < len(p) && a.pageOf(p[k]) == pg {
+			k++
+		}
+		if pg.log == 0 || k > pg.used {
+			// Dedicated page or more frees than used slots, let free
+			// handle it.
+			for _, v := range p[:k] {
+				a.noteFree(v)
+				if e := a.free(v); e != nil && err == nil {
+					err = e
+				}
+			}
+			p = p[k:]
+			continue
+		}
+
+		if e := a.freeSlots(pg, p[:k]); e != nil && err == nil {
+			err = e
+		}
+		p = p[k:]
+	}
+	return err
+}
+
+// freeSlots frees the sorted slots p of the shared page pg.
+func (a *Allocator) freeSlots(pg *page, p []uintptr) error {
+	log := pg.log
+	for _, v := range p {
+		a.noteFree(v)
+	}
+	a.allocs.Add(-int64(len(p)))
+	a.frees.Add(uint64(len(p)))
+	a.freed.Add(uint64(len(p)) << log)
+	if pg.used -= len(p); pg.used != 0 {
+		for _, v := range p {
+			a.pushFree(pg, v)
+		}
+		return nil
+	}
+
+	return a.releasePage(pg)
+}
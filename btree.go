@@ -0,0 +1,366 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+const (
+	btreeDegree  = 16 // Minimum degree, non root nodes have at least btreeDegree-1 keys.
+	btreeMaxKeys = 2*btreeDegree - 1
+)
+
+type btreeNode[K, V any] struct {
+	n    int
+	leaf bool
+	keys [btreeMaxKeys]K
+	vals [btreeMaxKeys]V
+	kids [btreeMaxKeys + 1]*btreeNode[K, V]
+}
+
+// BTree is an ordered map from K to V, a B-tree with nodes allocated from an
+// Allocator, for index structures living outside of the Go heap. Neither K
+// nor V may contain Go pointers, NewBTree rejects such types.
+//
+// A BTree must be released by Close.
+type BTree[K, V any] struct {
+	a    *Allocator
+	cmp  func(a, b K) int
+	len  int
+	root *btreeNode[K, V]
+}
+
+// NewBTree returns a BTree allocating from a and ordering the keys by cmp,
+// which returns a negative number, zero or a positive number when a is less
+// than, equal to or greater than b. If cmp is nil, the keys are ordered by
+// comparing their memory representations as byte strings, eg. the natural
+// order for byte arrays, and K must not contain padding or floating point
+// numbers.
+func NewBTree[K, V any](a *Allocator, cmp func(a, b K) int) (*BTree[K, V], error) {
+	kt := reflect.TypeOf((*K)(nil)).Elem()
+	if err := checkPointerFree(kt); err != nil {
+		return nil, err
+	}
+
+	if err := checkPointerFree(reflect.TypeOf((*V)(nil)).Elem()); err != nil {
+		return nil, err
+	}
+
+	if cmp == nil {
+		if !isHashable(kt) {
+			return nil, fmt.Errorf("memory: type %v contains padding or floating point numbers", kt)
+		}
+
+		cmp = func(a, b K) int {
+			return bytes.Compare(
+				unsafe.Slice((*byte)(unsafe.Pointer(&a)), unsafe.Sizeof(a)),
+				unsafe.Slice((*byte)(unsafe.Pointer(&b)), unsafe.Sizeof(b)),
+			)
+		}
+	}
+	return &BTree[K, V]{a: a, cmp: cmp}, nil
+}
+
+// Ascend calls f for all entries of t in key order until f returns false.
+func (t *BTree[K, V]) Ascend(f func(k K, v V) bool) { t.ascend(t.root, nil, f) }
+
+// AscendFrom calls f for the entries of t with keys greater than or equal to k
+// in key order until f returns false.
+func (t *BTree[K, V]) AscendFrom(k K, f func(k K, v V) bool) { t.ascend(t.root, &k, f) }
+
+// Close releases the memory of t and resets it to be empty.
+func (t *BTree[K, V]) Close() error {
+	err := t.freeNode(t.root)
+	t.root, t.len = nil, 0
+	return err
+}
+
+// Delete removes the entry of k, if any, and reports whether it was present.
+func (t *BTree[K, V]) Delete(k K) bool {
+	if t.root == nil {
+		return false
+	}
+
+	ok := t.delete(t.root, k)
+	if ok {
+		t.len--
+	}
+	if r := t.root; r.n == 0 {
+		t.root = nil
+		if !r.leaf {
+			t.root = r.kids[0]
+		}
+		t.a.UnsafeFree(unsafe.Pointer(r))
+	}
+	return ok
+}
+
+// Get returns the value of k and whether it was present.
+func (t *BTree[K, V]) Get(k K) (v V, ok bool) {
+	for x := t.root; x != nil; {
+		i, ok := t.find(x, k)
+		if ok {
+			return x.vals[i], true
+		}
+
+		if x.leaf {
+			break
+		}
+
+		x = x.kids[i]
+	}
+	return v, false
+}
+
+// Len returns the number of entries of t.
+func (t *BTree[K, V]) Len() int { return t.len }
+
+// Set sets the value of k to v.
+func (t *BTree[K, V]) Set(k K, v V) error {
+	if t.root == nil {
+		r, err := t.newNode(true)
+		if err != nil {
+			return err
+		}
+
+		t.root = r
+	}
+	if t.root.n == btreeMaxKeys {
+		s, err := t.newNode(false)
+		if err != nil {
+			return err
+		}
+
+		s.kids[0] = t.root
+		if err := t.split(s, 0); err != nil {
+			t.a.UnsafeFree(unsafe.Pointer(s))
+			return err
+		}
+
+		t.root = s
+	}
+	for x := t.root; ; {
+		i, ok := t.find(x, k)
+		if ok {
+			x.vals[i] = v
+			return nil
+		}
+
+		if x.leaf {
+			copy(x.keys[i+1:x.n+1], x.keys[i:x.n])
+			copy(x.vals[i+1:x.n+1], x.vals[i:x.n])
+			x.keys[i], x.vals[i] = k, v
+			x.n++
+			t.len++
+			return nil
+		}
+
+		if x.kids[i].n == btreeMaxKeys {
+			if err := t.split(x, i); err != nil {
+				return err
+			}
+
+			switch c := t.cmp(k, x.keys[i]); {
+			case c == 0:
+				x.vals[i] = v
+				return nil
+			case c > 0:
+				i++
+			}
+		}
+		x = x.kids[i]
+	}
+}
+
+func (t *BTree[K, V]) ascend(x *btreeNode[K, V], from *K, f func(k K, v V) bool) bool {
+	if x == nil {
+		return true
+	}
+
+	i := 0
+	if from != nil {
+		i, _ = t.find(x, *from)
+	}
+	for ; i < x.n; i++ {
+		if !x.leaf && !t.ascend(x.kids[i], from, f) {
+			return false
+		}
+
+		from = nil
+		if !f(x.keys[i], x.vals[i]) {
+			return false
+		}
+	}
+	if !x.leaf {
+		return t.ascend(x.kids[x.n], from, f)
+	}
+
+	return true
+}
+
+// delete removes k from the subtree rooted at x, which has at least
+// btreeDegree keys unless it's the root.
+func (t *BTree[K, V]) delete(x *btreeNode[K, V], k K) bool {
+	for {
+		i, ok := t.find(x, k)
+		if x.leaf {
+			if !ok {
+				return false
+			}
+
+			copy(x.keys[i:x.n-1], x.keys[i+1:x.n])
+			copy(x.vals[i:x.n-1], x.vals[i+1:x.n])
+			x.n--
+			return true
+		}
+
+		if ok {
+			switch y, z := x.kids[i], x.kids[i+1]; {
+			case y.n >= btreeDegree:
+				for y = x.kids[i]; !y.leaf; y = y.kids[y.n] {
+				}
+				x.keys[i], x.vals[i] = y.keys[y.n-1], y.vals[y.n-1]
+				k = x.keys[i]
+				x = x.kids[i]
+			case z.n >= btreeDegree:
+				for z = x.kids[i+1]; !z.leaf; z = z.kids[0] {
+				}
+				x.keys[i], x.vals[i] = z.keys[0], z.vals[0]
+				k = x.keys[i]
+				x = x.kids[i+1]
+			default:
+				t.merge(x, i)
+				x = y
+			}
+			continue
+		}
+
+		c := x.kids[i]
+		if c.n < btreeDegree {
+			switch {
+			case i > 0 && x.kids[i-1].n >= btreeDegree:
+				l := x.kids[i-1]
+				copy(c.keys[1:c.n+1], c.keys[:c.n])
+				copy(c.vals[1:c.n+1], c.vals[:c.n])
+				if !c.leaf {
+					copy(c.kids[1:c.n+2], c.kids[:c.n+1])
+					c.kids[0] = l.kids[l.n]
+				}
+				c.keys[0], c.vals[0] = x.keys[i-1], x.vals[i-1]
+				x.keys[i-1], x.vals[i-1] = l.keys[l.n-1], l.vals[l.n-1]
+				l.n--
+				c.n++
+			case i < x.n && x.kids[i+1].n >= btreeDegree:
+				r := x.kids[i+1]
+				c.keys[c.n], c.vals[c.n] = x.keys[i], x.vals[i]
+				if !c.leaf {
+					c.kids[c.n+1] = r.kids[0]
+					copy(r.kids[:r.n], r.kids[1:r.n+1])
+				}
+				c.n++
+				x.keys[i], x.vals[i] = r.keys[0], r.vals[0]
+				copy(r.keys[:r.n-1], r.keys[1:r.n])
+				copy(r.vals[:r.n-1], r.vals[1:r.n])
+				r.n--
+			case i < x.n:
+				t.merge(x, i)
+			default:
+				c = x.kids[i-1]
+				t.merge(x, i-1)
+			}
+		}
+		x = c
+	}
+}
+
+// find returns the index of the first key of x not less than k and whether
+// it's equal to k.
+func (t *BTree[K, V]) find(x *btreeNode[K, V], k K) (int, bool) {
+	lo, hi := 0, x.n
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if t.cmp(x.keys[m], k) < 0 {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	return lo, lo < x.n && t.cmp(x.keys[lo], k) == 0
+}
+
+func (t *BTree[K, V]) freeNode(x *btreeNode[K, V]) (err error) {
+	if x == nil {
+		return nil
+	}
+
+	if !x.leaf {
+		for _, c := range x.kids[:x.n+1] {
+			if e := t.freeNode(c); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	if e := t.a.UnsafeFree(unsafe.Pointer(x)); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// merge merges the key i of x and its right child into the left child. Both
+// children have btreeDegree-1 keys.
+func (t *BTree[K, V]) merge(x *btreeNode[K, V], i int) {
+	y, z := x.kids[i], x.kids[i+1]
+	y.keys[y.n], y.vals[y.n] = x.keys[i], x.vals[i]
+	copy(y.keys[y.n+1:], z.keys[:z.n])
+	copy(y.vals[y.n+1:], z.vals[:z.n])
+	if !y.leaf {
+		copy(y.kids[y.n+1:], z.kids[:z.n+1])
+	}
+	y.n += z.n + 1
+	copy(x.keys[i:x.n-1], x.keys[i+1:x.n])
+	copy(x.vals[i:x.n-1], x.vals[i+1:x.n])
+	copy(x.kids[i+1:x.n], x.kids[i+2:x.n+1])
+	x.n--
+	t.a.UnsafeFree(unsafe.Pointer(z))
+}
+
+func (t *BTree[K, V]) newNode(leaf bool) (*btreeNode[K, V], error) {
+	p, err := t.a.UnsafeCalloc(int(unsafe.Sizeof(btreeNode[K, V]{})))
+	if err != nil {
+		return nil, err
+	}
+
+	x := (*btreeNode[K, V])(p)
+	x.leaf = leaf
+	return x, nil
+}
+
+// split splits the full child i of x, which is not full.
+func (t *BTree[K, V]) split(x *btreeNode[K, V], i int) error {
+	y := x.kids[i]
+	z, err := t.newNode(y.leaf)
+	if err != nil {
+		return err
+	}
+
+	z.n = btreeDegree - 1
+	copy(z.keys[:], y.keys[btreeDegree:])
+	copy(z.vals[:], y.vals[btreeDegree:])
+	if !y.leaf {
+		copy(z.kids[:], y.kids[btreeDegree:])
+	}
+	y.n = btreeDegree - 1
+	copy(x.kids[i+2:x.n+2], x.kids[i+1:x.n+1])
+	x.kids[i+1] = z
+	copy(x.keys[i+1:x.n+1], x.keys[i:x.n])
+	copy(x.vals[i+1:x.n+1], x.vals[i:x.n])
+	x.keys[i], x.vals[i] = y.keys[btreeDegree-1], y.vals[btreeDegree-1]
+	x.n++
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Cgroup memory limit files, v2 and v1.
+var cgroupLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// CgroupLimit returns the memory limit of the cgroup of the process in bytes.
+// It returns zero if the cgroup is not limited. It returns an error wrapping
+// ErrUnsupported on platforms other than Linux or if the limit cannot be
+// determined.
+func CgroupLimit() (int, error) {
+	if runtime.GOOS != "linux" {
+		return 0, &Error{Op: "cgroup", Kind: ErrUnsupported}
+	}
+
+	var err error
+	for _, fn := range cgroupLimitFiles {
+		var b []byte
+		if b, err = os.ReadFile(fn); err == nil {
+			return parseCgroupLimit(string(b))
+		}
+	}
+	return 0, &Error{Op: "cgroup", Kind: ErrUnsupported, Err: err}
+}
+
+func parseCgroupLimit(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "max" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case n >= math.MaxInt64&^(1<<12-1): // cgroup v1 reports no limit as a huge number.
+		return 0, nil
+	case n > math.MaxInt:
+		return math.MaxInt, nil
+	}
+
+	return int(n), nil
+}
+
+// GoMemLimit returns the soft memory limit of the Go runtime, set by
+// GOMEMLIMIT or debug.SetMemoryLimit, or zero if there's none.
+func GoMemLimit() int {
+	n := debug.SetMemoryLimit(-1)
+	if n == math.MaxInt64 || n > math.MaxInt {
+		return 0
+	}
+
+	return int(n)
+}
+
+// MemoryLimit returns fraction of the smaller of CgroupLimit and GoMemLimit,
+// suitable for Options.Limit. It returns zero, ie. no limit, if neither is
+// set. Memory of an Allocator is invisible to the accounting of the Go runtime,
+// the fraction should leave room for the Go heap.
+func MemoryLimit(fraction float64) int {
+	n := GoMemLimit()
+	if m, err := CgroupLimit(); err == nil && m != 0 && (n == 0 || m < n) {
+		n = m
+	}
+	return int(float64(n) * fraction)
+}
+
+// checkLimit reports an error wrapping ErrLimit if mapping size more bytes
+// would exceed a.Limit, which covers also the memory of the children of a.
+// Near the limit, or above a.SoftLimit, it first tries to release memory
+// using Trim.
+func (a *Allocator) checkLimit(size int) error {
+	if a.Limit <= 0 && a.SoftLimit <= 0 {
+		return nil
+	}
+
+	n := int(a.bytes.Load()+a.childBytes.Load()) + size
+	if a.SoftLimit > 0 && n > a.SoftLimit || a.Limit > 0 && n > a.Limit-a.Limit/8 {
+		a.Trim()
+		n = int(a.bytes.Load()+a.childBytes.Load()) + size
+	}
+	if a.Limit > 0 && n > a.Limit {
+		return &Error{Op: "mmap", Size: size, Kind: ErrLimit}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"io"
+)
+
+// Buffer is a variable sized buffer of bytes with Read and Write methods,
+// like bytes.Buffer, except its contents live in memory of an Allocator, so
+// large buffers do not add to the Go heap. The buffer grows by Realloc.
+//
+// A Buffer must be released by Close.
+type Buffer struct {
+	a   *Allocator
+	buf []byte // Contents are buf[off:].
+	off int    // Read position.
+}
+
+// NewBuffer returns a Buffer allocating from a.
+func NewBuffer(a *Allocator) *Buffer { return &Buffer{a: a} }
+
+// Bytes returns the unread portion of the buffer. The slice is valid only
+// until the next modification of the buffer.
+func (b *Buffer) Bytes() []byte { return b.buf[b.off:] }
+
+// Cap returns the capacity of the buffer.
+func (b *Buffer) Cap() int { return cap(b.buf) }
+
+// Close releases the memory of the buffer and resets it to be empty.
+func (b *Buffer) Close() error {
+	err := b.a.Free(b.buf)
+	b.buf, b.off = nil, 0
+	return err
+}
+
+// Grow grows the capacity of the buffer, if necessary, to guarantee space for
+// another n bytes.
+func (b *Buffer) Grow(n int) error {
+	if n < 0 {
+		return b.a.invalidSize("grow", n)
+	}
+
+	if cap(b.buf)-len(b.buf) >= n {
+		return nil
+	}
+
+	if b.off != 0 { // Reclaim the space already read.
+		m := copy(b.buf, b.buf[b.off:])
+		b.buf, b.off = b.buf[:m], 0
+		if cap(b.buf)-len(b.buf) >= n {
+			return nil
+		}
+	}
+
+	if n > maxMalloc-2*cap(b.buf) {
+		return &Error{Op: "grow", Size: n, Kind: ErrOOM}
+	}
+
+	c := 2*cap(b.buf) + n
+	if c < 64 {
+		c = 64
+	}
+	r, err := b.a.Realloc(b.buf, c)
+	if err != nil {
+		return err
+	}
+
+	b.buf = r[:len(b.buf):cap(r)]
+	return nil
+}
+
+// Len returns the number of unread bytes of the buffer.
+func (b *Buffer) Len() int { return len(b.buf) - b.off }
+
+// Read reads the next len(p) bytes from the buffer or until the buffer is
+// drained. It implements io.Reader.
+func (b *Buffer) Read(p []byte) (n int, err error) {
+	if b.Len() == 0 {
+		b.Reset()
+		if len(p) == 0 {
+			return 0, nil
+		}
+
+		return 0, io.EOF
+	}
+
+	n = copy(p, b.buf[b.off:])
+	b.off += n
+	return n, nil
+}
+
+// ReadByte reads and returns the next byte from the buffer. It implements
+// io.ByteReader.
+func (b *Buffer) ReadByte() (byte, error) {
+	if b.Len() == 0 {
+		b.Reset()
+		return 0, io.EOF
+	}
+
+	c := b.buf[b.off]
+	b.off++
+	return c, nil
+}
+
+// Reset resets the buffer to be empty but retains its memory.
+func (b *Buffer) Reset() { b.buf, b.off = b.buf[:0], 0 }
+
+// String returns the unread portion of the buffer as a string.
+func (b *Buffer) String() string { return string(b.Bytes()) }
+
+// Write appends p to the buffer. It implements io.Writer.
+func (b *Buffer) Write(p []byte) (n int, err error) {
+	if err := b.Grow(len(p)); err != nil {
+		return 0, err
+	}
+
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// WriteByte appends c to the buffer. It implements io.ByteWriter.
+func (b *Buffer) WriteByte(c byte) error {
+	if err := b.Grow(1); err != nil {
+		return err
+	}
+
+	b.buf = append(b.buf, c)
+	return nil
+}
+
+// WriteString appends s to the buffer. It implements io.StringWriter.
+func (b *Buffer) WriteString(s string) (n int, err error) {
+	if err := b.Grow(len(s)); err != nil {
+		return 0, err
+	}
+
+	b.buf = append(b.buf, s...)
+	return len(s), nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !plan9
+// +build !plan9
+
+package memory
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"syscall"
+)
+
+// CAllocator provides the allocation functions of the C library with their C
+// semantics, for programs translated from C, eg. by cznic/crt. The methods
+// are named after the C functions, prefixed by X. Sizes are size_t values and
+// failures return zero and set Errno instead of returning an error. Its zero
+// value is ready for use.
+type CAllocator struct {
+	Allocator
+
+	// Errno is set to ENOMEM or EINVAL by a failing call and left
+	// unchanged by a successful one, like errno.
+	Errno syscall.Errno
+
+	// NonNilZero makes requests of zero bytes return a unique pointer,
+	// which must be freed, as glibc does, instead of zero.
+	NonNilZero bool
+}
+
+// size converts the size_t n to an int, setting Errno if it's too big.
+func (c *CAllocator) size(n uintptr) (int, bool) {
+	if uint64(n) > math.MaxInt {
+		c.Errno = syscall.ENOMEM
+		return 0, false
+	}
+
+	if n == 0 && c.NonNilZero {
+		n = 1
+	}
+	return int(n), true
+}
+
+// fail sets Errno for the allocation failure err and returns zero. Invalid
+// sizes and pointers, reported when Options.NoPanic is set, are EINVAL, all
+// other failures are ENOMEM.
+func (c *CAllocator) fail(err error) uintptr {
+	switch {
+	case errors.Is(err, ErrInvalidSize), errors.Is(err, ErrInvalidPointer):
+		c.Errno = syscall.EINVAL
+	default:
+		c.Errno = syscall.ENOMEM
+	}
+	return 0
+}
+
+// Xmalloc implements malloc(3).
+func (c *CAllocator) Xmalloc(n uintptr) uintptr {
+	size, ok := c.size(n)
+	if !ok {
+		return 0
+	}
+
+	p, err := c.UintptrMalloc(size)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	return p
+}
+
+// Xcalloc implements calloc(3).
+func (c *CAllocator) Xcalloc(n, size uintptr) uintptr {
+	hi, lo := bits.Mul64(uint64(n), uint64(size))
+	if hi != 0 || lo > uint64(^uintptr(0)) {
+		c.Errno = syscall.ENOMEM
+		return 0
+	}
+
+	sz, ok := c.size(uintptr(lo))
+	if !ok {
+		return 0
+	}
+
+	p, err := c.UintptrCalloc(sz)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	return p
+}
+
+// Xrealloc implements realloc(3). Like in glibc, realloc(p, 0) with a non-zero
+// p frees p and returns zero. On failure p is left intact.
+func (c *CAllocator) Xrealloc(p, n uintptr) uintptr {
+	if p != 0 && n == 0 {
+		c.Xfree(p)
+		return 0
+	}
+
+	size, ok := c.size(n)
+	if !ok {
+		return 0
+	}
+
+	r, err := c.UintptrRealloc(p, size)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	return r
+}
+
+// Xfree implements free(3). Freeing an invalid pointer is undefined behavior
+// in C, Xfree panics, unless Options.NoPanic is set.
+func (c *CAllocator) Xfree(p uintptr) {
+	if err := c.UintptrFree(p); err != nil && !c.NoPanic {
+		panic(err)
+	}
+}
+
+// Xmalloc_usable_size implements malloc_usable_size(3).
+func (c *CAllocator) Xmalloc_usable_size(p uintptr) uintptr {
+	return uintptr(c.UintptrUsableSize(p))
+}
+
+// Xmemalign implements memalign(3) using MallocAligned. The alignment must be
+// a power of two, otherwise Errno is set to EINVAL. Alignments larger than the
+// page size of the Allocator get a mapping of their own.
+func (c *CAllocator) Xmemalign(align, n uintptr) uintptr {
+	if align == 0 || align&(align-1) != 0 {
+		c.Errno = syscall.EINVAL
+		return 0
+	}
+
+	if uint64(align) > math.MaxInt {
+		c.Errno = syscall.ENOMEM
+		return 0
+	}
+
+	size, ok := c.size(n)
+	if !ok {
+		return 0
+	}
+
+	p, err := c.UintptrMallocAligned(int(align), size)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	return p
+}
@@ -0,0 +1,85 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !plan9
+// +build !plan9
+
+package memory
+
+import (
+	"math"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestCAllocator(t *testing.T) {
+	var c CAllocator
+	CheckLeaks(t, &c.Allocator)
+	defer c.Close()
+
+	if p := c.Xmalloc(0); p != 0 {
+		t.Fatalf("%#x", p)
+	}
+
+	c.NonNilZero = true
+	p := c.Xmalloc(0)
+	if p == 0 {
+		t.Fatal(c.Errno)
+	}
+
+	c.Xfree(p)
+	if p = c.Xcalloc(math.MaxInt32, math.MaxInt32); p != 0 || c.Errno != syscall.ENOMEM {
+		t.Fatal(p, c.Errno)
+	}
+
+	if p = c.Xcalloc(10, 10); p == 0 || c.Xmalloc_usable_size(p) < 100 {
+		t.Fatal(p)
+	}
+
+	*(*byte)(unsafe.Pointer(p)) = 42
+	q := c.Xrealloc(p, ^uintptr(0))
+	if q != 0 || c.Errno != syscall.ENOMEM {
+		t.Fatal(q, c.Errno)
+	}
+
+	if p = c.Xrealloc(p, 1000); p == 0 || *(*byte)(unsafe.Pointer(p)) != 42 {
+		t.Fatal(p)
+	}
+
+	if q = c.Xrealloc(p, 0); q != 0 {
+		t.Fatal(q)
+	}
+
+	if p = c.Xmemalign(3, 10); p != 0 || c.Errno != syscall.EINVAL {
+		t.Fatal(p, c.Errno)
+	}
+
+	for _, align := range []uintptr{8, 64, 4096, uintptr(pageSize), 4 * uintptr(pageSize)} {
+		p := c.Xmemalign(align, 100)
+		if p == 0 || p&(align-1) != 0 {
+			t.Fatal(align, p)
+		}
+
+		c.Xfree(p)
+	}
+
+	if p = c.Xmemalign(1<<(8*unsafe.Sizeof(uintptr(0))-1), 100); p != 0 || c.Errno != syscall.ENOMEM {
+		t.Fatal(p, c.Errno)
+	}
+
+	for _, v := range []struct {
+		err   error
+		errno syscall.Errno
+	}{
+		{&Error{Op: "malloc", Kind: ErrInvalidSize}, syscall.EINVAL},
+		{&Error{Op: "realloc", Kind: ErrInvalidPointer}, syscall.EINVAL},
+		{&Error{Op: "malloc", Kind: ErrOOM}, syscall.ENOMEM},
+		{&Error{Op: "malloc", Kind: ErrLimit}, syscall.ENOMEM},
+	} {
+		if p = c.fail(v.err); p != 0 || c.Errno != v.errno {
+			t.Fatal(v.err, p, c.Errno)
+		}
+	}
+}
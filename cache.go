@@ -0,0 +1,105 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"time"
+)
+
+// cachedPage is a freed dedicated page kept for reuse, see Options.LargeCache.
+type cachedPage struct {
+	pg *page
+	t  time.Time // When the page was freed.
+}
+
+// cachePage puts the freed dedicated page pg into the large block cache or
+// unmaps it if it does not fit.
+func (a *Allocator) cachePage(pg *page) (err error) {
+	if pg.size > a.LargeCache {
+		a.bytes.Add(-int64(pg.size))
+		return a.unmap(pg)
+	}
+
+	if a.ZeroOnFree {
+		a.wipePage(pg)
+	}
+	now := time.Now()
+	a.unregister(pg)
+	a.cache = append(a.cache, cachedPage{pg, now})
+	a.cacheBytes += pg.size
+	for a.cacheBytes > a.LargeCache {
+		if e := a.evictPage(); e != nil && err == nil {
+			err = e
+		}
+	}
+	if e := a.expireCache(now); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// cachedPage returns a page from the large block cache able to hold an
+// allocation of size bytes or nil if there's none. The page is registered
+// again.
+func (a *Allocator) cachedPage(size int) *page {
+	if len(a.cache) == 0 {
+		return nil
+	}
+
+	a.expireCache(time.Now())
+	size += headerSize
+	key := roundup(size, a.pageSize())
+	for i := len(a.cache) - 1; i >= 0; i-- {
+		pg := a.cache[i].pg
+		if pg.size < size || roundup(pg.size, a.pageSize()) != key {
+			continue
+		}
+
+		copy(a.cache[i:], a.cache[i+1:])
+		a.cache[len(a.cache)-1] = cachedPage{}
+		a.cache = a.cache[:len(a.cache)-1]
+		a.cacheBytes -= pg.size
+		a.register(pg)
+		return pg
+	}
+	return nil
+}
+
+// evictPage unmaps the least recently cached page.
+func (a *Allocator) evictPage() error {
+	pg := a.cache[0].pg
+	a.cache[0] = cachedPage{}
+	a.cache = a.cache[1:]
+	a.cacheBytes -= pg.size
+	a.bytes.Add(-int64(pg.size))
+	return a.unmap(pg)
+}
+
+// expireCache unmaps the cached pages older than Options.LargeCacheAge.
+func (a *Allocator) expireCache(now time.Time) (err error) {
+	if a.LargeCacheAge <= 0 {
+		return nil
+	}
+
+	for len(a.cache) != 0 && now.Sub(a.cache[0].t) > a.LargeCacheAge {
+		if e := a.evictPage(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// dropCache unmaps all cached pages and returns the number of bytes
+// released.
+func (a *Allocator) dropCache() (n int, err error) {
+	for len(a.cache) != 0 {
+		n += a.cache[0].pg.size
+		if e := a.evictPage(); e != nil && err == nil {
+			err = e
+		}
+	}
+	a.cache = nil
+	return n, err
+}
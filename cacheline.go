@@ -0,0 +1,84 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// CacheLineSize is the assumed size of a CPU cache line.
+const CacheLineSize = 64
+
+// CacheLinePad can be embedded in structs stored in allocator memory to place
+// the fields following it on a different cache line than those preceding it.
+type CacheLinePad struct{ _ [CacheLineSize]byte }
+
+// MallocCacheAligned is like Malloc except the returned block starts at a
+// cache line boundary and no other allocation shares a cache line with it.
+// It's intended for data written concurrently by multiple goroutines, which
+// would otherwise suffer from false sharing.
+func (a *Allocator) MallocCacheAligned(size int) (r []byte, err error) {
+	p, err := a.UintptrMallocCacheAligned(size)
+	if p == 0 || err != nil {
+		return nil, err
+	}
+
+	return a.slice(p, size), nil
+}
+
+// UintptrMallocCacheAligned is like MallocCacheAligned except it returns an
+// uintptr.
+func (a *Allocator) UintptrMallocCacheAligned(size int) (r uintptr, err error) {
+	if size <= 0 || size > a.maxSize() {
+		return a.UintptrMalloc(size)
+	}
+
+	// Slots of size classes of at least CacheLineSize bytes are cache line
+	// aligned, see headerSize.
+	return a.UintptrMalloc(roundup(size, CacheLineSize))
+}
+
+// UnsafeMallocCacheAligned is like MallocCacheAligned except it returns an
+// unsafe.Pointer.
+func (a *Allocator) UnsafeMallocCacheAligned(size int) (r unsafe.Pointer, err error) {
+	p, err := a.UintptrMallocCacheAligned(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Pointer(p), nil
+}
+
+// MallocPerCPU allocates runtime.GOMAXPROCS(0) blocks of size bytes, each
+// starting on its own cache line, eg. for the shards of a counter updated
+// concurrently. The blocks are carved from a single allocation, which is
+// freed by passing the first block to Free.
+func (a *Allocator) MallocPerCPU(size int) (r [][]byte, err error) {
+	if size < 0 {
+		return nil, a.invalidSize("malloc", size)
+	}
+
+	n := runtime.GOMAXPROCS(0)
+	if size == 0 {
+		return make([][]byte, n), nil
+	}
+
+	if size > a.maxSize()/n-CacheLineSize {
+		return nil, &Error{Op: "malloc", Size: size, Kind: ErrOOM}
+	}
+
+	stride := roundup(size, CacheLineSize)
+	p, err := a.UintptrMallocCacheAligned(n * stride)
+	if err != nil {
+		return nil, err
+	}
+
+	r = make([][]byte, n)
+	for i := range r {
+		r[i] = unsafe.Slice((*byte)(unsafe.Pointer(p+uintptr(i*stride))), stride)[:size:size]
+	}
+	return r, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+// childBackend is the Backend of an Allocator created by NewChild. It maps
+// memory using the Backend of the parent and accounts it against the Limit of
+// the parent.
+type childBackend struct {
+	parent *Allocator
+	child  *Allocator
+}
+
+// Map implements Backend.
+func (b *childBackend) Map(size, align int) (addr uintptr, n int, err error) {
+	a := b.parent
+	a.childMu.Lock()
+	defer a.childMu.Unlock()
+
+	if a.Limit > 0 && int(a.bytes.Load()+a.childBytes.Load())+size > a.Limit {
+		return 0, 0, &Error{Op: "mmap", Size: size, Kind: ErrLimit}
+	}
+
+	if addr, n, err = a.backend().Map(size, align); err != nil {
+		return 0, 0, err
+	}
+
+	a.childBytes.Add(int64(n))
+	if a.children == nil {
+		a.children = map[*Allocator]struct{}{}
+	}
+	a.children[b.child] = struct{}{}
+	return addr, n, nil
+}
+
+// Unmap implements Backend.
+func (b *childBackend) Unmap(addr uintptr, size int) error {
+	a := b.parent
+	a.childMu.Lock()
+	defer a.childMu.Unlock()
+
+	a.childBytes.Add(-int64(size))
+	return a.backend().Unmap(addr, size)
+}
+
+// NewChild returns a new Allocator mapping its memory from the Backend of a.
+// The memory mapped by the child, and recursively by its own children, is
+// accounted against a.Limit, so a can cap the total memory of eg. all
+// per-request or per-session children. Closing the child releases all its
+// memory, closing a closes all its children first.
+//
+// The child inherits the Options of a except for Backend, Limit and
+// MemoryTagging. Its Limit may be set to cap the child alone. Children of a
+// may be used concurrently with each other and, if the Backend of a is safe
+// for concurrent use, with a.
+func (a *Allocator) NewChild() *Allocator {
+	c := &Allocator{Options: a.Options}
+	c.Backend = &childBackend{parent: a, child: c}
+	c.Limit = 0
+	c.MemoryTagging = false
+	return c
+}
+
+// closeChildren closes the children of a with memory mapped.
+func (a *Allocator) closeChildren() (err error) {
+	a.childMu.Lock()
+	children := a.children
+	a.children = nil
+	a.childMu.Unlock()
+
+	for c := range children {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// detach removes a from the children of its parent, if any.
+func (a *Allocator) detach() {
+	if b, ok := a.Backend.(*childBackend); ok && b.child == a {
+		b.parent.childMu.Lock()
+		delete(b.parent.children, a)
+		b.parent.childMu.Unlock()
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// Ref is a reference to an object of a CompactingHeap. The zero Ref refers to
+// nothing.
+//
+// The lower 32 bits of a Ref are the index of its table entry, the upper 32
+// bits are the generation of the entry, the number of times it was freed
+// before. Using a Ref of a freed object fails, even when its entry was reused
+// in the meantime.
+type Ref uint64
+
+const refGenShift = 32 // Position of the generation in a Ref.
+
+type refEntry struct {
+	h    Handle // Zero for free entries.
+	size int    // Requested size.
+	gen  uint32 // Incremented by Free.
+}
+
+// CompactingHeap is a heap of movable objects for very long lived heaps. The
+// objects are referenced by Refs, which are indexes into a table of Handles.
+// Compact moves the live objects together and updates the table, giving back
+// the memory lost to fragmentation.
+//
+// The address returned by Resolve is valid only until the next call of Compact
+// or Realloc of the same object. The objects must not hold addresses of other
+// objects, they should use Refs instead.
+type CompactingHeap struct {
+	alloc *Allocator
+	arena *ArenaBackend
+	free  []Ref // Unused table entries.
+	refs  []refEntry
+	size  int
+}
+
+// NewCompactingHeap returns a CompactingHeap using an arena reserving size
+// bytes of address space.
+func NewCompactingHeap(size int) (*CompactingHeap, error) {
+	arena, err := NewArenaBackend(size)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &CompactingHeap{alloc: &Allocator{Options: Options{Backend: arena}}, arena: arena, size: size}
+	return h, nil
+}
+
+// Calloc is like Malloc except the object is zeroed.
+func (h *CompactingHeap) Calloc(size int) (Ref, error) {
+	r, err := h.Malloc(size)
+	if err != nil || r == 0 {
+		return r, err
+	}
+
+	p := h.Resolve(r)
+	clear(unsafe.Slice((*byte)(unsafe.Pointer(p)), size))
+	return r, nil
+}
+
+// Close releases all resources of h.
+func (h *CompactingHeap) Close() error {
+	err := h.alloc.Close()
+	if e := h.arena.Close(); e != nil && err == nil {
+		err = e
+	}
+	*h = CompactingHeap{}
+	return err
+}
+
+// Compact moves all live objects to a new arena, ordered by their Refs, and
+// releases the old one. The Refs of the objects do not change.
+func (h *CompactingHeap) Compact() error {
+	arena, err := NewArenaBackend(h.size)
+	if err != nil {
+		return err
+	}
+
+	alloc := &Allocator{Options: h.alloc.Options}
+	alloc.Backend = arena
+	refs := make([]refEntry, len(h.refs))
+	for i, e := range h.refs {
+		if e.h == 0 {
+			refs[i] = e
+			continue
+		}
+
+		p, err := alloc.UintptrMalloc(e.size)
+		if err != nil {
+			alloc.Close()
+			arena.Close()
+			return err
+		}
+
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(p)), e.size), unsafe.Slice((*byte)(unsafe.Pointer(h.arena.Resolve(e.h))), e.size))
+		refs[i] = refEntry{arena.Handle(p), e.size, e.gen}
+	}
+	h.alloc.Close()
+	h.arena.Close()
+	h.alloc, h.arena, h.refs = alloc, arena, refs
+	return nil
+}
+
+// Free releases the object referenced by r.
+func (h *CompactingHeap) Free(r Ref) error {
+	if r == 0 {
+		return nil
+	}
+
+	e, err := h.entry("free", r)
+	if err != nil {
+		return err
+	}
+
+	if err := h.alloc.HandleFree(e.h); err != nil {
+		return err
+	}
+
+	*e = refEntry{gen: e.gen + 1}
+	h.free = append(h.free, r&(1<<refGenShift-1))
+	return nil
+}
+
+// Len returns the number of live objects of h.
+func (h *CompactingHeap) Len() int { return len(h.refs) - len(h.free) }
+
+// Malloc allocates an object of size bytes and returns its Ref. Malloc returns
+// a zero Ref for a zero size.
+func (h *CompactingHeap) Malloc(size int) (Ref, error) {
+	hnd, err := h.alloc.HandleMalloc(size)
+	if err != nil || hnd == 0 {
+		return 0, err
+	}
+
+	e := refEntry{h: hnd, size: size}
+	if n := len(h.free); n != 0 {
+		r := h.free[n-1]
+		h.free = h.free[:n-1]
+		e.gen = h.refs[r-1].gen
+		h.refs[r-1] = e
+		return Ref(e.gen)<<refGenShift | r, nil
+	}
+
+	h.refs = append(h.refs, e)
+	return Ref(len(h.refs)), nil
+}
+
+// Realloc changes the size of the object referenced by r, preserving its
+// contents up to the lesser of the old and new sizes. The size must be
+// positive. The Ref of the object does not change.
+func (h *CompactingHeap) Realloc(r Ref, size int) error {
+	e, err := h.entry("realloc", r)
+	if err != nil {
+		return err
+	}
+
+	if size <= 0 {
+		return h.alloc.invalidSize("realloc", size)
+	}
+
+	hnd, err := h.alloc.HandleRealloc(e.h, size)
+	if err != nil {
+		return err
+	}
+
+	e.h, e.size = hnd, size
+	return nil
+}
+
+// Resolve returns the current address of the object referenced by r or zero
+// if r is zero, invalid or stale.
+func (h *CompactingHeap) Resolve(r Ref) uintptr {
+	if e, _ := h.entry("resolve", r); e != nil {
+		return h.arena.Resolve(e.h)
+	}
+
+	return 0
+}
+
+// Stats returns the statistics of the allocator of h.
+func (h *CompactingHeap) Stats() Stats { return h.alloc.Stats() }
+
+// entry returns the table entry of r. The error is ErrStale if the object of
+// r was freed.
+func (h *CompactingHeap) entry(op string, r Ref) (*refEntry, error) {
+	i := r & (1<<refGenShift - 1)
+	if i == 0 || i > Ref(len(h.refs)) {
+		return nil, &Error{Op: op, Addr: uintptr(r), Kind: ErrInvalidPointer}
+	}
+
+	if e := &h.refs[i-1]; e.h != 0 && e.gen == uint32(r>>refGenShift) {
+		return e, nil
+	}
+
+	return nil, &Error{Op: op, Addr: uintptr(r), Kind: ErrStale}
+}
@@ -0,0 +1,36 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+type allocatorKey struct{}
+
+// WithAllocator returns a copy of ctx carrying a.
+func WithAllocator(ctx context.Context, a *Allocator) context.Context {
+	return context.WithValue(ctx, allocatorKey{}, a)
+}
+
+// FromContext returns the Allocator carried by ctx or nil if there's none.
+func FromContext(ctx context.Context) *Allocator {
+	a, _ := ctx.Value(allocatorKey{}).(*Allocator)
+	return a
+}
+
+// WithChild returns a new child of parent, see NewChild, a copy of ctx
+// carrying it and a function closing the child, which releases all its
+// memory. The caller must call release, usually deferred by the handler of an
+// HTTP or gRPC request, once nothing uses the child anymore. The child is not
+// closed when ctx is done, because an Allocator must not be closed
+// concurrently with its other methods, and goroutines of a canceled request
+// may still be using it. Calls of release after the first one do nothing.
+func WithChild(ctx context.Context, parent *Allocator) (_ context.Context, child *Allocator, release func()) {
+	c := parent.NewChild()
+	var once sync.Once
+	return WithAllocator(ctx, c), c, func() { once.Do(func() { c.Close() }) }
+}
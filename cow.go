@@ -0,0 +1,342 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package memory
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	_FALLOC_FL_KEEP_SIZE  = 1
+	_FALLOC_FL_PUNCH_HOLE = 2
+
+	// Bits of the entries of /proc/self/pagemap.
+	pagemapPresent = 1 << 63
+	pagemapSwapped = 1 << 62
+	pagemapFile    = 1 << 61 // Page cache or shared anonymous page, ie. not a private copy.
+)
+
+// COWBackend is a Backend whose mappings can be snapshotted copy-on-write, see
+// Snapshot. The mappings are shared mappings of an unlinked file in /dev/shm,
+// or in os.TempDir if there's none. COWBackend is supported on Linux only.
+//
+// COWBackend is safe for concurrent use.
+type COWBackend struct {
+	f    *os.File
+	maps map[uintptr]*cowMap // Live mappings by address.
+	mu   sync.Mutex
+	size int64 // Of f.
+}
+
+// cowMap is a range of the file of a COWBackend.
+type cowMap struct {
+	off     int64
+	size    int
+	private bool // Mapped copy-on-write, the writes since are not in the file.
+	refs    int  // Open HeapViews of the range.
+	dead    bool // No longer mapped by the Backend.
+}
+
+// NewCOWBackend returns a new COWBackend. It returns an error wrapping
+// ErrUnsupported on platforms other than Linux.
+func NewCOWBackend() (*COWBackend, error) {
+	dir := os.TempDir()
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		dir = "/dev/shm"
+	}
+	f, err := os.CreateTemp(dir, "memory-cow-")
+	if err != nil {
+		return nil, &Error{Op: "cow", Kind: ErrUnsupported, Err: err}
+	}
+
+	os.Remove(f.Name())
+	return &COWBackend{f: f, maps: map[uintptr]*cowMap{}}, nil
+}
+
+func (b *COWBackend) fd() int { return int(b.f.Fd()) }
+
+// Map implements Backend.
+func (b *COWBackend) Map(size, align int) (addr uintptr, n int, err error) {
+	size = roundup(size, osPageSize)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.f == nil {
+		return 0, 0, os.ErrClosed
+	}
+
+	off, err := b.grow(size)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	r, err := reserve(size + align)
+	if err != nil {
+		b.punch(off, size)
+		return 0, 0, err
+	}
+
+	addr = uintptr(roundup(int(r), align))
+	if err := b.place(addr, off, size, syscall.MAP_SHARED); err != nil {
+		unmap(r, size+align)
+		b.punch(off, size)
+		return 0, 0, err
+	}
+
+	if addr > r {
+		unmap(r, int(addr-r))
+	}
+	if end, hi := addr+uintptr(size), r+uintptr(size+align); end < hi {
+		unmap(end, int(hi-end))
+	}
+	b.maps[addr] = &cowMap{off: off, size: size}
+	return addr, size, nil
+}
+
+// Unmap implements Backend.
+func (b *COWBackend) Unmap(addr uintptr, size int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m := b.maps[addr]
+	if m == nil || m.size != size {
+		return syscall.EINVAL
+	}
+
+	delete(b.maps, addr)
+	err := unmap(addr, size)
+	b.drop(m)
+	return err
+}
+
+// Close releases the file backing b. All Allocators using b and all HeapViews
+// of b must have been closed before.
+func (b *COWBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.f == nil {
+		return nil
+	}
+
+	err := b.f.Close()
+	b.f, b.maps, b.size = nil, nil, 0
+	return err
+}
+
+// Snapshot returns a read-only view of the memory of all mappings of b at the
+// time of the call. Instead of copying the memory, Snapshot remaps the
+// mappings copy-on-write, so the view does not change when the mappings are
+// written afterwards and only the pages written are duplicated. The writes
+// made since the previous Snapshot are first stored in the file, which copies
+// the pages written or, if a view of the previous Snapshot is still open, the
+// whole mapping.
+//
+// The memory of b must not be modified while Snapshot runs. The view may be
+// used concurrently with modifications of the memory.
+func (b *COWBackend) Snapshot() (*HeapView, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.f == nil {
+		return nil, os.ErrClosed
+	}
+
+	pm, _ := os.Open("/proc/self/pagemap")
+	if pm != nil {
+		defer pm.Close()
+	}
+
+	v := &HeapView{b: b}
+	for addr, m := range b.maps {
+		if m.private {
+			var err error
+			if m, err = b.sync(addr, m, pm); err != nil {
+				v.close()
+				return nil, err
+			}
+		}
+
+		r, err := syscall.Mmap(b.fd(), m.off, m.size, syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			v.close()
+			return nil, err
+		}
+
+		p := uintptr(unsafe.Pointer(&r[0]))
+		if err := b.place(addr, m.off, m.size, syscall.MAP_PRIVATE); err != nil {
+			unmap(p, m.size)
+			v.close()
+			return nil, err
+		}
+
+		m.private = true
+		m.refs++
+		v.maps = append(v.maps, viewMap{addr, p, m})
+	}
+	sort.Slice(v.maps, func(i, j int) bool { return v.maps[i].old < v.maps[j].old })
+	return v, nil
+}
+
+// sync stores the contents of the copy-on-write mapping m at addr in the file
+// and returns the range holding them. The mapping stays copy-on-write. If m is
+// still viewed, the contents are stored in a new range.
+func (b *COWBackend) sync(addr uintptr, m *cowMap, pm *os.File) (*cowMap, error) {
+	mem := unsafe.Slice((*byte)(unsafe.Pointer(addr)), m.size)
+	if m.refs != 0 {
+		off, err := b.grow(m.size)
+		if err != nil {
+			return nil, err
+		}
+
+		nm := &cowMap{off: off, size: m.size}
+		if err := pwrite(b.fd(), mem, off); err != nil {
+			b.drop(nm)
+			return nil, err
+		}
+
+		b.drop(m)
+		b.maps[addr] = nm
+		return nm, nil
+	}
+
+	// Only the private copies of pages differ from the file.
+	n := m.size / osPageSize
+	pages := make([]uint64, n)
+	if pm == nil {
+		for i := range pages {
+			pages[i] = pagemapPresent
+		}
+	} else if _, err := pm.ReadAt(unsafe.Slice((*byte)(unsafe.Pointer(&pages[0])), 8*n), int64(addr)/int64(osPageSize)*8); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < n; {
+		j := i
+		for ; j < n; j++ {
+			if e := pages[j]; e&(pagemapPresent|pagemapSwapped) == 0 || e&pagemapFile != 0 {
+				break
+			}
+		}
+		if j > i {
+			if err := pwrite(b.fd(), mem[i*osPageSize:j*osPageSize], m.off+int64(i*osPageSize)); err != nil {
+				return nil, err
+			}
+		}
+		i = j + 1
+	}
+	m.private = false
+	return m, nil
+}
+
+// grow appends size bytes to the file and returns their offset.
+func (b *COWBackend) grow(size int) (int64, error) {
+	off := b.size
+	if err := syscall.Ftruncate(b.fd(), off+int64(size)); err != nil {
+		return 0, err
+	}
+
+	b.size += int64(size)
+	return off, nil
+}
+
+// place maps size bytes of the file at offset off readable and writable at
+// addr, replacing the mapping there. The flags are MAP_SHARED or MAP_PRIVATE.
+func (b *COWBackend) place(addr uintptr, off int64, size, flags int) error {
+	r, err := syscall.Mmap(b.fd(), off, size, syscall.PROT_READ|syscall.PROT_WRITE, flags)
+	if err != nil {
+		return err
+	}
+
+	p := uintptr(unsafe.Pointer(&r[0]))
+	q, _, errno := syscall.Syscall6(syscall.SYS_MREMAP, p, uintptr(size), uintptr(size), _MREMAP_MAYMOVE|_MREMAP_FIXED, addr, 0)
+	if errno != 0 || q != addr {
+		unmap(p, size)
+		if errno == 0 {
+			errno = syscall.EINVAL
+		}
+		return errno
+	}
+
+	return nil
+}
+
+// drop marks the range m as no longer mapped by b and releases its memory if
+// it's not viewed.
+func (b *COWBackend) drop(m *cowMap) {
+	m.dead = true
+	if m.refs == 0 {
+		b.punch(m.off, m.size)
+	}
+}
+
+// punch releases the memory of size bytes of the file at offset off.
+func (b *COWBackend) punch(off int64, size int) {
+	syscall.Fallocate(b.fd(), _FALLOC_FL_PUNCH_HOLE|_FALLOC_FL_KEEP_SIZE, off, int64(size))
+}
+
+func pwrite(fd int, b []byte, off int64) error {
+	for len(b) != 0 {
+		n, err := syscall.Pwrite(fd, b, off)
+		if err != nil {
+			return err
+		}
+
+		b = b[n:]
+		off += int64(n)
+	}
+	return nil
+}
+
+// HeapView is a read-only snapshot of the memory of a COWBackend, see
+// COWBackend.Snapshot.
+type HeapView struct {
+	b    *COWBackend
+	maps []viewMap // Ordered by old.
+}
+
+type viewMap struct {
+	old, new uintptr
+	m        *cowMap
+}
+
+// Addr returns the address in v of the byte at p in the memory of the
+// COWBackend at the time of the snapshot or zero if p was not mapped.
+func (v *HeapView) Addr(p uintptr) uintptr {
+	i := sort.Search(len(v.maps), func(i int) bool { return v.maps[i].old+uintptr(v.maps[i].m.size) > p })
+	if i == len(v.maps) || p < v.maps[i].old {
+		return 0
+	}
+
+	return v.maps[i].new + p - v.maps[i].old
+}
+
+// Close unmaps v.
+func (v *HeapView) Close() error {
+	v.b.mu.Lock()
+	defer v.b.mu.Unlock()
+
+	return v.close()
+}
+
+func (v *HeapView) close() (err error) {
+	for _, vm := range v.maps {
+		if e := unmap(vm.new, vm.m.size); e != nil && err == nil {
+			err = e
+		}
+		if vm.m.refs--; vm.m.refs == 0 && vm.m.dead {
+			v.b.punch(vm.m.off, vm.m.size)
+		}
+	}
+	v.maps = nil
+	return err
+}
@@ -0,0 +1,40 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package memory
+
+// COWBackend is a Backend whose mappings can be snapshotted copy-on-write. It
+// is supported on Linux only.
+type COWBackend struct{}
+
+// NewCOWBackend returns an error wrapping ErrUnsupported.
+func NewCOWBackend() (*COWBackend, error) { return nil, &Error{Op: "cow", Kind: ErrUnsupported} }
+
+// Map implements Backend.
+func (b *COWBackend) Map(size, align int) (addr uintptr, n int, err error) {
+	return 0, 0, ErrUnsupported
+}
+
+// Unmap implements Backend.
+func (b *COWBackend) Unmap(addr uintptr, size int) error { return ErrUnsupported }
+
+// Close is a nop.
+func (b *COWBackend) Close() error { return nil }
+
+// Snapshot returns an error wrapping ErrUnsupported.
+func (b *COWBackend) Snapshot() (*HeapView, error) {
+	return nil, &Error{Op: "cow", Kind: ErrUnsupported}
+}
+
+// HeapView is a read-only snapshot of the memory of a COWBackend.
+type HeapView struct{}
+
+// Addr returns zero.
+func (v *HeapView) Addr(p uintptr) uintptr { return 0 }
+
+// Close is a nop.
+func (v *HeapView) Close() error { return nil }
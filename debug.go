@@ -0,0 +1,95 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+// Debug features enabled by the MEMORY_DEBUG environment variable, a comma
+// separated list of
+//
+//	canary	fill the unused tail of every block and check it on Free,
+//		Allocator.UsableSize and the capacity of returned slices
+//		exclude the tail, Free rejects pointers outside of the
+//		pages of the Allocator
+//	junk	fill allocated blocks with 0xa5 and freed blocks with 0x5a
+//	leaks	report live allocations and mappings on Close to stderr
+//	trace	log all Malloc, Calloc, Realloc and Free calls to stderr
+//
+// The variable is read once when the package is initialized.
+const (
+	debugCanary = 1 << iota
+	debugJunk
+	debugLeaks
+	debugTrace
+)
+
+const (
+	canaryByte    = 0xca
+	junkAllocByte = 0xa5
+	junkFreeByte  = 0x5a
+)
+
+var debugFlags = parseDebug(os.Getenv("MEMORY_DEBUG"))
+
+func parseDebug(s string) (r int) {
+	for _, v := range strings.Split(s, ",") {
+		switch v = strings.TrimSpace(v); v {
+		case "":
+			// nop
+		case "canary":
+			r |= debugCanary
+		case "junk":
+			r |= debugJunk
+		case "leaks":
+			r |= debugLeaks
+		case "trace":
+			r |= debugTrace
+		default:
+			fmt.Fprintf(os.Stderr, "memory: unknown MEMORY_DEBUG option %q\n", v)
+		}
+	}
+	return r
+}
+
+// trackSizes reports whether a tracks the requested sizes of its allocations.
+func (a *Allocator) trackSizes() bool { return a.TrackSizes || debugFlags&debugCanary != 0 }
+
+// fill sets the size bytes at p to c.
+func fill(p uintptr, size int, c byte) {
+	b := unsafe.Slice((*byte)(unsafe.Pointer(p)), size)
+	for i := range b {
+		b[i] = c
+	}
+}
+
+// setCanary fills the tail of the block at p, past its size bytes.
+func (a *Allocator) setCanary(p uintptr, size int) {
+	if us := a.usable(p); size < us {
+		fill(p+uintptr(size), us-size, canaryByte)
+	}
+}
+
+// checkCanary reports an error if the tail of the block at p, filled by
+// setCanary, was overwritten.
+func (a *Allocator) checkCanary(op string, p uintptr) error {
+	size, ok := a.sizes[p]
+	if !ok || a.tagging() {
+		// Tagged memory faults on overflows by itself.
+		return nil
+	}
+
+	us := a.usable(p)
+	for i, v := range unsafe.Slice((*byte)(unsafe.Pointer(p+uintptr(size))), us-size) {
+		if v != canaryByte {
+			return &Error{Op: op, Addr: p, Size: size, Kind: ErrCorrupted, Err: fmt.Errorf("canary overwritten at offset %#x", size+i)}
+		}
+	}
+	return nil
+}
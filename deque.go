@@ -0,0 +1,146 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Deque is a double ended queue of T in memory of an Allocator. It can be used
+// as a FIFO queue by PushBack and PopFront or as a stack. The elements are
+// kept in a ring of a power of two size, which doubles by Realloc when full.
+// Like for Vector, T must not contain Go pointers and NewDeque rejects such
+// types.
+//
+// A Deque must be released by Close.
+type Deque[T any] struct {
+	a    *Allocator
+	s    []T // The ring, len(s) == cap(s) is a power of two or zero.
+	head int // Index of the front element.
+	n    int // Number of elements.
+}
+
+// NewDeque returns a Deque allocating from a. It returns an error if T
+// contains Go pointers.
+func NewDeque[T any](a *Allocator) (*Deque[T], error) {
+	if err := checkPointerFree(reflect.TypeOf((*T)(nil)).Elem()); err != nil {
+		return nil, err
+	}
+
+	return &Deque[T]{a: a}, nil
+}
+
+// At returns the element at index i, counting from the front.
+func (d *Deque[T]) At(i int) T {
+	if uint(i) >= uint(d.n) {
+		panic("memory: Deque index out of range")
+	}
+
+	return d.s[(d.head+i)&(len(d.s)-1)]
+}
+
+// Cap returns the number of elements the deque can hold without growing.
+func (d *Deque[T]) Cap() int { return len(d.s) }
+
+// Close releases the memory of the deque and resets it to be empty.
+func (d *Deque[T]) Close() (err error) {
+	var zero T
+	if len(d.s) != 0 && unsafe.Sizeof(zero) != 0 {
+		err = d.a.UnsafeFree(unsafe.Pointer(&d.s[0]))
+	}
+	d.s, d.head, d.n = nil, 0, 0
+	return err
+}
+
+// Len returns the number of elements of the deque.
+func (d *Deque[T]) Len() int { return d.n }
+
+// PopBack removes and returns the back element. It reports false if the
+// deque is empty.
+func (d *Deque[T]) PopBack() (e T, ok bool) {
+	if d.n == 0 {
+		return e, false
+	}
+
+	d.n--
+	return d.s[(d.head+d.n)&(len(d.s)-1)], true
+}
+
+// PopFront removes and returns the front element. It reports false if the
+// deque is empty.
+func (d *Deque[T]) PopFront() (e T, ok bool) {
+	if d.n == 0 {
+		return e, false
+	}
+
+	e = d.s[d.head]
+	d.head = (d.head + 1) & (len(d.s) - 1)
+	d.n--
+	return e, true
+}
+
+// PushBack appends e at the back of the deque, growing it if necessary.
+func (d *Deque[T]) PushBack(e T) error {
+	if err := d.grow(); err != nil {
+		return err
+	}
+
+	d.s[(d.head+d.n)&(len(d.s)-1)] = e
+	d.n++
+	return nil
+}
+
+// PushFront inserts e at the front of the deque, growing it if necessary.
+func (d *Deque[T]) PushFront(e T) error {
+	if err := d.grow(); err != nil {
+		return err
+	}
+
+	d.head = (d.head - 1) & (len(d.s) - 1)
+	d.s[d.head] = e
+	d.n++
+	return nil
+}
+
+// Reset removes all elements of the deque but retains its memory.
+func (d *Deque[T]) Reset() { d.head, d.n = 0, 0 }
+
+// grow doubles the ring if it's full.
+func (d *Deque[T]) grow() error {
+	if d.n < len(d.s) {
+		return nil
+	}
+
+	c := 2 * len(d.s)
+	if c == 0 {
+		c = 8
+	}
+	var zero T
+	sz := int(unsafe.Sizeof(zero))
+	if sz == 0 {
+		d.s = make([]T, c)
+		return nil
+	}
+
+	if c > maxMalloc/sz {
+		return &Error{Op: "grow", Size: c, Kind: ErrOOM}
+	}
+
+	var p unsafe.Pointer
+	if len(d.s) != 0 {
+		p = unsafe.Pointer(&d.s[0])
+	}
+	p, err := d.a.UnsafeRealloc(p, c*sz)
+	if err != nil {
+		return err
+	}
+
+	// Move the wrapped around part after the old end of the ring.
+	old := len(d.s)
+	d.s = unsafe.Slice((*T)(p), c)
+	copy(d.s[old:], d.s[:d.head])
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+// deterministicArenaSize is the address space reserved by an Allocator with
+// Options.Deterministic set and no Backend.
+var deterministicArenaSize = 1 << (28 + 8*(^uint(0)>>63))
+
+// ownBackend returns the ArenaBackend of a deterministic Allocator without a
+// Backend, creating it on first use. If the platform cannot reserve address
+// space, the default backend is used.
+func (a *Allocator) ownBackend() Backend {
+	if a.own == nil && !a.ownFailed {
+		b, err := NewArenaBackend(deterministicArenaSize)
+		if err != nil {
+			a.ownFailed = true
+			return defaultBackend
+		}
+
+		a.own = b
+	}
+	if a.own == nil {
+		return defaultBackend
+	}
+
+	return a.own
+}
+
+// pageOrder returns the pages of a, ordered by address if a.Deterministic is
+// set.
+func (a *Allocator) pageOrder() []*page {
+	if a.Deterministic {
+		return a.sortedPages()
+	}
+
+	return append([]*page(nil), a.regs...)
+}
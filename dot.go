@@ -0,0 +1,54 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// WriteDOT writes the heap layout of a to w as a Graphviz DOT graph. Every
+// page is a node labeled with its address, size class, brk position and
+// number of used slots. Every size class with a non-empty free list is a node
+// from which a chain of edges follows the free list through the pages it
+// visits. Consecutive free slots on the same page are merged into a single
+// edge labeled with their count. Headerless blocks and LargeCache pages are
+// nodes labeled bare and cached.
+func (a *Allocator) WriteDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "digraph heap {\n\tnode [shape=record];\n")
+	for _, pg := range a.sortedPages() {
+		addr := uintptr(unsafe.Pointer(pg))
+		if pg.log == 0 {
+			fmt.Fprintf(b, "\tp%x [label=\"%#x|dedicated|size %v\"];\n", addr, addr, pg.size)
+			continue
+		}
+
+		fmt.Fprintf(b, "\tp%x [label=\"%#x|class %v (%v B)|brk %v/%v|used %v\"];\n", addr, addr, pg.log, 1<<pg.log, pg.brk, a.cap[pg.log], pg.used)
+	}
+	for _, v := range a.unregistered() {
+		fmt.Fprintf(b, "\tp%x [label=\"%#x|%s|size %v\"];\n", v.addr, v.addr, v.kind(), v.size)
+	}
+	for log := range a.lists {
+		if a.lists[log] == nil {
+			continue
+		}
+
+		from := fmt.Sprintf("c%v", log)
+		fmt.Fprintf(b, "\t%s [shape=ellipse,label=\"class %v free list\"];\n", from, log)
+		for pg := a.lists[log]; pg != nil; pg = pg.next {
+			n := 0
+			for x := pg.free; x != nil; x = x.next {
+				n++
+			}
+			fmt.Fprintf(b, "\t%s -> p%x [label=\"%v\"];\n", from, uintptr(unsafe.Pointer(pg)), n)
+			from = fmt.Sprintf("p%x", uintptr(unsafe.Pointer(pg)))
+		}
+	}
+	fmt.Fprintf(b, "}\n")
+	return b.Flush()
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"unsafe"
+)
+
+// Dump writes a human readable description of the state of a to w. The
+// output lists the counters, the size classes in use with the lengths of
+// their free lists, all pages ordered by address and the headerless blocks
+// and LargeCache pages, which are included in the counters as well. It's
+// intended for diagnostics, the format may change.
+func (a *Allocator) Dump(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	s := a.Stats()
+	fmt.Fprintf(b, "allocs %v, mmaps %v, bytes %v\n", s.Allocs, s.Mmaps, s.Bytes)
+	fmt.Fprintf(b, "mallocs %v, frees %v, reallocs %v, allocated %v, freed %v\n", s.Mallocs, s.Frees, s.Reallocs, s.BytesAllocated, s.BytesFreed)
+	fmt.Fprintf(b, "size classes:\n")
+	fmt.Fprintf(b, "%6s %8s %8s %8s %18s\n", "class", "slot", "cap", "free", "brk page")
+	for log, c := range a.cap {
+		if c == 0 {
+			continue
+		}
+
+		fmt.Fprintf(b, "%6v %8v %8v %8v %#18x\n", log, 1<<uint(log), c, a.listLen(uint(log)), uintptr(unsafe.Pointer(a.pages[log])))
+	}
+	fmt.Fprintf(b, "pages:\n")
+	fmt.Fprintf(b, "%18s %10s %6s %8s %8s\n", "addr", "size", "class", "brk", "used")
+	for _, pg := range a.sortedPages() {
+		if pg.log == 0 {
+			fmt.Fprintf(b, "%#18x %10v %6s\n", uintptr(unsafe.Pointer(pg)), pg.size, "-")
+			continue
+		}
+
+		fmt.Fprintf(b, "%#18x %10v %6v %8v %8v\n", uintptr(unsafe.Pointer(pg)), pg.size, pg.log, pg.brk, pg.used)
+	}
+	if x := a.unregistered(); len(x) != 0 {
+		fmt.Fprintf(b, "headerless blocks and cached pages:\n")
+		fmt.Fprintf(b, "%18s %10s %6s\n", "addr", "size", "kind")
+		for _, v := range x {
+			fmt.Fprintf(b, "%#18x %10v %6s\n", v.addr, v.size, v.kind())
+		}
+	}
+	return b.Flush()
+}
+
+func (a *Allocator) listLen(log uint) (r int) {
+	for pg := a.lists[log]; pg != nil; pg = pg.next {
+		for n := pg.free; n != nil; n = n.next {
+			r++
+		}
+	}
+	return r
+}
+
+func (a *Allocator) sortedPages() []*page {
+	return append([]*page(nil), a.ranges...)
+}
+
+// unregisteredBlock is memory mapped by an Allocator outside of its
+// registered pages.
+type unregisteredBlock struct {
+	addr   uintptr
+	size   int
+	cached bool // A LargeCache page, otherwise a headerless block.
+}
+
+func (b unregisteredBlock) kind() string {
+	if b.cached {
+		return "cached"
+	}
+
+	return "bare"
+}
+
+// unregistered returns the headerless blocks and the LargeCache pages of a
+// ordered by address.
+func (a *Allocator) unregistered() (r []unregisteredBlock) {
+	for p, n := range a.bare {
+		r = append(r, unregisteredBlock{p, n, false})
+	}
+	for _, c := range a.cache {
+		r = append(r, unregisteredBlock{uintptr(unsafe.Pointer(c.pg)), c.pg.size, true})
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].addr < r[j].addr })
+	return r
+}
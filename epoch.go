@@ -0,0 +1,137 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type deferredFree struct {
+	p     uintptr
+	epoch uint64
+}
+
+// Epochs implements epoch based reclamation for data structures read
+// concurrently with their modification, eg. lock-free ones. Readers pin the
+// current epoch while they may hold pointers into the structure. Memory
+// released by Allocator.DeferFree is recycled by Allocator.Advance only after
+// every reader pinned at the time of the release has unpinned.
+//
+// The zero value of Epochs is ready for use. It is safe for concurrent use.
+type Epochs struct {
+	epoch uint64 // Global epoch. First for 64 bit alignment.
+
+	mu      sync.Mutex
+	readers map[*EpochReader]struct{}
+}
+
+// EpochReader is a reader registered with Epochs. An EpochReader must be
+// used by one goroutine at a time.
+type EpochReader struct {
+	state uint64 // Pinned epoch<<1 | 1 when pinned, zero otherwise. First for 64 bit alignment.
+	e     *Epochs
+}
+
+// NewReader registers and returns a new reader.
+func (e *Epochs) NewReader() *EpochReader {
+	r := &EpochReader{e: e}
+	e.mu.Lock()
+	if e.readers == nil {
+		e.readers = map[*EpochReader]struct{}{}
+	}
+	e.readers[r] = struct{}{}
+	e.mu.Unlock()
+	return r
+}
+
+// Epoch returns the current global epoch.
+func (e *Epochs) Epoch() uint64 { return atomic.LoadUint64(&e.epoch) }
+
+// advance moves the global epoch forward if all pinned readers have observed
+// the current one and returns the global epoch.
+func (e *Epochs) advance() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	g := atomic.LoadUint64(&e.epoch)
+	for r := range e.readers {
+		if s := atomic.LoadUint64(&r.state); s&1 != 0 && s>>1 != g {
+			return g
+		}
+	}
+	atomic.StoreUint64(&e.epoch, g+1)
+	return g + 1
+}
+
+// Close unregisters r. It must not be pinned.
+func (r *EpochReader) Close() {
+	r.e.mu.Lock()
+	delete(r.e.readers, r)
+	r.e.mu.Unlock()
+}
+
+// Pin announces that r may hold pointers to memory released by DeferFree from
+// now on.
+func (r *EpochReader) Pin() {
+	for {
+		g := atomic.LoadUint64(&r.e.epoch)
+		atomic.StoreUint64(&r.state, g<<1|1)
+		if atomic.LoadUint64(&r.e.epoch) == g {
+			return
+		}
+	}
+}
+
+// Unpin announces that r no longer holds such pointers.
+func (r *EpochReader) Unpin() { atomic.StoreUint64(&r.state, 0) }
+
+// Advance tries to move the epoch of a.Epochs forward and frees the memory
+// released by DeferFree which no pinned reader can be using anymore. It
+// returns the number of allocations freed. Without a.Epochs all memory
+// released by DeferFree is freed.
+func (a *Allocator) Advance() (n int, err error) {
+	if len(a.deferred) == 0 {
+		return 0, nil
+	}
+
+	var g uint64
+	if a.Epochs != nil {
+		g = a.Epochs.advance()
+	}
+	w := 0
+	for _, v := range a.deferred {
+		if a.Epochs != nil && v.epoch+2 > g {
+			a.deferred[w] = v
+			w++
+			continue
+		}
+
+		if e := a.UintptrFree(v.p); e != nil && err == nil {
+			err = e
+		}
+		n++
+	}
+	a.deferred = a.deferred[:w]
+	return n, err
+}
+
+// DeferFree is like UintptrFree except the memory is only freed by a later
+// call of Advance, once no reader pinned by a.Epochs can be using it.
+func (a *Allocator) DeferFree(p uintptr) {
+	if p == 0 {
+		return
+	}
+
+	var g uint64
+	if a.Epochs != nil {
+		g = a.Epochs.Epoch()
+	}
+	a.deferred = append(a.deferred, deferredFree{p, g})
+}
+
+// Deferred returns the number of allocations released by DeferFree and not
+// yet freed.
+func (a *Allocator) Deferred() int { return len(a.deferred) }
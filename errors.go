@@ -0,0 +1,69 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors reported by the allocator. They are usually wrapped in an *Error,
+// use errors.Is to test for them.
+var (
+	ErrCorrupted      = errors.New("memory: heap corrupted")
+	ErrInvalidPointer = errors.New("memory: invalid pointer")
+	ErrInvalidSize    = errors.New("memory: invalid size")
+	ErrLimit          = errors.New("memory: limit exceeded")
+	ErrOOM            = errors.New("memory: out of memory")
+	ErrStale          = errors.New("memory: stale handle")
+	ErrTooLarge       = errors.New("memory: allocation too large")
+	ErrUnsupported    = errors.New("memory: not supported on this platform")
+)
+
+// Error describes a failed allocator operation.
+type Error struct {
+	Op   string  // Operation, eg. "malloc", "free" or "mmap".
+	Addr uintptr // Address involved, if any.
+	Size int     // Size involved, if any.
+	Kind error   // ErrCorrupted, ErrInvalidPointer, ErrOOM, ...
+	Err  error   // Underlying error, eg. a syscall.Errno, or nil.
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("memory: ")
+	b.WriteString(e.Op)
+	if e.Addr != 0 {
+		fmt.Fprintf(&b, " %#x", e.Addr)
+	}
+	if e.Size != 0 {
+		fmt.Fprintf(&b, " size %#x", e.Size)
+	}
+	if e.Kind != nil {
+		b.WriteString(": ")
+		b.WriteString(strings.TrimPrefix(e.Kind.Error(), "memory: "))
+	}
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+// Is reports whether target is e.Kind.
+func (e *Error) Is(target error) bool { return target == e.Kind }
+
+// Unwrap returns e.Err.
+func (e *Error) Unwrap() error { return e.Err }
+
+func (a *Allocator) invalidSize(op string, size int) error {
+	if !a.NoPanic {
+		panic("invalid " + op + " size")
+	}
+
+	return &Error{Op: op, Size: size, Kind: ErrInvalidSize}
+}
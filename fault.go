@@ -0,0 +1,31 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+// FailNthMmap returns a function suitable for Options.MmapFault which fails
+// the n-th request for memory from the OS, counting from 1, with err. All
+// other requests succeed.
+func FailNthMmap(n int, err error) func(size, mapped int) error {
+	return func(size, mapped int) error {
+		if n--; n == 0 {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// FailMmapAbove returns a function suitable for Options.MmapFault which fails
+// every request for memory from the OS with err if the request would bring
+// the number of mapped bytes above budget.
+func FailMmapAbove(budget int, err error) func(size, mapped int) error {
+	return func(size, mapped int) error {
+		if mapped+size > budget {
+			return err
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// fixedPoolBlocks is the minimum number of blocks of a FixedPool chunk.
+const fixedPoolBlocks = 64
+
+// FixedPool serves blocks of a single size carved from dedicated chunks,
+// whole pages allocated from an Allocator. Freed blocks are kept on a free
+// list of the pool and reused by later allocations. ReleaseAll frees all
+// blocks at once by freeing the chunks, in time proportional to their number,
+// which suits workloads creating many objects with a common lifetime.
+//
+// A FixedPool is not safe for concurrent use.
+type FixedPool struct {
+	a      *Allocator
+	brk    uintptr   // Next unused block of the last chunk.
+	chunks []uintptr // Allocated chunks.
+	end    uintptr   // End of the last chunk.
+	free   uintptr   // Free blocks, linked through their first word.
+	n      int       // Live blocks.
+	size   int
+}
+
+// NewFixedPool returns a FixedPool of blocks of blockSize bytes, rounded up to
+// a multiple of 16, allocating from a.
+func NewFixedPool(a *Allocator, blockSize int) (*FixedPool, error) {
+	if blockSize <= 0 || blockSize > maxMalloc/fixedPoolBlocks {
+		return nil, a.invalidSize("pool", blockSize)
+	}
+
+	return &FixedPool{a: a, size: roundup(blockSize, mallocAllign)}, nil
+}
+
+// BlockSize returns the size of the blocks of p.
+func (p *FixedPool) BlockSize() int { return p.size }
+
+// Len returns the number of live blocks of p.
+func (p *FixedPool) Len() int { return p.n }
+
+// Malloc returns a block of p. The contents of the block are undefined.
+func (p *FixedPool) Malloc() ([]byte, error) {
+	r, err := p.UintptrMalloc()
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(r)), p.size), nil
+}
+
+// UintptrMalloc is like Malloc except it returns an uintptr.
+func (p *FixedPool) UintptrMalloc() (r uintptr, err error) {
+	switch {
+	case p.free != 0:
+		r = p.free
+		p.free = *(*uintptr)(unsafe.Pointer(r))
+	case p.brk != p.end:
+		r = p.brk
+		p.brk += uintptr(p.size)
+	default:
+		// Whole pages, at least fixedPoolBlocks blocks.
+		size := p.a.pageSize() - headerSize
+		if n := fixedPoolBlocks * p.size; n > size {
+			size = n
+		}
+		c, err := p.a.UintptrMalloc(size)
+		if err != nil {
+			return 0, err
+		}
+
+		p.chunks = append(p.chunks, c)
+		r = c
+		p.brk = c + uintptr(p.size)
+		p.end = c + uintptr(p.a.UintptrUsableSize(c)/p.size*p.size)
+	}
+	p.n++
+	return r, nil
+}
+
+// UnsafeMalloc is like Malloc except it returns an unsafe.Pointer.
+func (p *FixedPool) UnsafeMalloc() (unsafe.Pointer, error) {
+	r, err := p.UintptrMalloc()
+	return unsafe.Pointer(r), err
+}
+
+// Free returns the block b, obtained from p, to p. Free of a nil slice is a
+// nop.
+func (p *FixedPool) Free(b []byte) {
+	if cap(b) != 0 {
+		p.UintptrFree(uintptr(unsafe.Pointer(&b[:1][0])))
+	}
+}
+
+// UintptrFree is like Free except its argument is an uintptr.
+func (p *FixedPool) UintptrFree(r uintptr) {
+	if r == 0 {
+		return
+	}
+
+	*(*uintptr)(unsafe.Pointer(r)) = p.free
+	p.free = r
+	p.n--
+}
+
+// UnsafeFree is like Free except its argument is an unsafe.Pointer.
+func (p *FixedPool) UnsafeFree(r unsafe.Pointer) { p.UintptrFree(uintptr(r)) }
+
+// ReleaseAll frees all blocks of p, live or not, by freeing the chunks of p
+// to its Allocator. The pool can be used again afterwards.
+func (p *FixedPool) ReleaseAll() (err error) {
+	for _, c := range p.chunks {
+		if e := p.a.UintptrFree(c); e != nil && err == nil {
+			err = e
+		}
+	}
+	p.chunks = p.chunks[:0]
+	p.brk, p.end, p.free, p.n = 0, 0, 0, 0
+	return err
+}
@@ -0,0 +1,91 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// Fragmentation reports memory held by an Allocator which is not available
+// to its users.
+type Fragmentation struct {
+	// Internal fragmentation is the difference between the usable and the
+	// requested sizes of live allocations. Requested and Internal are
+	// reported only when Options.TrackSizes is set, otherwise they are
+	// zero.
+	Requested int // Sum of requested sizes of live allocations.
+	Usable    int // Sum of usable sizes of live allocations.
+	Internal  int // Usable - Requested.
+
+	// External fragmentation is the memory in free slots of shared pages
+	// which cannot be returned to the OS because other slots of the same
+	// page are in use.
+	PartialPages int // Shared pages with both used and free slots.
+	FreeSlots    int // Free slots on PartialPages.
+	External     int // Size of FreeSlots in bytes.
+}
+
+// Fragmentation returns the current fragmentation of a. The cost is
+// proportional to the number of pages mapped by a.
+func (a *Allocator) Fragmentation() (r Fragmentation) {
+	r.Usable = int(a.allocated.Load() - a.freed.Load())
+	if a.TrackSizes {
+		r.Requested = a.requested
+		r.Internal = r.Usable - r.Requested
+	}
+	for _, pg := range a.regs {
+		if pg.log == 0 || pg.used == 0 {
+			continue
+		}
+
+		if free := a.cap[pg.log] - pg.used; free != 0 {
+			r.PartialPages++
+			r.FreeSlots += free
+			r.External += free << pg.log
+		}
+	}
+	return r
+}
+
+// RequestedSize reports the size requested for the memory block at p, which
+// must point to the first byte of a slice returned from Calloc, Malloc or
+// Realloc of a. Sizes are recorded only when Options.TrackSizes is set,
+// otherwise RequestedSize returns the same value as a.UsableSize.
+func (a *Allocator) RequestedSize(p *byte) int {
+	return a.UintptrRequestedSize(uintptr(unsafe.Pointer(p)))
+}
+
+// UintptrRequestedSize is like RequestedSize except its argument is an
+// uintptr, which must have been returned from UintptrCalloc, UintptrMalloc or
+// UintptrRealloc.
+func (a *Allocator) UintptrRequestedSize(p uintptr) int {
+	if n, ok := a.sizes[untag(p)]; ok {
+		return n
+	}
+
+	return a.UintptrUsableSize(p)
+}
+
+// UnsafeRequestedSize is like RequestedSize except its argument is an
+// unsafe.Pointer, which must have been returned from UnsafeCalloc,
+// UnsafeMalloc or UnsafeRealloc.
+func (a *Allocator) UnsafeRequestedSize(p unsafe.Pointer) int {
+	return a.UintptrRequestedSize(uintptr(p))
+}
+
+func (a *Allocator) trackSize(p uintptr, size int) {
+	if a.sizes == nil {
+		a.sizes = map[uintptr]int{}
+	}
+	a.sizes[p] = size
+	a.requested += size
+}
+
+func (a *Allocator) untrackSize(p uintptr) {
+	if n, ok := a.sizes[p]; ok {
+		a.requested -= n
+		delete(a.sizes, p)
+	}
+}
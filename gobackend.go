@@ -0,0 +1,61 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// GoBackend is a Backend carving mappings out of byte slices allocated from
+// the Go heap. It's intended for platforms and sandboxes where mmap or
+// VirtualAlloc are not available and it's the default backend on such
+// platforms. GoBackend keeps the slices reachable until they are unmapped.
+// The memory is still invisible to the Go garbage collector, it must not be
+// used to store Go pointers.
+//
+// Programs built with -race or -d=checkptr should not use GoBackend as the
+// pointer arithmetic of the allocator trips the checkptr instrumentation
+// when applied to Go heap memory.
+//
+// The zero value of GoBackend is ready for use. It is safe for concurrent
+// use.
+type GoBackend struct {
+	mu   sync.Mutex
+	maps map[uintptr][]byte
+}
+
+// Map implements Backend.
+func (b *GoBackend) Map(size, align int) (addr uintptr, n int, err error) {
+	if size <= 0 || size > maxMalloc {
+		return 0, 0, syscall.EINVAL
+	}
+
+	size = roundup(size, osPageSize)
+	buf := make([]byte, size+align)
+	p := uintptr(unsafe.Pointer(&buf[0]))
+	addr = (p + uintptr(align-1)) &^ uintptr(align-1)
+	b.mu.Lock()
+	if b.maps == nil {
+		b.maps = map[uintptr][]byte{}
+	}
+	b.maps[addr] = buf
+	b.mu.Unlock()
+	return addr, size, nil
+}
+
+// Unmap implements Backend.
+func (b *GoBackend) Unmap(addr uintptr, size int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.maps[addr]; !ok {
+		return syscall.EINVAL
+	}
+
+	delete(b.maps, addr)
+	return nil
+}
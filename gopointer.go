@@ -0,0 +1,102 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// CheckPointers reports an error if the value at p holds a pointer which does
+// not point into memory allocated by a. Such pointers usually refer to the Go
+// heap. The Go garbage collector does not see them when they are stored in
+// allocator memory and may free or move what they point to, which manifests
+// as random crashes much later.
+//
+// Nil pointers are accepted. Non-nil maps, channels, functions and interfaces
+// are always rejected, so are non-empty strings not backed by memory of a,
+// including string literals. Only the value itself is inspected, not the
+// memory its pointers refer to.
+//
+// CheckPointers uses reflection and is intended for debugging.
+func CheckPointers[T any](a *Allocator, p *T) error {
+	v := reflect.ValueOf(p).Elem()
+	if !hasPointers(v.Type()) {
+		return nil
+	}
+
+	return a.checkPointers(v, v.Type().String())
+}
+
+// Store checks v using CheckPointers and, if it holds no Go pointers, stores
+// it at dst, which must point into memory allocated by a.
+func Store[T any](a *Allocator, dst *T, v T) error {
+	if p := uintptr(unsafe.Pointer(dst)); !a.Contains(p) {
+		return &Error{Op: "store", Addr: p, Kind: ErrInvalidPointer}
+	}
+
+	if err := CheckPointers(a, &v); err != nil {
+		return err
+	}
+
+	*dst = v
+	return nil
+}
+
+func (a *Allocator) checkPointers(v reflect.Value, path string) error {
+	var p uintptr
+	switch v.Kind() {
+	case reflect.Array:
+		if !hasPointers(v.Type().Elem()) {
+			return nil
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			if err := a.checkPointers(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !hasPointers(t.Field(i).Type) {
+				continue
+			}
+
+			if err := a.checkPointers(v.Field(i), path+"."+t.Field(i).Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Pointer, reflect.UnsafePointer:
+		p = v.Pointer()
+	case reflect.Slice:
+		if v.Cap() == 0 {
+			return nil
+		}
+
+		p = v.Pointer()
+	case reflect.String:
+		s := v.String()
+		if s == "" {
+			return nil
+		}
+
+		p = uintptr(unsafe.Pointer(unsafe.StringData(s)))
+	default:
+		if v.IsNil() {
+			return nil
+		}
+
+		return &Error{Op: "store", Kind: ErrInvalidPointer, Err: fmt.Errorf("Go %s in %s", v.Kind(), path)}
+	}
+	if p == 0 || a.Contains(p) {
+		return nil
+	}
+
+	return &Error{Op: "store", Addr: p, Kind: ErrInvalidPointer, Err: fmt.Errorf("Go pointer in %s", path)}
+}
@@ -0,0 +1,186 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+const (
+	handleGenShift = 48 // Position of the generation in a Handle.
+	handleOffMask  = 1<<handleGenShift - 1
+)
+
+// Handle is a position independent reference to memory allocated by an
+// Allocator using an ArenaBackend. Its lower 48 bits are the offset of the
+// allocation from the arena base, so it remains valid when the arena contents
+// are persisted or shared and later appear at a different address. The zero
+// Handle refers to nothing, like a nil pointer.
+//
+// The top 16 bits of a Handle are the generation of its address, the number
+// of times, modulo 2^16, an allocation at that address was freed before the
+// Handle was taken. Resolving or freeing a Handle whose allocation was freed
+// fails, even when the address was reused in the meantime, instead of
+// aliasing the new allocation. The generations are kept by the ArenaBackend,
+// not in the arena contents. They count the frees by Allocators using the
+// ArenaBackend since its first Handle was taken, Handles of addresses not
+// freed since then are not checked.
+type Handle uint64
+
+// Handle returns the handle of p, which must be zero or point into b. Handle
+// returns zero for pointers outside of b.
+func (b *ArenaBackend) Handle(p uintptr) Handle {
+	if !b.Contains(p) {
+		return 0
+	}
+
+	b.handles.Store(true)
+	g, _ := b.gen(p)
+	return Handle(g<<handleGenShift | uint64(p-b.base))
+}
+
+// Resolve returns the address h refers to or zero if h is zero, out of the
+// range of b or stale.
+func (b *ArenaBackend) Resolve(h Handle) uintptr {
+	p, _ := b.resolve(h)
+	return p
+}
+
+// resolve is like Resolve and reports whether h is stale.
+func (b *ArenaBackend) resolve(h Handle) (p uintptr, stale bool) {
+	off := uint64(h) & handleOffMask
+	if h == 0 || off >= uint64(b.size) {
+		return 0, false
+	}
+
+	p = b.base + uintptr(off)
+	if g, ok := b.gen(p); ok && g != uint64(h)>>handleGenShift {
+		return 0, true
+	}
+
+	return p, false
+}
+
+// gen returns the generation of p and whether p was freed since b handed out
+// its first Handle.
+func (b *ArenaBackend) gen(p uintptr) (uint64, bool) {
+	if !b.handles.Load() {
+		return 0, false
+	}
+
+	b.mu.Lock()
+	g, ok := b.gens[p]
+	b.mu.Unlock()
+	return uint64(g), ok
+}
+
+// retire starts the next generation of p, which was freed.
+func (b *ArenaBackend) retire(p uintptr) {
+	b.mu.Lock()
+	if b.gens == nil {
+		b.gens = map[uintptr]uint16{}
+	}
+	b.gens[p]++
+	b.mu.Unlock()
+}
+
+func (a *Allocator) arena(op string) (*ArenaBackend, error) {
+	if b, ok := a.backend().(*ArenaBackend); ok {
+		return b, nil
+	}
+
+	return nil, &Error{Op: op, Kind: ErrUnsupported}
+}
+
+// HandleCalloc is like UintptrCalloc except it returns a Handle. The
+// Allocator must use an ArenaBackend.
+func (a *Allocator) HandleCalloc(size int) (Handle, error) {
+	b, err := a.arena("calloc")
+	if err != nil {
+		return 0, err
+	}
+
+	p, err := a.UintptrCalloc(size)
+	return b.Handle(p), err
+}
+
+// HandleFree is like UintptrFree except its argument is a Handle. The
+// Allocator must use an ArenaBackend.
+func (a *Allocator) HandleFree(h Handle) error {
+	b, err := a.arena("free")
+	if err != nil {
+		return err
+	}
+
+	if h == 0 {
+		return nil
+	}
+
+	p, stale := b.resolve(h)
+	switch {
+	case stale:
+		return &Error{Op: "free", Addr: uintptr(h), Kind: ErrStale}
+	case p == 0:
+		return &Error{Op: "free", Addr: uintptr(h), Kind: ErrInvalidPointer}
+	}
+
+	return a.UintptrFree(p)
+}
+
+// HandleMalloc is like UintptrMalloc except it returns a Handle. The
+// Allocator must use an ArenaBackend.
+func (a *Allocator) HandleMalloc(size int) (Handle, error) {
+	b, err := a.arena("malloc")
+	if err != nil {
+		return 0, err
+	}
+
+	p, err := a.UintptrMalloc(size)
+	return b.Handle(p), err
+}
+
+// HandleOf returns the Handle of p, which must have been acquired from a, or
+// zero if a doesn't use an ArenaBackend or p is not in its range.
+func (a *Allocator) HandleOf(p uintptr) Handle {
+	b, err := a.arena("handle")
+	if err != nil {
+		return 0
+	}
+
+	return b.Handle(p)
+}
+
+// HandleRealloc is like UintptrRealloc except its argument and result are
+// Handles. The Allocator must use an ArenaBackend.
+func (a *Allocator) HandleRealloc(h Handle, size int) (Handle, error) {
+	b, err := a.arena("realloc")
+	if err != nil {
+		return 0, err
+	}
+
+	var p uintptr
+	if h != 0 {
+		var stale bool
+		switch p, stale = b.resolve(h); {
+		case stale:
+			return 0, &Error{Op: "realloc", Addr: uintptr(h), Kind: ErrStale}
+		case p == 0:
+			return 0, &Error{Op: "realloc", Addr: uintptr(h), Kind: ErrInvalidPointer}
+		}
+	}
+
+	if p, err = a.UintptrRealloc(p, size); err != nil {
+		return 0, err
+	}
+
+	return b.Handle(p), nil
+}
+
+// Resolve returns the address h refers to or zero if h is zero, out of range,
+// stale or a doesn't use an ArenaBackend.
+func (a *Allocator) Resolve(h Handle) uintptr {
+	b, err := a.arena("resolve")
+	if err != nil {
+		return 0
+	}
+
+	return b.Resolve(h)
+}
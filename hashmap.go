@@ -0,0 +1,217 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"hash/maphash"
+	"reflect"
+	"unsafe"
+)
+
+type mapSlot[K comparable, V any] struct {
+	k K
+	v V
+}
+
+// Map is a hash map from K to V, like a Go map, stored entirely in memory of an
+// Allocator, so even huge maps do not add to the garbage collector work. It
+// uses open addressing with linear probing.
+//
+// Neither K nor V may contain Go pointers. Keys are hashed by their memory
+// representation, so K must also not contain padding or floating point
+// numbers. NewMap rejects such types.
+//
+// A Map must be released by Close.
+type Map[K comparable, V any] struct {
+	a     *Allocator
+	ctrl  []byte // Non zero for slots in use.
+	len   int
+	seed  maphash.Seed
+	slots []mapSlot[K, V]
+}
+
+// NewMap returns a Map allocating from a.
+func NewMap[K comparable, V any](a *Allocator) (*Map[K, V], error) {
+	kt := reflect.TypeOf((*K)(nil)).Elem()
+	if err := checkPointerFree(kt); err != nil {
+		return nil, err
+	}
+
+	if err := checkPointerFree(reflect.TypeOf((*V)(nil)).Elem()); err != nil {
+		return nil, err
+	}
+
+	if !isHashable(kt) {
+		return nil, fmt.Errorf("memory: type %v contains padding or floating point numbers", kt)
+	}
+
+	return &Map[K, V]{a: a, seed: maphash.MakeSeed()}, nil
+}
+
+// Close releases the memory of the map and resets it to be empty.
+func (m *Map[K, V]) Close() (err error) {
+	if len(m.slots) != 0 {
+		err = m.a.UnsafeFree(unsafe.Pointer(&m.ctrl[0]))
+	}
+	m.ctrl, m.slots, m.len = nil, nil, 0
+	return err
+}
+
+// Delete removes the entry of k, if any, and reports whether it was present.
+func (m *Map[K, V]) Delete(k K) bool {
+	i, ok := m.find(k)
+	if !ok {
+		return false
+	}
+
+	// Backward shift deletion, linear probing needs no tombstones.
+	mask := len(m.slots) - 1
+	for j := i; ; {
+		j = (j + 1) & mask
+		if m.ctrl[j] == 0 {
+			break
+		}
+
+		if h := m.hash(m.slots[j].k) & mask; (j-h)&mask >= (j-i)&mask {
+			m.slots[i] = m.slots[j]
+			i = j
+		}
+	}
+	m.ctrl[i] = 0
+	m.slots[i] = mapSlot[K, V]{}
+	m.len--
+	return true
+}
+
+// Get returns the value of k and whether it was present.
+func (m *Map[K, V]) Get(k K) (v V, ok bool) {
+	if i, ok := m.find(k); ok {
+		return m.slots[i].v, true
+	}
+
+	return v, false
+}
+
+// Len returns the number of entries in the map.
+func (m *Map[K, V]) Len() int { return m.len }
+
+// Put sets the value of k to v.
+func (m *Map[K, V]) Put(k K, v V) error {
+	if i, ok := m.find(k); ok {
+		m.slots[i].v = v
+		return nil
+	}
+
+	if err := m.Reserve(m.len + 1); err != nil {
+		return err
+	}
+
+	m.insert(k, v)
+	m.len++
+	return nil
+}
+
+// Range calls f for every entry of the map in unspecified order until f
+// returns false. The map must not be modified by f.
+func (m *Map[K, V]) Range(f func(k K, v V) bool) {
+	for i, c := range m.ctrl {
+		if c != 0 && !f(m.slots[i].k, m.slots[i].v) {
+			return
+		}
+	}
+}
+
+// Reserve grows the map, if necessary, to hold n entries without further
+// growing.
+func (m *Map[K, V]) Reserve(n int) error {
+	if n < 0 {
+		return m.a.invalidSize("reserve", n)
+	}
+
+	if 4*n <= 3*len(m.slots) {
+		return nil
+	}
+
+	c := 8
+	for 4*n > 3*c {
+		if c > maxMalloc/(int(unsafe.Sizeof(mapSlot[K, V]{}))+1)/2 {
+			return &Error{Op: "reserve", Size: n, Kind: ErrOOM}
+		}
+
+		c <<= 1
+	}
+	ctrl, slots := m.ctrl, m.slots
+	sz := int(unsafe.Sizeof(mapSlot[K, V]{}))
+	p, err := m.a.UnsafeCalloc(roundup(c, mallocAllign) + c*sz)
+	if err != nil {
+		return err
+	}
+
+	m.ctrl = unsafe.Slice((*byte)(p), c)
+	m.slots = unsafe.Slice((*mapSlot[K, V])(unsafe.Add(p, roundup(c, mallocAllign))), c)
+	for i, c := range ctrl {
+		if c != 0 {
+			m.insert(slots[i].k, slots[i].v)
+		}
+	}
+	if len(slots) != 0 {
+		return m.a.UnsafeFree(unsafe.Pointer(&ctrl[0]))
+	}
+
+	return nil
+}
+
+func (m *Map[K, V]) find(k K) (int, bool) {
+	if m.len == 0 {
+		return 0, false
+	}
+
+	mask := len(m.slots) - 1
+	for i := m.hash(k) & mask; m.ctrl[i] != 0; i = (i + 1) & mask {
+		if m.slots[i].k == k {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (m *Map[K, V]) hash(k K) int {
+	return int(maphash.Bytes(m.seed, unsafe.Slice((*byte)(unsafe.Pointer(&k)), unsafe.Sizeof(k))))
+}
+
+func (m *Map[K, V]) insert(k K, v V) {
+	mask := len(m.slots) - 1
+	i := m.hash(k) & mask
+	for m.ctrl[i] != 0 {
+		i = (i + 1) & mask
+	}
+	m.ctrl[i] = 1
+	m.slots[i] = mapSlot[K, V]{k, v}
+}
+
+// isHashable reports whether values of t are equal iff their memory
+// representations are. Blank struct fields do not take part in comparisons.
+func isHashable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return t.Len() == 0 || isHashable(t.Elem())
+	case reflect.Struct:
+		var off uintptr
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Name == "_" || f.Offset != off || !isHashable(f.Type) {
+				return false
+			}
+
+			off += f.Type.Size()
+		}
+		return off == t.Size()
+	default:
+		return true
+	}
+}
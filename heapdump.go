@@ -0,0 +1,314 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"unsafe"
+)
+
+// Heap dump format, all integers are little endian:
+//
+//	header		dumpHeader
+//	pages		header.Pages times dumpPage, including headerless
+//			blocks and LargeCache pages, each followed by
+//			dumpPage.Size bytes of the page when dumpContents is set
+//	lists		uint32 number of non-empty free lists, then for each
+//			uint32 size class, uint64 length, length times uint64
+//			slot address in free list order
+const (
+	dumpMagic   = "MEMHEAP\x00"
+	dumpVersion = 2
+
+	dumpContents = 1 // dumpHeader.Flags: page contents follow dumpPage.
+
+	// dumpPage.Kind values. Version 1 dumps have only dumpPageRegistered.
+	dumpPageRegistered = 0
+	dumpPageBare       = 1
+	dumpPageCached     = 2
+)
+
+type dumpHeader struct {
+	Magic          [8]byte
+	Version        uint32
+	Flags          uint32
+	PageSize       uint64
+	HeaderSize     uint64
+	Allocs         uint64
+	Bytes          uint64
+	Mmaps          uint64
+	Mallocs        uint64
+	Frees          uint64
+	Reallocs       uint64
+	BytesAllocated uint64
+	BytesFreed     uint64
+	Pages          uint64
+}
+
+type dumpPage struct {
+	Addr uint64
+	Size uint64
+	Log  uint32
+	Kind uint32
+	Brk  uint64
+	Used uint64
+}
+
+// HeapDump is a heap dump read by ReadHeapDump.
+type HeapDump struct {
+	PageSize   int          // Allocator page size of the dumped process.
+	HeaderSize int          // Page header size of the dumped process.
+	Stats      Stats        // Allocator statistics at the time of the dump.
+	Pages      []DumpPage   // Pages, headerless blocks and cached pages ordered by address.
+	Lists      [64][]uint64 // Free list slot addresses, indexed by size class.
+}
+
+// DumpPage describes a page in a HeapDump.
+type DumpPage struct {
+	Addr uint64 // Address of the page in the dumped process.
+	Size int    // Size of the mapping.
+	Log  uint   // Size class, zero for dedicated pages.
+	Brk  int    // Number of slots ever handed out, shared pages only.
+	Used int    // Number of slots in use, shared pages only.
+	Data []byte // Page contents including its header, if dumped.
+
+	Bare   bool // A headerless block, see Options.Headerless.
+	Cached bool // A freed page kept in the LargeCache.
+}
+
+// DumpHeap writes the page headers and free lists of a to w in a binary
+// format, readable by ReadHeapDump. Headerless blocks and LargeCache pages are
+// included as pages of their own kind, so the pages add up to Stats.Bytes. If
+// contents is true, the contents of all pages are included as well, which is
+// not supported while a has headerless blocks.
+func (a *Allocator) DumpHeap(w io.Writer, contents bool) error {
+	if contents && (a.tagging() || len(a.bare) != 0) {
+		return &Error{Op: "dump", Kind: ErrUnsupported}
+	}
+
+	b := bufio.NewWriter(w)
+	pages := a.dumpPages()
+	s := a.Stats()
+	h := dumpHeader{
+		Version:        dumpVersion,
+		PageSize:       uint64(a.pageSize()),
+		HeaderSize:     uint64(headerSize),
+		Allocs:         uint64(s.Allocs),
+		Bytes:          uint64(s.Bytes),
+		Mmaps:          uint64(s.Mmaps),
+		Mallocs:        s.Mallocs,
+		Frees:          s.Frees,
+		Reallocs:       s.Reallocs,
+		BytesAllocated: s.BytesAllocated,
+		BytesFreed:     s.BytesFreed,
+		Pages:          uint64(len(pages)),
+	}
+	copy(h.Magic[:], dumpMagic)
+	if contents {
+		h.Flags |= dumpContents
+	}
+	if err := binary.Write(b, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+
+	for _, v := range pages {
+		pg := v.pg
+		p := dumpPage{
+			Addr: uint64(v.addr),
+			Size: uint64(v.size),
+			Kind: v.kind,
+		}
+		if v.kind == dumpPageRegistered {
+			p.Log, p.Brk, p.Used = uint32(pg.log), uint64(pg.brk), uint64(pg.used)
+		}
+		if err := binary.Write(b, binary.LittleEndian, &p); err != nil {
+			return err
+		}
+
+		if contents {
+			if sanEnabled {
+				sanUnpoisonPage(pg)
+			}
+			_, err := b.Write(unsafe.Slice((*byte)(unsafe.Pointer(pg)), pg.size))
+			if sanEnabled {
+				sanPoisonFree(pg)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	var n uint32
+	for _, l := range a.lists {
+		if l != nil {
+			n++
+		}
+	}
+	if err := binary.Write(b, binary.LittleEndian, n); err != nil {
+		return err
+	}
+
+	for log, l := range a.lists {
+		if l == nil {
+			continue
+		}
+
+		if err := binary.Write(b, binary.LittleEndian, uint32(log)); err != nil {
+			return err
+		}
+
+		if err := binary.Write(b, binary.LittleEndian, uint64(a.listLen(uint(log)))); err != nil {
+			return err
+		}
+
+		for pg := l; pg != nil; pg = pg.next {
+			for x := pg.free; x != nil; x = x.next {
+				if err := binary.Write(b, binary.LittleEndian, uint64(uintptr(unsafe.Pointer(x)))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return b.Flush()
+}
+
+// dumpedPage is a page, headerless block or cached page written by DumpHeap.
+type dumpedPage struct {
+	addr uintptr
+	size int
+	kind uint32
+	pg   *page // The page at addr, if kind is not dumpPageBare.
+}
+
+// dumpPages returns the pages, headerless blocks and cached pages of a ordered
+// by address.
+func (a *Allocator) dumpPages() (r []dumpedPage) {
+	for _, pg := range a.sortedPages() {
+		r = append(r, dumpedPage{uintptr(unsafe.Pointer(pg)), pg.size, dumpPageRegistered, pg})
+	}
+	for _, v := range a.unregistered() {
+		d := dumpedPage{v.addr, v.size, dumpPageBare, nil}
+		if v.cached {
+			d.kind, d.pg = dumpPageCached, (*page)(unsafe.Pointer(v.addr))
+		}
+		r = append(r, d)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].addr < r[j].addr })
+	return r
+}
+
+// ReadHeapDump reads a heap dump written by DumpHeap.
+func ReadHeapDump(r io.Reader) (*HeapDump, error) {
+	b := bufio.NewReader(r)
+	var h dumpHeader
+	if err := binary.Read(b, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+
+	if string(h.Magic[:]) != dumpMagic {
+		return nil, fmt.Errorf("memory: not a heap dump")
+	}
+
+	if h.Version == 0 || h.Version > dumpVersion {
+		return nil, fmt.Errorf("memory: unsupported heap dump version %v", h.Version)
+	}
+
+	d := &HeapDump{
+		PageSize:   int(h.PageSize),
+		HeaderSize: int(h.HeaderSize),
+		Stats: Stats{
+			Allocs:         int(h.Allocs),
+			Bytes:          int(h.Bytes),
+			Mmaps:          int(h.Mmaps),
+			Mallocs:        h.Mallocs,
+			Frees:          h.Frees,
+			Reallocs:       h.Reallocs,
+			BytesAllocated: h.BytesAllocated,
+			BytesFreed:     h.BytesFreed,
+		},
+	}
+	for i := uint64(0); i < h.Pages; i++ {
+		var p dumpPage
+		if err := binary.Read(b, binary.LittleEndian, &p); err != nil {
+			return nil, err
+		}
+
+		if p.Log >= 64 || p.Size > h.Bytes || p.Kind > dumpPageCached {
+			return nil, fmt.Errorf("memory: invalid heap dump page %#x", p.Addr)
+		}
+
+		pg := DumpPage{Addr: p.Addr, Size: int(p.Size), Log: uint(p.Log), Brk: int(p.Brk), Used: int(p.Used), Bare: p.Kind == dumpPageBare, Cached: p.Kind == dumpPageCached}
+		if h.Flags&dumpContents != 0 {
+			pg.Data = make([]byte, p.Size)
+			if _, err := io.ReadFull(b, pg.Data); err != nil {
+				return nil, err
+			}
+		}
+		d.Pages = append(d.Pages, pg)
+	}
+	var n uint32
+	if err := binary.Read(b, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+
+	for ; n != 0; n-- {
+		var log uint32
+		var cnt uint64
+		if err := binary.Read(b, binary.LittleEndian, &log); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(b, binary.LittleEndian, &cnt); err != nil {
+			return nil, err
+		}
+
+		if log >= 64 || cnt > h.Bytes {
+			return nil, fmt.Errorf("memory: invalid heap dump free list")
+		}
+
+		l := make([]uint64, cnt)
+		if err := binary.Read(b, binary.LittleEndian, l); err != nil {
+			return nil, err
+		}
+
+		d.Lists[log] = l
+	}
+	return d, nil
+}
+
+// Page returns the page containing addr or nil if there's no such page in d.
+func (d *HeapDump) Page(addr uint64) *DumpPage {
+	lo, hi := 0, len(d.Pages)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		switch pg := &d.Pages[m]; {
+		case addr < pg.Addr:
+			hi = m
+		case addr >= pg.Addr+uint64(pg.Size):
+			lo = m + 1
+		default:
+			return pg
+		}
+	}
+	return nil
+}
+
+// FreeSlots returns the number of free list entries residing on pg.
+func (d *HeapDump) FreeSlots(pg *DumpPage) (r int) {
+	if pg.Log == 0 {
+		return 0
+	}
+
+	for _, v := range d.Lists[pg.Log] {
+		if v >= pg.Addr && v < pg.Addr+uint64(pg.Size) {
+			r++
+		}
+	}
+	return r
+}
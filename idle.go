@@ -0,0 +1,80 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sync"
+	"time"
+)
+
+// TrimIdle unmaps the pages of the LargeCache and the empty pages retained due
+// to Options.RetainEmpty which were not reused for at least idle and returns
+// the number of bytes released. Unlike Trim it keeps the recently freed pages,
+// which are likely to be reused soon.
+func (a *Allocator) TrimIdle(idle time.Duration) (n int, err error) {
+	now := time.Now()
+	for len(a.cache) != 0 && now.Sub(a.cache[0].t) >= idle {
+		n += a.cache[0].pg.size
+		if e := a.evictPage(); e != nil && err == nil {
+			err = e
+		}
+	}
+	for log, pg := range a.empty {
+		if pg != nil && now.Sub(a.emptyAt[log]) >= idle {
+			n += pg.size
+			if e := a.dropEmpty(uint(log)); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return n, err
+}
+
+// Trimmer is a background goroutine calling Allocator.TrimIdle periodically,
+// see StartTrimmer.
+type Trimmer struct {
+	done chan struct{}
+	err  error // First error of TrimIdle.
+	once sync.Once
+	stop chan struct{}
+}
+
+// StartTrimmer starts a goroutine calling TrimIdle(idle) every interval, which
+// keeps the memory mapped by a close to its live allocations after bursts of
+// activity. An Allocator is not safe for concurrent use, so the goroutine
+// holds mu while trimming. All other uses of a must hold mu as well. The
+// goroutine runs until Stop is called, which must happen before a is closed.
+func (a *Allocator) StartTrimmer(mu sync.Locker, interval, idle time.Duration) *Trimmer {
+	t := &Trimmer{done: make(chan struct{}), stop: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-tick.C:
+				mu.Lock()
+				_, err := a.TrimIdle(idle)
+				mu.Unlock()
+				if err != nil && t.err == nil {
+					t.err = err
+				}
+			}
+		}
+	}()
+	return t
+}
+
+// Stop stops the goroutine of t, waits for it to finish and returns the first
+// error reported by TrimIdle, if any. Stop may be called more than once.
+func (t *Trimmer) Stop() error {
+	t.once.Do(func() { close(t.stop) })
+	<-t.done
+	return t.err
+}
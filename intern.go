@@ -0,0 +1,209 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"hash/maphash"
+	"unsafe"
+)
+
+const internChunk = 1<<16 - 64 // Size of the blocks strings are carved from.
+
+// Symbol identifies a string interned by an Interner. The zero Symbol
+// identifies nothing.
+type Symbol uint32
+
+type internEntry struct {
+	p    uintptr
+	n    int
+	hash uint64
+}
+
+// Interner is a table of deduplicated strings in memory of an Allocator, for
+// symbol tables and column stores with millions of small strings. The strings
+// are packed into large blocks and never move, so the strings returned by
+// String remain valid until the Interner is closed.
+//
+// An Interner must be released by Close.
+type Interner struct {
+	a       *Allocator
+	blocks  *Vector[uintptr]
+	entries *Vector[internEntry] // Indexed by Symbol-1.
+	free    int                  // Free bytes in the current block.
+	next    uintptr              // Next free byte in the current block.
+	seed    maphash.Seed
+	table   *Vector[Symbol] // Open addressing hash table.
+}
+
+// NewInterner returns an Interner allocating from a.
+func NewInterner(a *Allocator) *Interner {
+	in := &Interner{a: a, seed: maphash.MakeSeed()}
+	in.blocks, _ = NewVector[uintptr](a)
+	in.entries, _ = NewVector[internEntry](a)
+	in.table, _ = NewVector[Symbol](a)
+	return in
+}
+
+// Close releases all memory of the Interner. Strings returned by String must
+// not be used afterwards.
+func (in *Interner) Close() (err error) {
+	for _, p := range in.blocks.Slice() {
+		if e := in.a.UintptrFree(p); e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, v := range []interface{ Close() error }{in.blocks, in.entries, in.table} {
+		if e := v.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	in.free, in.next = 0, 0
+	return err
+}
+
+// Intern returns the Symbol of s, adding s to the table if it's not yet there.
+func (in *Interner) Intern(s string) (Symbol, error) {
+	h := maphash.String(in.seed, s)
+	if sym, i := in.lookup(s, h); sym != 0 {
+		return sym, nil
+	} else if 4*(in.entries.Len()+1) <= 3*in.table.Len() {
+		return in.add(s, h, i)
+	}
+
+	if err := in.grow(); err != nil {
+		return 0, err
+	}
+
+	_, i := in.lookup(s, h)
+	return in.add(s, h, i)
+}
+
+// InternBytes is like Intern except its argument is a byte slice.
+func (in *Interner) InternBytes(b []byte) (Symbol, error) {
+	return in.Intern(unsafe.String(unsafe.SliceData(b), len(b)))
+}
+
+// Len returns the number of strings in the table.
+func (in *Interner) Len() int { return in.entries.Len() }
+
+// Lookup returns the Symbol of s, if s is in the table.
+func (in *Interner) Lookup(s string) (Symbol, bool) {
+	sym, _ := in.lookup(s, maphash.String(in.seed, s))
+	return sym, sym != 0
+}
+
+// String returns the string identified by sym. The string is backed by memory
+// of the Interner and valid until the Interner is closed.
+func (in *Interner) String(sym Symbol) string {
+	e := in.entries.At(int(sym) - 1)
+	return unsafe.String((*byte)(unsafe.Pointer(e.p)), e.n)
+}
+
+func (in *Interner) add(s string, h uint64, i int) (Symbol, error) {
+	p, err := in.store(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := in.entries.Append(internEntry{p, len(s), h}); err != nil {
+		return 0, err
+	}
+
+	sym := Symbol(in.entries.Len())
+	in.table.Set(i, sym)
+	return sym, nil
+}
+
+func (in *Interner) grow() error {
+	n := 2 * in.table.Len()
+	if n == 0 {
+		n = 64
+	}
+	t, err := NewVector[Symbol](in.a)
+	if err != nil {
+		return err
+	}
+
+	if err := t.Reserve(n); err != nil {
+		return err
+	}
+
+	t.s = t.s[:n]
+	for i := range t.s {
+		t.s[i] = 0
+	}
+	for j, e := range in.entries.Slice() {
+		for i := int(e.hash) & (n - 1); ; i = (i + 1) & (n - 1) {
+			if t.s[i] == 0 {
+				t.s[i] = Symbol(j + 1)
+				break
+			}
+		}
+	}
+	in.table.Close()
+	in.table = t
+	return nil
+}
+
+// lookup returns the Symbol of s or zero and the table index where s belongs.
+func (in *Interner) lookup(s string, h uint64) (Symbol, int) {
+	n := in.table.Len()
+	if n == 0 {
+		return 0, 0
+	}
+
+	for i := int(h) & (n - 1); ; i = (i + 1) & (n - 1) {
+		sym := in.table.At(i)
+		if sym == 0 {
+			return 0, i
+		}
+
+		if e := in.entries.At(int(sym) - 1); e.hash == h && e.n == len(s) && unsafe.String((*byte)(unsafe.Pointer(e.p)), e.n) == s {
+			return sym, i
+		}
+	}
+}
+
+// store copies s to the current block or to an allocation of its own if it's
+// large.
+func (in *Interner) store(s string) (uintptr, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+
+	if len(s) > internChunk/4 {
+		p, err := in.a.UintptrMalloc(len(s))
+		if err != nil {
+			return 0, err
+		}
+
+		if err := in.blocks.Append(p); err != nil {
+			in.a.UintptrFree(p)
+			return 0, err
+		}
+
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(p)), len(s)), s)
+		return p, nil
+	}
+
+	if in.free < len(s) {
+		p, err := in.a.UintptrMalloc(internChunk)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := in.blocks.Append(p); err != nil {
+			in.a.UintptrFree(p)
+			return 0, err
+		}
+
+		in.next, in.free = p, internChunk
+	}
+	p := in.next
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(p)), len(s)), s)
+	in.next += uintptr(len(s))
+	in.free -= len(s)
+	return p, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// Iovec is a set of buffers carved from a single allocation, see MallocIovec.
+type Iovec struct {
+	// Bufs are the buffers, in the order of the requested sizes. Every
+	// buffer starts at a 16 byte boundary and its capacity equals its
+	// length. Bufs can be passed to readv/writev style APIs, eg. as
+	// net.Buffers, which consumes the slice, so pass a copy if the Iovec is
+	// to be reused.
+	Bufs [][]byte
+
+	a *Allocator
+	p uintptr
+}
+
+// MallocIovec allocates buffers of the given sizes in a single allocation,
+// paying the allocation cost and the rounding to a size class only once. The
+// buffers are freed together by Iovec.Free. The memory is not initialized.
+func (a *Allocator) MallocIovec(sizes ...int) (r Iovec, err error) {
+	total := 0
+	for _, size := range sizes {
+		if size < 0 {
+			return r, a.invalidSize("malloc", size)
+		}
+
+		if size > a.maxSize()-total {
+			return r, &Error{Op: "malloc", Size: size, Kind: ErrOOM}
+		}
+
+		total += roundup(size, mallocAllign)
+	}
+	p, err := a.UintptrMalloc(total)
+	if err != nil {
+		return r, err
+	}
+
+	r = Iovec{Bufs: make([][]byte, len(sizes)), a: a, p: p}
+	off := uintptr(0)
+	for i, size := range sizes {
+		if size != 0 {
+			r.Bufs[i] = unsafe.Slice((*byte)(unsafe.Pointer(p+off)), size)
+		}
+		off += uintptr(roundup(size, mallocAllign))
+	}
+	return r, nil
+}
+
+// Len returns the sum of the lengths of v.Bufs.
+func (v *Iovec) Len() (r int) {
+	for _, b := range v.Bufs {
+		r += len(b)
+	}
+	return r
+}
+
+// Free frees all buffers of v and sets v.Bufs to nil. Calling Free of a zero
+// Iovec or more than once is a no-op.
+func (v *Iovec) Free() error {
+	if v.a == nil {
+		return nil
+	}
+
+	a, p := v.a, v.p
+	*v = Iovec{}
+	return a.UintptrFree(p)
+}
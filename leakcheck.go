@@ -0,0 +1,29 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+)
+
+// Leaks returns an error if a has any live allocations or OS mappings other
+// than the pages it keeps for reuse, see Options.LargeCache and
+// Options.RetainEmpty. See also memorytest.CheckLeaks.
+func (a *Allocator) Leaks() error {
+	// Cached and retained pages are not leaks.
+	mmaps, bytes, regs := len(a.cache), a.cacheBytes, 0
+	for _, pg := range a.empty {
+		if pg != nil {
+			mmaps++
+			bytes += pg.size
+			regs++
+		}
+	}
+	if s := a.Stats(); s.Allocs != 0 || s.Mmaps != mmaps || s.Bytes != bytes || len(a.regs) != regs {
+		return fmt.Errorf("memory: leaked %v allocations, %v mappings, %v bytes", s.Allocs, s.Mmaps, s.Bytes)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+)
+
+// CheckLeaks is memorytest.CheckLeaks, which the tests of this package cannot
+// import.
+func CheckLeaks(t testing.TB, a *Allocator) {
+	t.Helper()
+	t.Cleanup(func() {
+		if err := a.Leaks(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"math/bits"
+	"time"
+)
+
+var lifeEpoch = time.Now()
+
+// Lifetimes is a histogram of the lifetimes of sampled allocations, see
+// Options.LifetimeSample. Short lived allocations are candidates for an
+// arena, a Mark or a Pool, long lived ones are best left to the general
+// allocator.
+type Lifetimes struct {
+	// Counts[i] is the number of sampled allocations freed after living
+	// at least 1<<i>>1 and less than 1<<i nanoseconds.
+	Counts [64]uint64
+	Live   int // Sampled allocations not freed yet.
+}
+
+// Bucket returns the range of lifetimes counted by Counts[i].
+func (l *Lifetimes) Bucket(i int) (lo, hi time.Duration) {
+	return time.Duration(uint64(1) << i >> 1), time.Duration(uint64(1)<<i - 1)
+}
+
+// Lifetimes returns the lifetime histogram of the allocations of a sampled so
+// far. Allocations released by Reset are not counted.
+func (a *Allocator) Lifetimes() Lifetimes {
+	r := a.lives
+	r.Live = len(a.born)
+	return r
+}
+
+func (a *Allocator) sampleLifetime(p uintptr) {
+	if a.lifeN++; a.lifeN < a.LifetimeSample {
+		return
+	}
+
+	a.lifeN = 0
+	if a.born == nil {
+		a.born = map[uintptr]int64{}
+	}
+	a.born[p] = int64(time.Since(lifeEpoch))
+}
+
+func (a *Allocator) recordLifetime(p uintptr) {
+	t, ok := a.born[p]
+	if !ok {
+		return
+	}
+
+	delete(a.born, p)
+	d := int64(time.Since(lifeEpoch)) - t
+	if d < 0 {
+		d = 0
+	}
+	a.lives.Counts[bits.Len64(uint64(d))]++
+}
@@ -0,0 +1,157 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// LimitedAllocator is an Allocator which deterministically fails
+// allocations with ErrOOM after MaxAllocs allocations or after allocating
+// MaxBytes bytes, whichever comes first. The limits are cumulative, freeing
+// memory does not lift them. A zero limit means no limit. The failing
+// requests never reach the OS. It's intended for testing out-of-memory
+// handling. Its zero value is ready for use.
+//
+// Only the Calloc, Malloc and Realloc families of methods are limited.
+type LimitedAllocator struct {
+	Allocator
+	MaxAllocs int // Maximum number of allocations.
+	MaxBytes  int // Maximum number of bytes requested.
+
+	nallocs int
+	nbytes  int
+}
+
+func (a *LimitedAllocator) check(size int) error {
+	if size <= 0 {
+		return nil
+	}
+
+	if a.MaxAllocs > 0 && a.nallocs >= a.MaxAllocs || a.MaxBytes > 0 && a.nbytes+size > a.MaxBytes {
+		return &Error{Op: "malloc", Size: size, Kind: ErrOOM}
+	}
+
+	return nil
+}
+
+func (a *LimitedAllocator) account(size int, err error) {
+	if size > 0 && err == nil {
+		a.nallocs++
+		a.nbytes += size
+	}
+}
+
+// Allocs returns the number of allocations counted against the limits of a
+// so far.
+func (a *LimitedAllocator) Allocs() int { return a.nallocs }
+
+// Bytes returns the number of bytes counted against the limits of a so far.
+func (a *LimitedAllocator) Bytes() int { return a.nbytes }
+
+// Calloc is like Allocator.Calloc but subject to the limits of a.
+func (a *LimitedAllocator) Calloc(size int) (r []byte, err error) {
+	if err = a.check(size); err != nil {
+		return nil, err
+	}
+
+	r, err = a.Allocator.Calloc(size)
+	a.account(size, err)
+	return r, err
+}
+
+// Malloc is like Allocator.Malloc but subject to the limits of a.
+func (a *LimitedAllocator) Malloc(size int) (r []byte, err error) {
+	if err = a.check(size); err != nil {
+		return nil, err
+	}
+
+	r, err = a.Allocator.Malloc(size)
+	a.account(size, err)
+	return r, err
+}
+
+// Realloc is like Allocator.Realloc but subject to the limits of a.
+func (a *LimitedAllocator) Realloc(b []byte, size int) (r []byte, err error) {
+	if err = a.check(size); err != nil {
+		return nil, err
+	}
+
+	r, err = a.Allocator.Realloc(b, size)
+	a.account(size, err)
+	return r, err
+}
+
+// UintptrCalloc is like Allocator.UintptrCalloc but subject to the limits of
+// a.
+func (a *LimitedAllocator) UintptrCalloc(size int) (r uintptr, err error) {
+	if err = a.check(size); err != nil {
+		return 0, err
+	}
+
+	r, err = a.Allocator.UintptrCalloc(size)
+	a.account(size, err)
+	return r, err
+}
+
+// UintptrMalloc is like Allocator.UintptrMalloc but subject to the limits of
+// a.
+func (a *LimitedAllocator) UintptrMalloc(size int) (r uintptr, err error) {
+	if err = a.check(size); err != nil {
+		return 0, err
+	}
+
+	r, err = a.Allocator.UintptrMalloc(size)
+	a.account(size, err)
+	return r, err
+}
+
+// UintptrRealloc is like Allocator.UintptrRealloc but subject to the limits
+// of a.
+func (a *LimitedAllocator) UintptrRealloc(p uintptr, size int) (r uintptr, err error) {
+	if err = a.check(size); err != nil {
+		return 0, err
+	}
+
+	r, err = a.Allocator.UintptrRealloc(p, size)
+	a.account(size, err)
+	return r, err
+}
+
+// UnsafeCalloc is like Allocator.UnsafeCalloc but subject to the limits of
+// a.
+func (a *LimitedAllocator) UnsafeCalloc(size int) (r unsafe.Pointer, err error) {
+	if err = a.check(size); err != nil {
+		return nil, err
+	}
+
+	r, err = a.Allocator.UnsafeCalloc(size)
+	a.account(size, err)
+	return r, err
+}
+
+// UnsafeMalloc is like Allocator.UnsafeMalloc but subject to the limits of
+// a.
+func (a *LimitedAllocator) UnsafeMalloc(size int) (r unsafe.Pointer, err error) {
+	if err = a.check(size); err != nil {
+		return nil, err
+	}
+
+	r, err = a.Allocator.UnsafeMalloc(size)
+	a.account(size, err)
+	return r, err
+}
+
+// UnsafeRealloc is like Allocator.UnsafeRealloc but subject to the limits
+// of a.
+func (a *LimitedAllocator) UnsafeRealloc(p unsafe.Pointer, size int) (r unsafe.Pointer, err error) {
+	if err = a.check(size); err != nil {
+		return nil, err
+	}
+
+	r, err = a.Allocator.UnsafeRealloc(p, size)
+	a.account(size, err)
+	return r, err
+}
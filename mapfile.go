@@ -0,0 +1,105 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"os"
+	"unsafe"
+)
+
+// File mapping modes.
+const (
+	MapRead  = iota // The mapping is read only.
+	MapWrite        // Changes of the mapping are written to the file.
+	MapCopy         // Changes of the mapping are private to it.
+)
+
+// MMap is a mapping of a region of a file.
+type MMap struct {
+	b    []byte // The whole mapping, starting at an aligned offset.
+	data []byte // The requested region.
+	f    *os.File
+	mode int
+}
+
+// MapFile maps the whole file f using mode, one of MapRead, MapWrite or
+// MapCopy.
+func MapFile(f *os.File, mode int) (*MMap, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.Size() > int64(maxMalloc) {
+		return nil, &Error{Op: "map", Kind: ErrInvalidSize}
+	}
+
+	return MapFileRegion(f, 0, int(fi.Size()), mode)
+}
+
+// MapFileRegion maps size bytes of f starting at offset off using mode, one of
+// MapRead, MapWrite or MapCopy. The offset need not be aligned. The file
+// should stay open while the mapping is flushed, on some platforms Flush
+// syncs the file.
+func MapFileRegion(f *os.File, off int64, size, mode int) (*MMap, error) {
+	if size <= 0 || size > maxMalloc || off < 0 {
+		return nil, &Error{Op: "map", Size: size, Kind: ErrInvalidSize}
+	}
+
+	delta := int(off % int64(fileMapAlign))
+	b, err := mapFile(f, off-int64(delta), size+delta, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MMap{b: b, data: b[delta : delta+size : delta+size], f: f, mode: mode}, nil
+}
+
+// Bytes returns the mapped region. It must not be used after Unmap.
+func (m *MMap) Bytes() []byte { return m.data }
+
+// Flush writes the changes of a MapWrite mapping to the file. It's a nop for
+// the other modes.
+func (m *MMap) Flush() error {
+	if m.mode != MapWrite {
+		return nil
+	}
+
+	return syncFile(m.f, uintptr(unsafe.Pointer(&m.b[0])), len(m.b))
+}
+
+// FlushRange is like Flush, but it writes only the pages overlapping the size
+// bytes of Bytes starting at off. Flushing zero bytes is a nop.
+func (m *MMap) FlushRange(off, size int) error {
+	if off < 0 || size < 0 || off > len(m.data) || size > len(m.data)-off {
+		return &Error{Op: "flush", Addr: uintptr(off), Size: size, Kind: ErrInvalidPointer}
+	}
+
+	if m.mode != MapWrite || size == 0 {
+		return nil
+	}
+
+	p := uintptr(unsafe.Pointer(&m.data[0])) + uintptr(off)
+	lo := p &^ uintptr(osPageMask)
+	return syncFile(m.f, lo, roundup(int(p-lo)+size, osPageSize))
+}
+
+// Lock locks the mapped pages in physical memory.
+func (m *MMap) Lock() error { return mlock(uintptr(unsafe.Pointer(&m.b[0])), len(m.b)) }
+
+// Unlock unlocks pages locked by Lock.
+func (m *MMap) Unlock() error { return munlock(uintptr(unsafe.Pointer(&m.b[0])), len(m.b)) }
+
+// Unmap removes the mapping. Changes of a MapWrite mapping not yet written to
+// the file are written eventually.
+func (m *MMap) Unmap() error {
+	if m.b == nil {
+		return nil
+	}
+
+	err := unmapFile(m.b)
+	*m = MMap{}
+	return err
+}
@@ -0,0 +1,24 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package memory
+
+import (
+	"os"
+)
+
+var fileMapAlign = osPageSize
+
+func mapFile(f *os.File, off int64, size, mode int) ([]byte, error) { return nil, ErrUnsupported }
+
+func unmapFile(b []byte) error { return ErrUnsupported }
+
+func syncFile(f *os.File, addr uintptr, size int) error { return ErrUnsupported }
+
+func mlock(addr uintptr, size int) error { return ErrUnsupported }
+
+func munlock(addr uintptr, size int) error { return ErrUnsupported }
@@ -0,0 +1,30 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package memory
+
+import (
+	"os"
+	"syscall"
+)
+
+var fileMapAlign = osPageSize
+
+// mapFile maps size bytes of f at offset off, which must be a multiple of
+// fileMapAlign.
+func mapFile(f *os.File, off int64, size, mode int) ([]byte, error) {
+	prot, flags := syscall.PROT_READ, syscall.MAP_SHARED
+	switch mode {
+	case MapWrite:
+		prot |= syscall.PROT_WRITE
+	case MapCopy:
+		prot, flags = prot|syscall.PROT_WRITE, syscall.MAP_PRIVATE
+	}
+	return syscall.Mmap(int(f.Fd()), off, size, prot, flags)
+}
+
+func unmapFile(b []byte) error { return syscall.Munmap(b) }
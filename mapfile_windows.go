@@ -0,0 +1,74 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	fileMapAlign = 1 << 16
+
+	procVirtualLock   = modkernel32.NewProc("VirtualLock")
+	procVirtualUnlock = modkernel32.NewProc("VirtualUnlock")
+)
+
+// mapFile maps size bytes of f at offset off, which must be a multiple of
+// fileMapAlign.
+func mapFile(f *os.File, off int64, size, mode int) ([]byte, error) {
+	prot, access := uint32(syscall.PAGE_READONLY), uint32(syscall.FILE_MAP_READ)
+	switch mode {
+	case MapWrite:
+		prot, access = syscall.PAGE_READWRITE, syscall.FILE_MAP_WRITE
+	case MapCopy:
+		prot, access = syscall.PAGE_WRITECOPY, syscall.FILE_MAP_COPY
+	}
+	end := uint64(off) + uint64(size)
+	h, err := syscall.CreateFileMapping(syscall.Handle(f.Fd()), nil, prot, uint32(end>>32), uint32(end), nil)
+	if h == 0 {
+		return nil, os.NewSyscallError("CreateFileMapping", err)
+	}
+
+	// The view keeps the mapping object alive.
+	addr, err := syscall.MapViewOfFile(h, access, uint32(uint64(off)>>32), uint32(off), uintptr(size))
+	syscall.CloseHandle(h)
+	if addr == 0 {
+		return nil, os.NewSyscallError("MapViewOfFile", err)
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(addr)), size), nil
+}
+
+func unmapFile(b []byte) error {
+	return syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(&b[0])))
+}
+
+func syncFile(f *os.File, addr uintptr, size int) error {
+	if err := syscall.FlushViewOfFile(addr, uintptr(size)); err != nil {
+		return os.NewSyscallError("FlushViewOfFile", err)
+	}
+
+	return f.Sync()
+}
+
+func mlock(addr uintptr, size int) error {
+	r, _, err := procVirtualLock.Call(addr, uintptr(size))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func munlock(addr uintptr, size int) error {
+	r, _, err := procVirtualUnlock.Call(addr, uintptr(size))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import "fmt"
+
+// Mark is a point in the allocation history of an Allocator, see
+// Allocator.Mark.
+type Mark struct {
+	seq uint64
+}
+
+// Mark returns a new mark. Until the mark is released by Release or Rollback,
+// a records every allocation it makes, so that Rollback can free those still
+// live. Marks can be nested.
+func (a *Allocator) Mark() Mark {
+	if a.marked == nil {
+		a.marked = map[uintptr]uint64{}
+	}
+	m := Mark{a.markSeq}
+	a.marks = append(a.marks, m.seq)
+	a.markSeq++
+	return m
+}
+
+// Release drops m and all marks made after it without freeing anything.
+func (a *Allocator) Release(m Mark) error {
+	i, err := a.findMark(m)
+	if err != nil {
+		return err
+	}
+
+	a.dropMarks(i)
+	return nil
+}
+
+// Rollback frees all allocations made after m which are still live, drops m
+// and all marks made after it and returns the number of freed allocations.
+func (a *Allocator) Rollback(m Mark) (n int, err error) {
+	i, err := a.findMark(m)
+	if err != nil {
+		return 0, err
+	}
+
+	for p, seq := range a.marked {
+		if seq < m.seq {
+			continue
+		}
+
+		a.noteFree(p)
+		if e := a.free(p); e != nil && err == nil {
+			err = e
+		}
+		n++
+	}
+	a.dropMarks(i)
+	return n, err
+}
+
+func (a *Allocator) findMark(m Mark) (int, error) {
+	for i := len(a.marks) - 1; i >= 0; i-- {
+		if a.marks[i] == m.seq {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("memory: invalid mark")
+}
+
+func (a *Allocator) dropMarks(i int) {
+	a.marks = a.marks[:i]
+	if len(a.marks) == 0 {
+		a.marks, a.marked = nil, nil
+	}
+}
+
+func (a *Allocator) markAlloc(p uintptr) {
+	a.marked[p] = a.markSeq
+	a.markSeq++
+}
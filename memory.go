@@ -8,6 +8,245 @@
 //
 // 2017-10-03 Added alternative, unsafe.Pointer-based API.
 //
+// 2026-10-16 Added Stats and the cumulative lifetime counters.
+//
+// 2026-10-16 Added Options and Fragmentation.
+//
+// 2026-10-16 Added Allocator.Dump.
+//
+// 2026-10-16 Added Allocator.WriteDOT.
+//
+// 2026-10-16 Added Allocator.DumpHeap and ReadHeapDump.
+//
+// 2026-10-16 Added Options.MmapFault, FailNthMmap and FailMmapAbove.
+//
+// 2026-10-16 Added LimitedAllocator and ErrOOM.
+//
+// 2026-10-16 Added CheckLeaks.
+//
+// 2026-10-16 Added Error, ErrCorrupted, ErrInvalidPointer and ErrLimit.
+//
+// 2026-10-16 Added Options.NoPanic and ErrInvalidSize.
+//
+// 2026-10-16 Requests too big to be ever satisfied fail with ErrOOM instead of
+// overflowing the size computations.
+//
+// 2026-10-16 The size of allocations is no longer limited by the size of an
+// array type on any platform.
+//
+// 2026-10-16 Added Backend, Committer, OSBackend and Options.Backend.
+//
+// 2026-10-16 Added GoBackend, used by default on platforms without mmap.
+//
+// 2026-10-16 Added wasip1 support.
+//
+// 2026-10-16 Added aix and illumos support.
+//
+// 2026-10-16 Added OSBackend.Conceal.
+//
+// 2026-10-16 Added ArenaBackend, Allocator.Contains and ErrUnsupported.
+//
+// 2026-10-16 Added Handle and the Handle* methods.
+//
+// 2026-10-16 Added CompactingHeap.
+//
+// 2026-10-16 Added Allocator.Save, Allocator.Restore and Relocation.
+//
+// 2026-10-16 Added SharedHeap.
+//
+// 2026-10-16 Added SharedHeap.Flush and SharedHeap.FlushAll.
+//
+// 2026-10-16 Added RingBuffer and FreeRingBuffer.
+//
+// 2026-10-16 Added MMap, MapFile and MapFileRegion.
+//
+// 2026-10-16 Added Buffer.
+//
+// 2026-10-16 Added Vector.
+//
+// 2026-10-16 Added Map.
+//
+// 2026-10-16 Added Interner and Symbol.
+//
+// 2026-10-16 Added BTree.
+//
+// 2026-10-16 Added RefCounted and Allocator.NewRefCounted.
+//
+// 2026-10-16 Added Epochs, Options.Epochs, Allocator.DeferFree and
+// Allocator.Advance.
+//
+// 2026-10-16 Added Auto, Allocator.CallocAuto, Allocator.MallocAuto,
+// Allocator.Reclaim and Stats.Reclaimed.
+//
+// 2026-10-16 Added CheckPointers and Store.
+//
+// 2026-10-16 Added Allocator.MallocBatch, Allocator.UintptrMallocBatch and
+// Allocator.UnsafeMallocBatch.
+//
+// 2026-10-16 Added Allocator.FreeBatch, Allocator.UintptrFreeBatch and
+// Allocator.UnsafeFreeBatch.
+//
+// 2026-10-16 Added Allocator.Transfer and Allocator.UintptrTransfer.
+//
+// 2026-10-16 Added Allocator.Clone.
+//
+// 2026-10-16 Added Allocator.Reset.
+//
+// 2026-10-16 Added Mark, Allocator.Mark, Allocator.Release and
+// Allocator.Rollback.
+//
+// 2026-10-16 Added SyncAllocator.
+//
+// 2026-10-16 The statistics counters are updated atomically, Allocator.Stats
+// may be called concurrently with other methods of the Allocator.
+//
+// 2026-10-16 Added Allocator.Trim, Allocator.MaybeTrim, MemoryPressure and
+// Options.Pressure.
+//
+// 2026-10-16 Added Options.Limit, CgroupLimit, GoMemLimit and MemoryLimit.
+//
+// 2026-10-16 Added RetryPolicy, Options.MmapRetry, Allocator.LastMmapError and
+// Stats.MmapFailures.
+//
+// 2026-10-16 Added Options.MaxAlloc and ErrTooLarge.
+//
+// 2026-10-16 Added OSBackend.Randomize.
+//
+// 2026-10-16 Added Options.Deterministic.
+//
+// 2026-10-16 Calloc does not clear memory freshly mapped from the backend,
+// which is already zeroed.
+//
+// 2026-10-16 Added Options.LargeCache and Options.LargeCacheAge.
+//
+// 2026-10-16 Added Options.RetainEmpty.
+//
+// 2026-10-16 Added Allocator.RequestedSize, Allocator.UintptrRequestedSize and
+// Allocator.UnsafeRequestedSize.
+//
+// 2026-10-16 Added Allocator.UsableSize, Allocator.UintptrUsableSize and
+// Allocator.UnsafeUsableSize.
+//
+// 2026-10-16 Added CacheLineSize, CacheLinePad, Allocator.MallocCacheAligned
+// and Allocator.MallocPerCPU.
+//
+// 2026-10-16 Added Options.PageSize.
+//
+// 2026-10-16 Added Pool.
+//
+// 2026-10-16 Added SpillBuffer.
+//
+// 2026-10-16 Added Options.LifetimeSample and Allocator.Lifetimes.
+//
+// 2026-10-16 Added Options.ProfileRate, Options.ProfileStacks, HeapSample and
+// Allocator.HeapProfile.
+//
+// 2026-10-16 In programs built with -race, freeing a block is recorded as a
+// write of the block and as a release synchronizing with the allocation that
+// reuses it. The race detector tracks only Go memory, so the annotations are
+// effective for memory of a Backend carving it from the Go heap.
+//
+// 2026-10-16 In programs built with -asan or -msan, freed blocks are poisoned
+// and allocated blocks unpoisoned, so that the sanitizers report accesses to
+// freed memory.
+//
+// 2026-10-16 Added Options.MemoryTagging.
+//
+// 2026-10-16 Handles returned by SharedHeap.Malloc and SharedHeap.Calloc
+// carry a generation, resolving or freeing them after their block was freed
+// fails. Added ErrStale.
+//
+// 2026-10-16 Added Options.ZeroOnFree.
+//
+// 2026-10-16 Added Options.ScrubOnClose.
+//
+// 2026-10-16 Debug features can be enabled by the MEMORY_DEBUG environment
+// variable, eg. MEMORY_DEBUG=trace,canary. Recognized options are canary,
+// junk, leaks and trace.
+//
+// 2026-10-16 Added Options.OnAlloc and Options.OnFree.
+//
+// 2026-10-16 Added Options.OnOOM.
+//
+// 2026-10-16 Added QuotaError, Allocator.SetQuota, Allocator.TagUsage,
+// Allocator.TagOf and the MallocTag methods.
+//
+// 2026-10-16 Added Allocator.NewChild.
+//
+// 2026-10-16 Added Stats.Add, StatsTree and Allocator.StatsTree.
+//
+// 2026-10-16 Added Stats.Sub, Snapshot, Delta and Allocator.Snapshot.
+//
+// 2026-10-16 On Windows, mappings smaller than the 64kB allocation
+// granularity commit only the OS pages they need.
+//
+// 2026-10-16 Allocator.Contains finds the owning page in logarithmic time.
+// With MEMORY_DEBUG=canary, Free rejects pointers outside of the pages of the
+// Allocator.
+//
+// 2026-10-16 Added Options.Headerless.
+//
+// 2026-10-16 Added Allocator.MallocPageAligned,
+// Allocator.UintptrMallocPageAligned and Allocator.UnsafeMallocPageAligned.
+//
+// 2026-10-16 Added Iovec and Allocator.MallocIovec.
+//
+// 2026-10-16 Added CAllocator.
+//
+// 2026-10-16 Added Allocator.UintptrAdopt and Allocator.UnsafeAdopt.
+//
+// 2026-10-16 Added Allocator.MemoryUsed, Allocator.MemoryHighwater,
+// Allocator.SoftHeapLimit and Options.SoftLimit.
+//
+// 2026-10-16 Added Allocator.TrimIdle, Allocator.StartTrimmer and Trimmer.
+//
+// 2026-10-16 Added OSBackend.Prefault.
+//
+// 2026-10-16 Added Sparse and NewSparse.
+//
+// 2026-10-16 Added COWBackend, NewCOWBackend and HeapView.
+//
+// 2026-10-16 Added StringBuilder, NewStringBuilder and GoString.
+//
+// 2026-10-16 Added Deque and NewDeque.
+//
+// 2026-10-16 Added FixedPool and NewFixedPool.
+//
+// 2026-10-16 Added NewBufferBackend and NewRegionBackend.
+//
+// 2026-10-16 Added Stack and NewStack.
+//
+// 2026-10-16 Added WithAllocator, FromContext and WithChild.
+//
+// 2026-10-16 Slots of the size classes are aligned to their size. Added
+// Allocator.MallocAligned.
+//
+// 2026-10-16 Realloc shrinking a block larger than the largest size class to
+// at most half of its size returns the unused OS pages: the tail of the
+// mapping is unmapped on Unix systems and decommitted, keeping the address
+// space reserved, on Windows.
+//
+// 2026-10-16 Added Options.ReallocShrink and Options.ReallocMove.
+//
+// 2026-10-16 CheckLeaks moved to the new package memorytest, so that
+// programs importing memory do not link the testing package. Added
+// Allocator.Leaks.
+//
+// 2026-10-16 Added MMap.FlushRange.
+//
+// 2026-10-16 Added NewSyncAllocator.
+//
+// 2026-10-16 Handles of an ArenaBackend, Refs of a CompactingHeap and the
+// Handles returned by SharedHeap.Handle carry generations as well, using them
+// after their object was freed fails with ErrStale. SharedHeap.Free rejects
+// blocks which are already free.
+//
+// 2026-10-16 MallocAligned and CAllocator.Xmemalign accept alignments
+// larger than the page size of the Allocator.
+//
+// 2026-10-16 WithChild returns a function closing the child instead of
+// closing it when the context is done.
+//
 // Benchmarks
 //
 // Intel® Core™ i5-4670 CPU @ 3.40GHz × 4
@@ -42,8 +281,11 @@ package memory
 
 import (
 	"fmt"
+	"math"
 	"os"
-	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/cznic/mathutil"
@@ -52,7 +294,8 @@ import (
 const mallocAllign = 16 // Must be >= 16
 
 var (
-	headerSize  = roundup(int(unsafe.Sizeof(page{})), mallocAllign)
+	headerSize  = roundup(int(unsafe.Sizeof(page{})), CacheLineSize) // Keeps slots >= CacheLineSize line aligned.
+	maxMalloc   = math.MaxInt - headerSize - 2*pageSize // Prevents overflows in size computations.
 	maxSlotSize = pageAvail >> 1
 	osPageMask  = osPageSize - 1
 	osPageSize  = os.Getpagesize()
@@ -64,7 +307,7 @@ var (
 func roundup(n, m int) int { return (n + m - 1) &^ (m - 1) }
 
 type node struct {
-	prev, next *node
+	next *node
 }
 
 type page struct {
@@ -72,36 +315,298 @@ type page struct {
 	log  uint
 	size int
 	used int
+
+	// Free slots of a shared page. Pages with free slots are linked in
+	// Allocator.lists, so an empty page is torn down in O(1).
+	free       *node
+	prev, next *page
+
+	reg int // Index of the page in Allocator.regs.
+}
+
+// Options configure an Allocator. They should be set before the first
+// allocation. Close preserves them.
+type Options struct {
+	// TrackSizes enables recording of the requested size of every
+	// allocation. It's required for reporting internal fragmentation and
+	// by RequestedSize. Realloc then copies only the requested part of the
+	// block.
+	TrackSizes bool
+
+	// MmapFault, if not nil, is called before every request for memory
+	// from the OS with the size of the request and the number of bytes
+	// currently mapped. If it returns an error, the request fails with
+	// that error. It's intended for testing out-of-memory handling, see
+	// FailNthMmap and FailMmapAbove.
+	MmapFault func(size, mapped int) error
+
+	// NoPanic makes the allocator report negative sizes by returning an
+	// error wrapping ErrInvalidSize instead of panicking.
+	NoPanic bool
+
+	// Backend, if not nil, provides the memory of the Allocator instead
+	// of the OS. It must not be changed while the Allocator has any
+	// memory mapped.
+	Backend Backend
+
+	// Epochs, if not nil, delays the memory released by DeferFree until
+	// no reader pinned by Epochs can still use it.
+	Epochs *Epochs
+
+	// Pressure, if not nil, reports whether the process is under memory
+	// pressure. It's used by MaybeTrim instead of MemoryPressure.
+	Pressure func() bool
+
+	// MmapRetry configures retrying of failed requests for memory from
+	// the backend. The zero value means no retries.
+	MmapRetry RetryPolicy
+
+	// MaxAlloc, if positive, is the maximum size of a single allocation.
+	// Larger requests fail with an error wrapping ErrTooLarge without
+	// asking the backend for memory. It protects eg. parsers passing
+	// corrupted length fields to Malloc.
+	MaxAlloc int
+
+	// Deterministic makes the heap layout depend only on the sequence of
+	// calls. Pages are then processed in address order and, if Backend is
+	// nil, mapped from a single address range reserved by an ArenaBackend
+	// owned by the Allocator, so page placement relative to the start of
+	// the range and the order of the free lists are the same in every run,
+	// which helps reproducing failures and fuzzing. Where address space
+	// cannot be reserved, pages are mapped from the OS as usual.
+	Deterministic bool
+
+	// Limit, if positive, is the maximum number of bytes the Allocator
+	// maps. Requests exceeding it fail with an error wrapping ErrLimit.
+	// When a request gets within 1/8 of the limit, Trim is called first.
+	// See MemoryLimit for deriving the limit from the environment.
+	Limit int
+
+	// SoftLimit, if positive, is the number of bytes mapped by the
+	// Allocator above which Trim is called before mapping more memory.
+	// Unlike Limit, requests exceeding it do not fail. See SoftHeapLimit.
+	SoftLimit int
+
+	// LargeCache, if positive, is the maximum number of bytes of freed
+	// allocations larger than the largest size class kept mapped for reuse
+	// by later allocations of about the same size. It avoids a pair of
+	// mmap and munmap calls per allocation when big buffers are allocated
+	// and freed repeatedly. Cached memory is included in Stats.Bytes and
+	// Stats.Mmaps and it's released by Trim.
+	LargeCache int
+
+	// LargeCacheAge, if positive, is the maximum time a freed allocation
+	// is kept in the LargeCache.
+	LargeCacheAge time.Duration
+
+	// RetainEmpty, if not zero, keeps the last shared page of every size
+	// class which becomes empty mapped for reuse until another page of the
+	// class becomes empty or, if RetainEmpty is positive, until it elapses.
+	// It prevents mapping and unmapping the same page over and over when a
+	// workload oscillates around a page boundary. The age of the retained
+	// pages is checked when a page becomes empty, Trim releases them
+	// unconditionally.
+	RetainEmpty time.Duration
+
+	// PageSize, if not zero, is the size of the shared pages of the
+	// Allocator and the alignment of all memory it maps. It's rounded up
+	// to a power of two between 64kB and 1GB. Allocators with different
+	// page sizes can be used together, but functions not bound to an
+	// Allocator, like UsableSize, are then slower. The default is 1MB,
+	// or 64kB on some platforms.
+	PageSize int
+
+	// LifetimeSample, if positive, makes the Allocator measure the time
+	// between allocating and freeing every LifetimeSample-th allocation,
+	// see Lifetimes.
+	LifetimeSample int
+
+	// ProfileRate, if positive, is the average number of bytes allocated
+	// between two allocations sampled for HeapProfile. A rate of about
+	// 512kB gives a useful picture of a large heap at a negligible cost.
+	ProfileRate int
+
+	// ProfileStacks makes HeapProfile report the call stacks of the
+	// sampled allocations. Recording them is not free, but it happens
+	// only for the sampled allocations.
+	ProfileStacks bool
+
+	// MemoryTagging makes the allocator use the Memory Tagging Extension
+	// of Linux/arm64, where available, with the OSBackend. Allocations are
+	// tagged with a random tag, which is reset on free, so that accesses
+	// through stale pointers or past the usable size of a block fault
+	// immediately, unless the tags happen to match. Returned pointers
+	// carry the tag in their top byte.
+	// Tag checking is enabled for the thread which first maps tagged memory
+	// and the threads it creates later. Heap dumps with contents and Clone
+	// are not supported in this mode. Elsewhere MemoryTagging is ignored.
+	MemoryTagging bool
+
+	// ZeroOnFree makes Free zero the contents of the freed blocks, except
+	// for the word linking a free slot, and makes the allocator zero pages
+	// before they are unmapped, retained by Reset or cached, see LargeCache.
+	// It's intended for heaps holding credentials or keys. The zeroing
+	// cannot be optimized away by the compiler.
+	ZeroOnFree bool
+
+	// ScrubOnClose makes Close zero all memory mapped by the allocator
+	// before returning it to the Backend, so that sensitive data does not
+	// linger in pages the OS may hand to other mappings. ZeroOnFree
+	// implies ScrubOnClose.
+	ScrubOnClose bool
+
+	// OnAlloc, if not nil, is called for every allocation with its
+	// address, requested size and size class. The size class is the
+	// binary logarithm of the slot size for blocks of shared pages and
+	// zero for blocks occupying a page of their own. The address is
+	// reported without a memory tag, see MemoryTagging. OnAlloc must not
+	// call methods of the Allocator.
+	OnAlloc func(p uintptr, size, class int)
+
+	// OnFree is like OnAlloc, but it's called for every freed block
+	// before its memory is released. The size is the requested size if
+	// the Allocator tracks it, see TrackSizes, otherwise it's the usable
+	// size. Reset and Close do not call OnFree.
+	OnFree func(p uintptr, size, class int)
+
+	// Headerless makes allocations larger than the largest size class
+	// occupy a mapping of their own without a page header. The returned
+	// pointer is then aligned to the page size of the Allocator and all of
+	// the mapping is usable, which suits eg. buffers for O_DIRECT I/O. The
+	// metadata of such blocks is kept by the Allocator, the package level
+	// UsableSize functions must not be used with them. Heap dumps with
+	// contents and Clone are not supported while such blocks are live.
+	Headerless bool
+
+	// OnOOM, if not nil, is called when an allocation of size bytes fails
+	// for lack of memory or because of Limit. OnOOM may release memory,
+	// eg. by freeing cached objects or calling Trim. If it returns true,
+	// the allocation is retried once.
+	OnOOM func(size int) bool
+
+	// ReallocShrink, if greater than one, makes Realloc move a block to a
+	// smaller size class when the new size is at most 1/ReallocShrink of
+	// its usable size. By default a shrinking Realloc keeps the block in
+	// place and only blocks larger than the largest size class return
+	// their unused memory.
+	ReallocShrink int
+
+	// ReallocMove makes every Realloc move the block, even when it could
+	// be resized in place. It's intended for testing, it shakes out
+	// callers still using the pointer passed to Realloc instead of the
+	// returned one, especially when combined with ZeroOnFree.
+	ReallocMove bool
 }
 
 // Allocator allocates and frees memory. Its zero value is ready for use.
 type Allocator struct {
-	allocs int // # of allocs.
-	bytes  int // Asked from OS.
+	Options
+
+	allocs atomic.Int64 // # of allocs.
+	bytes  atomic.Int64 // Asked from OS.
 	cap    [64]int
-	lists  [64]*node
-	mmaps  int // Asked from OS.
+	lists  [64]*page    // Shared pages with free slots.
+	mmaps  atomic.Int64 // Asked from OS.
 	pages  [64]*page
-	regs   map[*page]struct{}
+	ranges []*page // Registered pages ordered by address, see owner.
+	regs   []*page // Registered pages, see register.
+
+	bare    map[uintptr]int           // Headerless blocks and their sizes, see Options.Headerless.
+	adopted map[uintptr]adoptedRegion // See UintptrAdopt.
+
+	// dirty[log] is set when pages[log] may hold non-zero bytes above its
+	// brk, ie. when it was reused instead of freshly mapped.
+	dirty [64]bool
+
+	deferred  []deferredFree     // See DeferFree.
+	markSeq   uint64             // Sequence number of the next marked allocation.
+	marked    map[uintptr]uint64 // Allocations made while a Mark is active.
+	marks     []uint64           // Active marks.
+	orphans   *orphans           // See Auto.
+	requested int                // Sum of tracked requested sizes.
+	sizes     map[uintptr]int    // Requested sizes, if TrackSizes is set.
+	spare     [64][]*page        // Empty shared pages retained by Reset.
+
+	cache      []cachedPage // See Options.LargeCache, oldest first.
+	cacheBytes int          // Sum of the sizes of the cached pages.
+
+	empty   [64]*page     // See Options.RetainEmpty, also in spare.
+	emptyAt [64]time.Time // When empty[log] became empty.
+
+	// Lifetime counters, see Stats.
+	allocated atomic.Uint64
+	freed     atomic.Uint64
+	frees     atomic.Uint64
+	mallocs   atomic.Uint64
+	reallocs  atomic.Uint64
+	reclaimed atomic.Uint64
+
+	highwater atomic.Uint64 // See MemoryHighwater.
+
+	mmapFailures atomic.Uint64
+	mmapErr      error // Last mmap failure.
+
+	born  map[uintptr]int64 // Sampled allocations, see Options.LifetimeSample.
+	lifeN int               // Allocations since the last sample.
+	lives Lifetimes
+
+	samples    map[uintptr]*HeapSample // See Options.ProfileRate.
+	nextSample int                     // Bytes to allocate before the next sample.
+
+	quotas map[string]*tagQuota    // See SetQuota.
+	tagged map[uintptr]taggedAlloc // See MallocTag.
+
+	childBytes atomic.Int64            // Mapped by the children, see NewChild.
+	childMu    sync.Mutex              // Guards children and the Backend for the children.
+	children   map[*Allocator]struct{} // Children with memory mapped.
+
+	own       *ArenaBackend // See Options.Deterministic.
+	ownFailed bool          // The own ArenaBackend could not be created.
 }
 
 func (a *Allocator) mmap(size int) (*page, error) {
-	p, size, err := mmap(size)
-	if err != nil {
+	if err := a.checkLimit(size); err != nil {
 		return nil, err
 	}
 
-	a.mmaps++
-	a.bytes += size
-	pg := (*page)(unsafe.Pointer(p))
-	if a.regs == nil {
-		a.regs = map[*page]struct{}{}
+	p, n, err := a.mapRetry(size, a.pageSize())
+	if err != nil {
+		return nil, &Error{Op: "mmap", Size: size, Kind: ErrOOM, Err: err}
 	}
+
+	if a.tagging() {
+		if err := mteProtect(p, n); err != nil {
+			a.backend().Unmap(p, n)
+			return nil, &Error{Op: "mmap", Size: size, Kind: ErrUnsupported, Err: err}
+		}
+	}
+
+	size = n
+
+	a.mmaps.Add(1)
+	a.bytes.Add(int64(size))
+	pg := (*page)(unsafe.Pointer(p))
 	pg.size = size
-	a.regs[pg] = struct{}{}
+	a.register(pg)
+	if ps := a.pageSize(); ps != pageSize {
+		indexPage(pg, ps)
+	}
 	return pg, nil
 }
 
+// checkSize rejects sizes no allocation of a can have.
+func (a *Allocator) checkSize(size int) error {
+	if a.MaxAlloc > 0 && size > a.MaxAlloc {
+		return &Error{Op: "malloc", Size: size, Kind: ErrTooLarge}
+	}
+
+	if size > a.maxSize() {
+		return &Error{Op: "malloc", Size: size, Kind: ErrOOM}
+	}
+
+	return nil
+}
+
 func (a *Allocator) newPage(size int) (*page, error) {
 	size += headerSize
 	p, err := a.mmap(size)
@@ -113,25 +618,78 @@ func (a *Allocator) newPage(size int) (*page, error) {
 	return p, nil
 }
 
+// slotBase returns the offset of the first slot of the shared pages of size
+// class log. Slots are aligned to their size, see MallocAligned.
+func slotBase(log uint) int { return roundup(headerSize, 1<<log) }
+
 func (a *Allocator) newSharedPage(log uint) (*page, error) {
+	if n := len(a.spare[log]); n != 0 {
+		p := a.spare[log][n-1]
+		a.spare[log] = a.spare[log][:n-1]
+		if p == a.empty[log] {
+			a.empty[log] = nil
+		}
+		a.pages[log] = p
+		a.dirty[log] = true
+		return p, nil
+	}
+
 	if a.cap[log] == 0 {
-		a.cap[log] = pageAvail / (1 << log)
+		a.cap[log] = (a.pageSize() - slotBase(log)) >> log
 	}
-	size := headerSize + a.cap[log]<<log
+	size := slotBase(log) + a.cap[log]<<log
 	p, err := a.mmap(size)
 	if err != nil {
 		return nil, err
 	}
 
 	a.pages[log] = p
+	a.dirty[log] = false
 	p.log = log
 	return p, nil
 }
 
+// register adds pg to the pages of a. Pages are kept in a slice indexed by
+// page.reg, so registering and unregistering a page costs no map operations.
+func (a *Allocator) register(pg *page) {
+	pg.reg = len(a.regs)
+	a.regs = append(a.regs, pg)
+	a.addRange(pg)
+}
+
+// unregister removes pg from the pages of a by moving the last page to its
+// place.
+func (a *Allocator) unregister(pg *page) {
+	n := len(a.regs) - 1
+	last := a.regs[n]
+	a.regs[pg.reg], last.reg = last, pg.reg
+	a.regs[n] = nil
+	a.regs = a.regs[:n]
+	pg.reg = -1
+	a.removeRange(pg)
+}
+
+// registered reports whether pg, which must be readable, is a page of a.
+func (a *Allocator) registered(pg *page) bool {
+	return pg.reg >= 0 && pg.reg < len(a.regs) && a.regs[pg.reg] == pg
+}
+
+// unmap releases the page p, which may be registered or cached.
 func (a *Allocator) unmap(p *page) error {
-	delete(a.regs, p)
-	a.mmaps--
-	return unmap(uintptr(unsafe.Pointer(p)), p.size)
+	if a.registered(p) {
+		a.unregister(p)
+	}
+	if ps := a.pageSize(); ps != pageSize {
+		unindexPage(p, ps)
+	}
+	a.mmaps.Add(-1)
+	if sanEnabled {
+		sanUnpoisonPage(p)
+	}
+	if a.ZeroOnFree {
+		a.wipePage(p)
+	}
+	return a.backend().Unmap(uintptr(unsafe.Pointer(p)), p.size)
 }
 
 // UintptrCalloc is like Calloc except it returns an uintptr.
@@ -141,14 +699,7 @@ func (a *Allocator) UintptrCalloc(size int) (r uintptr, err error) {
 			fmt.Fprintf(os.Stderr, "Calloc(%#x) %#x, %v\n", size, r, err)
 		}()
 	}
-	if r, err = a.UintptrMalloc(size); r == 0 || err != nil {
-		return 0, err
-	}
-	b := ((*rawmem)(unsafe.Pointer(r)))[:size]
-	for i := range b {
-		b[i] = 0
-	}
-	return r, nil
+	return a.uintptrMalloc(size, true)
 }
 
 // UintptrFree is like Free except its argument is an uintptr, which must have
@@ -163,46 +714,240 @@ func (a *Allocator) UintptrFree(p uintptr) (err error) {
 		return nil
 	}
 
-	a.allocs--
-	pg := (*page)(unsafe.Pointer(p &^ uintptr(pageMask)))
+	p = untag(p)
+	if a.adopted != nil && a.freeAdopted(p) {
+		return nil
+	}
+
+	if a.orphaned() {
+		if _, err := a.Reclaim(); err != nil {
+			return err
+		}
+	}
+
+	if err := a.checkFree(p); err != nil {
+		return err
+	}
+
+	if debugFlags&debugCanary != 0 {
+		if err := a.checkCanary("free", p); err != nil {
+			return err
+		}
+	}
+
+	a.noteFree(p)
+	return a.free(p)
+}
+
+// noteAlloc updates the optional per allocation bookkeeping of a for the new
+// allocation of size bytes at p.
+func (a *Allocator) noteAlloc(p uintptr, size int) {
+	if raceEnabled {
+		raceAlloc(p)
+	}
+	if sanEnabled {
+		sanUnpoison(p, a.usable(p))
+	}
+	if a.trackSizes() {
+		a.trackSize(p, size)
+		if debugFlags&debugCanary != 0 {
+			a.setCanary(p, size)
+		}
+	}
+	if a.marks != nil {
+		a.markAlloc(p)
+	}
+	if a.LifetimeSample > 0 {
+		a.sampleLifetime(p)
+	}
+	if a.ProfileRate > 0 {
+		a.sampleHeap(p, size)
+	}
+	if a.OnAlloc != nil {
+		a.OnAlloc(p, size, int(a.class(p)))
+	}
+	a.noteHighwater()
+}
+
+// noteFree updates the optional per allocation bookkeeping of a for the
+// allocation at p, which is being freed.
+func (a *Allocator) noteFree(p uintptr) {
+	if a.OnFree != nil {
+		size, ok := a.sizes[p]
+		if !ok {
+			size = a.usable(p)
+		}
+		a.OnFree(p, size, int(a.class(p)))
+	}
+	if raceEnabled {
+		raceFree(p, a.usable(p))
+	}
+	if a.tagging() {
+		mteClear(p, a.usable(p))
+	}
+	switch {
+	case a.ZeroOnFree:
+		// Pages of large blocks are wiped when unmapped or cached.
+		if log := a.class(p); log != 0 {
+			wipe(p, 1<<log)
+		}
+	case debugFlags&debugJunk != 0:
+		// The first word of a free slot links it.
+		fill(p+8, a.usable(p)-8, junkFreeByte)
+	}
+	if sanEnabled {
+		sanFree(p, a.usable(p))
+	}
+	if a.sizes != nil {
+		a.untrackSize(p)
+	}
+	if a.marked != nil {
+		delete(a.marked, p)
+	}
+	if a.born != nil {
+		a.recordLifetime(p)
+	}
+	if a.samples != nil {
+		delete(a.samples, p)
+	}
+	if a.tagged != nil {
+		a.untagAlloc(p)
+	}
+	if b, ok := a.backend().(*ArenaBackend); ok && b.handles.Load() {
+		b.retire(p)
+	}
+}
+
+// checkFree performs cheap sanity checks of a pointer passed to Free.
+func (a *Allocator) checkFree(p uintptr) error {
+	if p&(mallocAllign-1) != 0 {
+		return &Error{Op: "free", Addr: p, Kind: ErrInvalidPointer}
+	}
+
+	if a.bare != nil {
+		if _, ok := a.bare[p]; ok {
+			return nil
+		}
+	}
+
+	pg := a.pageOf(p)
+	if debugFlags&debugCanary != 0 && a.owner(p) != pg {
+		// Do not read the header of a page a does not own.
+		return &Error{Op: "free", Addr: p, Kind: ErrInvalidPointer}
+	}
+
+	off := int(p - uintptr(unsafe.Pointer(pg)))
+	switch log := pg.log; {
+	case log == 0:
+		if off != headerSize {
+			return &Error{Op: "free", Addr: p, Kind: ErrInvalidPointer}
+		}
+	case log >= 64 || pg.used <= 0 || pg.brk > a.cap[log]:
+		return &Error{Op: "free", Addr: p, Kind: ErrCorrupted}
+	default:
+		if off -= slotBase(log); off < 0 || off&(1<<log-1) != 0 || off>>log >= pg.brk {
+			return &Error{Op: "free", Addr: p, Kind: ErrInvalidPointer}
+		}
+	}
+	return nil
+}
+
+func (a *Allocator) free(p uintptr) (err error) {
+	if a.bare != nil {
+		if n, ok := a.bare[p]; ok {
+			return a.freeBare(p, n)
+		}
+	}
+
+	a.allocs.Add(-1)
+	a.frees.Add(1)
+	pg := a.pageOf(p)
+	a.freed.Add(uint64(usableSizeOf(pg)))
 	log := pg.log
 	if log == 0 {
-		a.bytes -= pg.size
+		if a.LargeCache > 0 {
+			return a.cachePage(pg)
+		}
+
+		a.bytes.Add(-int64(pg.size))
 		return a.unmap(pg)
 	}
 
-	n := (*node)(unsafe.Pointer(p))
-	n.prev = nil
-	n.next = a.lists[log]
-	if n.next != nil {
-		n.next.prev = n
-	}
-	a.lists[log] = n
-	pg.used--
-	if pg.used != 0 {
+	a.pushFree(pg, p)
+	if pg.used--; pg.used != 0 {
 		return nil
 	}
 
-	for i := 0; i < pg.brk; i++ {
-		n := (*node)(unsafe.Pointer(uintptr(unsafe.Pointer(pg)) + uintptr(headerSize+i<<log)))
-		switch {
-		case n.prev == nil:
-			a.lists[log] = n.next
-			if n.next != nil {
-				n.next.prev = nil
-			}
-		case n.next == nil:
-			n.prev.next = nil
-		default:
-			n.prev.next = n.next
-			n.next.prev = n.prev
-		}
+	return a.releasePage(pg)
+}
+
+// pushFree puts the slot p on the free list of its shared page pg.
+func (a *Allocator) pushFree(pg *page, p uintptr) {
+	n := (*node)(unsafe.Pointer(p))
+	if n.next = pg.free; n.next == nil {
+		a.linkPage(pg)
 	}
+	pg.free = n
+}
 
+// popFree removes a slot from the free list of the first page of size class
+// log with free slots and returns it.
+func (a *Allocator) popFree(log uint) uintptr {
+	pg := a.lists[log]
+	n := pg.free
+	if pg.free = n.next; pg.free == nil {
+		a.unlinkPage(pg)
+	}
+	pg.used++
+	return uintptr(unsafe.Pointer(n))
+}
+
+// linkPage adds pg to the pages of its size class with free slots. It's
+// inserted after the first page, if any, so that successive allocations keep
+// using the same page until it's full.
+func (a *Allocator) linkPage(pg *page) {
+	head := a.lists[pg.log]
+	if head == nil {
+		pg.prev, pg.next = nil, nil
+		a.lists[pg.log] = pg
+		return
+	}
+
+	pg.prev, pg.next = head, head.next
+	if pg.next != nil {
+		pg.next.prev = pg
+	}
+	head.next = pg
+}
+
+func (a *Allocator) unlinkPage(pg *page) {
+	if pg.prev == nil {
+		a.lists[pg.log] = pg.next
+	} else {
+		pg.prev.next = pg.next
+	}
+	if pg.next != nil {
+		pg.next.prev = pg.prev
+	}
+	pg.prev, pg.next = nil, nil
+}
+
+// releasePage unlinks the empty shared page pg from the list of pages with
+// free slots and unmaps pg or retains it, see Options.RetainEmpty.
+func (a *Allocator) releasePage(pg *page) error {
+	log := pg.log
+	if pg.free != nil {
+		a.unlinkPage(pg)
+		pg.free = nil
+	}
 	if a.pages[log] == pg {
 		a.pages[log] = nil
 	}
-	a.bytes -= pg.size
+	if a.RetainEmpty != 0 {
+		return a.retainPage(pg)
+	}
+
+	a.bytes.Add(-int64(pg.size))
 	return a.unmap(pg)
 }
 
@@ -213,48 +958,102 @@ func (a *Allocator) UintptrMalloc(size int) (r uintptr, err error) {
 			fmt.Fprintf(os.Stderr, "Malloc(%#x) %#x, %v\n", size, r, err)
 		}()
 	}
+	return a.uintptrMalloc(size, false)
+}
+
+// uintptrMalloc implements UintptrMalloc and, if zero is set, UintptrCalloc.
+// Blocks carved from freshly mapped memory are already zeroed and are not
+// cleared again.
+func (a *Allocator) uintptrMalloc(size int, zero bool) (r uintptr, err error) {
 	if size < 0 {
-		panic("invalid malloc size")
+		return 0, a.invalidSize("malloc", size)
 	}
 
 	if size == 0 {
 		return 0, nil
 	}
 
-	a.allocs++
-	log := uint(mathutil.BitLen(roundup(size, mallocAllign) - 1))
-	if 1<<log > maxSlotSize {
-		p, err := a.newPage(size)
-		if err != nil {
+	if a.orphaned() {
+		if _, err := a.Reclaim(); err != nil {
+			return 0, err
+		}
+	}
+
+	var fresh bool
+	if r, fresh, err = a.mallocFresh(size); err != nil {
+		if !a.retryOOM(size, err) {
 			return 0, err
 		}
 
-		return uintptr(unsafe.Pointer(p)) + uintptr(headerSize), nil
+		if r, fresh, err = a.mallocFresh(size); err != nil {
+			return 0, err
+		}
+	}
+
+	a.noteAlloc(r, size)
+	if a.tagging() {
+		r = mteTag(r, a.usable(r))
+	}
+	switch {
+	case zero && !fresh:
+		clear(unsafe.Slice((*byte)(unsafe.Pointer(r)), size))
+	case !zero && debugFlags&debugJunk != 0:
+		fill(r, size, junkAllocByte)
+	}
+	return r, nil
+}
+
+func (a *Allocator) malloc(size int) (r uintptr, err error) {
+	r, _, err = a.mallocFresh(size)
+	return r, err
+}
+
+// mallocFresh is like malloc and additionally reports whether the block was
+// never handed out since its page was mapped, so it is known to be zeroed.
+func (a *Allocator) mallocFresh(size int) (r uintptr, fresh bool, err error) {
+	if err := a.checkSize(size); err != nil {
+		return 0, false, err
+	}
+
+	log := uint(mathutil.BitLen(roundup(size, mallocAllign) - 1))
+	if uint64(1)<<log > uint64(a.maxSlot()) {
+		if a.Headerless {
+			r, err = a.mallocBare(size, a.pageSize())
+			return r, err == nil, err
+		}
+
+		p := a.cachedPage(size)
+		if fresh = p == nil; fresh {
+			if p, err = a.newPage(size); err != nil {
+				return 0, false, err
+			}
+		}
+
+		a.allocs.Add(1)
+		a.mallocs.Add(1)
+		a.allocated.Add(uint64(p.size - headerSize))
+		return uintptr(unsafe.Pointer(p)) + uintptr(headerSize), fresh, nil
 	}
 
 	if a.lists[log] == nil && a.pages[log] == nil {
 		if _, err := a.newSharedPage(log); err != nil {
-			return 0, err
+			return 0, false, err
 		}
 	}
 
+	a.allocs.Add(1)
+	a.mallocs.Add(1)
+	a.allocated.Add(1 << log)
 	if p := a.pages[log]; p != nil {
 		p.used++
 		p.brk++
 		if p.brk == a.cap[log] {
 			a.pages[log] = nil
 		}
-		return uintptr(unsafe.Pointer(p)) + uintptr(headerSize+(p.brk-1)<<log), nil
+		return uintptr(unsafe.Pointer(p)) + uintptr(slotBase(log)+(p.brk-1)<<log), !a.dirty[log], nil
 	}
 
-	n := a.lists[log]
-	p := (*page)(unsafe.Pointer(uintptr(unsafe.Pointer(n)) &^ uintptr(pageMask)))
-	a.lists[log] = n.next
-	if n.next != nil {
-		n.next.prev = nil
-	}
-	p.used++
-	return uintptr(unsafe.Pointer(n)), nil
+	return a.popFree(log), false, nil
 }
 
 // UintptrRealloc is like Realloc except its first argument is an uintptr,
@@ -266,6 +1065,11 @@ func (a *Allocator) UintptrRealloc(p uintptr, size int) (r uintptr, err error) {
 			fmt.Fprintf(os.Stderr, "UnsafeRealloc(%#x, %#x) %#x, %v\n", p, size, r, err)
 		}()
 	}
+	if size < 0 {
+		return 0, a.invalidSize("realloc", size)
+	}
+
+	a.reallocs.Add(1)
 	switch {
 	case p == 0:
 		return a.UintptrMalloc(size)
@@ -273,22 +1077,83 @@ func (a *Allocator) UintptrRealloc(p uintptr, size int) (r uintptr, err error) {
 		return 0, a.UintptrFree(p)
 	}
 
-	us := UintptrUsableSize(p)
-	if us > size {
-		return p, nil
+	tagged := p
+	p = untag(p)
+	if r, ok := a.adopted[p]; ok {
+		return a.reallocAdopted(p, r, size)
 	}
 
-	if r, err = a.UintptrMalloc(size); err != nil {
+	if debugFlags&debugCanary != 0 {
+		if err := a.checkCanary("realloc", p); err != nil {
+			return 0, err
+		}
+	}
+
+	if t, ok := a.tagged[p]; ok && size > t.size {
+		// Only the growth is charged, wherever the block ends up.
+		if err := t.q.check(size - t.size); err != nil {
+			return 0, err
+		}
+	}
+
+	us := a.UintptrUsableSize(p)
+	if us > size && !a.reallocMoves(us, size) {
+		a.shrinkInPlace(p, size)
+		if a.trackSizes() {
+			a.untrackSize(p)
+			a.trackSize(p, size)
+			if debugFlags&debugCanary != 0 {
+				a.setCanary(p, size)
+			}
+		}
+		if t, ok := a.tagged[p]; ok {
+			t.q.used += size - t.size
+			t.size = size
+			a.tagged[p] = t
+		}
+		return tagged, nil
+	}
+
+	if t, ok := a.tagged[p]; ok {
+		// The block is freed below, its charge must not count against
+		// the quota.
+		t.q.used -= t.size
+		r, err = a.mallocTag(t.q, size)
+		t.q.used += t.size
+	} else {
+		r, err = a.UintptrMalloc(size)
+	}
+	if err != nil {
 		return 0, err
 	}
 
+	if n, ok := a.sizes[p]; ok {
+		// Only the requested part of the block holds data.
+		us = n
+	}
 	if us < size {
 		size = us
 	}
-	copy((*rawmem)(unsafe.Pointer(r))[:size], (*rawmem)(unsafe.Pointer(p))[:size])
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(r)), size), unsafe.Slice((*byte)(unsafe.Pointer(tagged)), size))
 	return r, a.UintptrFree(p)
 }
 
+// reallocMoves reports whether Realloc of a block of usable size us to size
+// bytes, which fits into the block, moves it, see Options.ReallocMove and
+// Options.ReallocShrink.
+func (a *Allocator) reallocMoves(us, size int) bool {
+	if a.ReallocMove {
+		return true
+	}
+
+	if a.ReallocShrink < 2 || size > us/a.ReallocShrink {
+		return false
+	}
+
+	log := uint(mathutil.BitLen(roundup(size, mallocAllign) - 1))
+	return 1<<log <= a.maxSlot()
+}
+
 // UintptrUsableSize is like UsableSize except its argument is an uintptr,
 // which must have been returned from UintptrCalloc, UintptrMalloc or
 // UintptrRealloc.
@@ -305,8 +1170,45 @@ func UintptrUsableSize(p uintptr) (r int) {
 	return usableSize(p)
 }
 
-func usableSize(p uintptr) (r int) {
-	pg := (*page)(unsafe.Pointer(p &^ uintptr(pageMask)))
+// UintptrUsableSize is like UsableSize except its argument is an uintptr,
+// which must have been returned from UintptrCalloc, UintptrMalloc or
+// UintptrRealloc of a.
+func (a *Allocator) UintptrUsableSize(p uintptr) int {
+	if p == 0 {
+		return 0
+	}
+
+	if r, ok := a.adopted[untag(p)]; ok {
+		return r.size
+	}
+
+	if debugFlags&debugCanary != 0 {
+		// The tail of the block is the canary.
+		if n, ok := a.sizes[untag(p)]; ok {
+			return n
+		}
+	}
+
+	return a.usable(p)
+}
+
+// slice returns the block at p as a slice of length size and capacity equal
+// to its usable size.
+func slice(p uintptr, size int) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), usableSize(p))[:size]
+}
+
+func (a *Allocator) slice(p uintptr, size int) []byte {
+	if debugFlags&debugCanary != 0 {
+		return unsafe.Slice((*byte)(unsafe.Pointer(p)), size)[:size:size]
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), a.usable(p))[:size]
+}
+
+func usableSize(p uintptr) (r int) { return usableSizeOf(pageOf(p)) }
+
+func usableSizeOf(pg *page) (r int) {
 	if pg.log != 0 {
 		return 1 << pg.log
 	}
@@ -317,31 +1219,74 @@ func usableSize(p uintptr) (r int) {
 // Calloc is like Malloc except the allocated memory is zeroed.
 func (a *Allocator) Calloc(size int) (r []byte, err error) {
 	p, err := a.UintptrCalloc(size)
-	if err != nil {
+	if p == 0 || err != nil {
 		return nil, err
 	}
 
-	var b []byte
-	sh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
-	sh.Cap = usableSize(p)
-	sh.Data = p
-	sh.Len = size
-	return b, nil
+	return a.slice(p, size), nil
 }
 
-// Close releases all OS resources used by a and sets it to its zero value.
+// Close releases all OS resources used by a and its children, see NewChild,
+// and sets it to its zero value, except for a.Options.
 //
 // It's not necessary to Close the Allocator when exiting a process.
 func (a *Allocator) Close() (err error) {
-	for p := range a.regs {
+	if debugFlags&debugLeaks != 0 {
+		if e := a.Leaks(); e != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+		}
+	}
+	err = a.closeChildren()
+	a.releaseAdopted()
+	scrub := a.ScrubOnClose && !a.ZeroOnFree
+	for p, n := range a.bare {
+		if scrub {
+			a.wipeRange(p, n)
+		}
+		if e := a.unmapBare(p, n); e != nil && err == nil {
+			err = e
+		}
+	}
+	for len(a.regs) != 0 {
+		p := a.regs[len(a.regs)-1]
+		if scrub {
+			a.wipePage(p)
+		}
 		if e := a.unmap(p); e != nil && err == nil {
 			err = e
 		}
 	}
-	*a = Allocator{}
+	for _, c := range a.cache {
+		if scrub {
+			a.wipePage(c.pg)
+		}
+		if e := a.unmap(c.pg); e != nil && err == nil {
+			err = e
+		}
+	}
+	if a.own != nil {
+		if e := a.own.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	a.detach()
+	*a = Allocator{Options: a.Options}
 	return err
 }
 
+// Contains reports whether p points into memory mapped by a. If a uses an
+// ArenaBackend, addresses outside of its range are rejected without looking
+// at the pages of a. Otherwise the cost is logarithmic in the number of pages
+// mapped by a.
+func (a *Allocator) Contains(p uintptr) bool {
+	p = untag(p)
+	if b, ok := a.backend().(*ArenaBackend); ok && !b.Contains(p) {
+		return false
+	}
+
+	return a.owner(p) != nil || a.inBare(p) || a.inAdopted(p)
+}
+
 // Free deallocates memory (as in C.free). The argument of Free must have been
 // acquired from Calloc or Malloc or Realloc.
 func (a *Allocator) Free(b []byte) (err error) {
@@ -353,8 +1298,8 @@ func (a *Allocator) Free(b []byte) (err error) {
 }
 
 // Malloc allocates size bytes and returns a byte slice of the allocated
-// memory. The memory is not initialized. Malloc panics for size < 0 and
-// returns (nil, nil) for zero size.
+// memory. The memory is not initialized. Malloc panics for size < 0, unless
+// a.NoPanic is set, and returns (nil, nil) for zero size.
 //
 // It's ok to reslice the returned slice but the result of appending to it
 // cannot be passed to Free or Realloc as it may refer to a different backing
@@ -365,11 +1310,7 @@ func (a *Allocator) Malloc(size int) (r []byte, err error) {
 		return nil, err
 	}
 
-	sh := (*reflect.SliceHeader)(unsafe.Pointer(&r))
-	sh.Cap = usableSize(p)
-	sh.Data = p
-	sh.Len = size
-	return r, nil
+	return a.slice(p, size), nil
 }
 
 // Realloc changes the size of the backing array of b to size bytes or returns
@@ -391,11 +1332,7 @@ func (a *Allocator) Realloc(b []byte, size int) (r []byte, err error) {
 		return nil, err
 	}
 
-	sh := (*reflect.SliceHeader)(unsafe.Pointer(&r))
-	sh.Cap = usableSize(p)
-	sh.Data = p
-	sh.Len = size
-	return r, nil
+	return a.slice(p, size), nil
 }
 
 // UsableSize reports the size of the memory block allocated at p, which must
@@ -404,6 +1341,11 @@ func (a *Allocator) Realloc(b []byte, size int) (r []byte, err error) {
 // requested from Calloc, Malloc or Realloc.
 func UsableSize(p *byte) (r int) { return UintptrUsableSize(uintptr(unsafe.Pointer(p))) }
 
+// UsableSize reports the size of the memory block allocated by a at p, which
+// must point to the first byte of a slice returned from Calloc, Malloc or
+// Realloc of a. Unlike the function UsableSize, it may consult the state of a.
+func (a *Allocator) UsableSize(p *byte) int { return a.UintptrUsableSize(uintptr(unsafe.Pointer(p))) }
+
 // UnsafeCalloc is like Calloc except it returns an unsafe.Pointer.
 func (a *Allocator) UnsafeCalloc(size int) (r unsafe.Pointer, err error) {
 	p, err := a.UintptrCalloc(size)
@@ -444,3 +1386,8 @@ func (a *Allocator) UnsafeRealloc(p unsafe.Pointer, size int) (r unsafe.Pointer,
 // unsafe.Pointer, which must have been returned from UnsafeCalloc,
 // UnsafeMalloc or UnsafeRealloc.
 func UnsafeUsableSize(p unsafe.Pointer) (r int) { return UintptrUsableSize(uintptr(p)) }
+
+// UnsafeUsableSize is like UsableSize except its argument is an
+// unsafe.Pointer, which must have been returned from UnsafeCalloc,
+// UnsafeMalloc or UnsafeRealloc of a.
+func (a *Allocator) UnsafeUsableSize(p unsafe.Pointer) int { return a.UintptrUsableSize(uintptr(p)) }
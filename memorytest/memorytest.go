@@ -0,0 +1,26 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package memorytest provides helpers for testing code using the memory
+// package. It's kept separate so that programs importing memory do not link
+// the testing package.
+package memorytest
+
+import (
+	"testing"
+
+	"github.com/cznic/memory"
+)
+
+// CheckLeaks registers a cleanup function with t which fails the test if a
+// has any live allocations or OS mappings when the test, including its
+// subtests, completes.
+func CheckLeaks(t testing.TB, a *memory.Allocator) {
+	t.Helper()
+	t.Cleanup(func() {
+		if err := a.Leaks(); err != nil {
+			t.Error(err)
+		}
+	})
+}
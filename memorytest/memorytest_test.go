@@ -0,0 +1,30 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytest
+
+import (
+	"testing"
+
+	"github.com/cznic/memory"
+)
+
+func TestCheckLeaks(t *testing.T) {
+	var alloc memory.Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	b, err := alloc.Malloc(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alloc.Leaks(); err == nil {
+		t.Fatal("leak not detected")
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package memory
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Anonymous memory is overcommitted by default on these platforms.
+const mapNoReserve = 0
+
+// decommit zeroes the range before releasing it with MADV_FREE, which leaves
+// the kernel free to either keep the old, now zero, contents or to zero fill
+// the pages on the next access.
+func decommit(addr uintptr, size int) error {
+	clear(unsafe.Slice((*byte)(unsafe.Pointer(addr)), size))
+	if err := madvise(addr, size, syscall.MADV_FREE); err != nil {
+		return err
+	}
+
+	return mprotect(addr, size, syscall.PROT_NONE)
+}
+
+// purge is not supported. MADV_FREE does not release the pages of the shared
+// anonymous mappings of the OSBackend and there's no advice punching a hole
+// into them.
+func purge(addr uintptr, size int) error { return ErrUnsupported }
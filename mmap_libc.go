@@ -0,0 +1,85 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || solaris
+// +build aix solaris
+
+package memory
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// On aix, illumos and solaris the syscall package goes through libc and there's
+// no raw munmap to trim the excess of an over-allocated mapping. The mapping is
+// kept whole and released as a whole by syscall.Munmap. The up to align bytes
+// of excess are never touched, so they cost address space only.
+
+var (
+	pageSize = 1 << 20
+
+	mmapsMu sync.Mutex
+	mmaps   = map[uintptr][]byte{}
+)
+
+func unmap(addr uintptr, size int) error {
+	mmapsMu.Lock()
+	b, ok := mmaps[addr]
+	delete(mmaps, addr)
+	mmapsMu.Unlock()
+	if !ok {
+		return syscall.EINVAL
+	}
+
+	return syscall.Munmap(b)
+}
+
+// align aligned, flags are ignored.
+func mmap(size, align, flags int) (uintptr, int, error) {
+	size = roundup(size, osPageSize)
+	n := size
+	if align > osPageSize {
+		n += align
+	}
+	b, err := syscall.Mmap(-1, 0, n, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_ANON)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	p := uintptr(unsafe.Pointer(&b[0]))
+	if p&uintptr(osPageMask) != 0 {
+		panic("internal error")
+	}
+
+	p = (p + uintptr(align-1)) &^ uintptr(align-1)
+	mmapsMu.Lock()
+	mmaps[p] = b
+	mmapsMu.Unlock()
+	return p, size, nil
+}
+
+func reserve(size int) (uintptr, error) { return 0, ErrUnsupported }
+
+func reserveSparse(size int) (uintptr, error) { return 0, ErrUnsupported }
+
+func commit(addr uintptr, size int) error { return ErrUnsupported }
+
+func decommit(addr uintptr, size int) error { return ErrUnsupported }
+
+func release(addr uintptr, size int) error { return ErrUnsupported }
+
+func shrinkMap(addr uintptr, size, keep int) error { return ErrUnsupported }
+
+func purge(addr uintptr, size int) error { return ErrUnsupported }
+
+// syncFile relies on the unified page cache, where syncing the file includes
+// the pages modified through its mappings.
+func syncFile(f *os.File, addr uintptr, size int) error { return f.Sync() }
+
+func mlock(addr uintptr, size int) error { return ErrUnsupported }
+
+func munlock(addr uintptr, size int) error { return ErrUnsupported }
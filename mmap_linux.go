@@ -0,0 +1,64 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	_MADV_REMOVE         = 9
+	_MADV_DONTDUMP       = 16
+	_MADV_POPULATE_WRITE = 23
+
+	mapConceal   = 0
+	mapNoReserve = syscall.MAP_NORESERVE
+)
+
+func conceal(addr uintptr, size int) error { return madvise(addr, size, _MADV_DONTDUMP) }
+
+// prefault falls back to touch on kernels older than 5.14.
+func prefault(addr uintptr, size int) {
+	if madvise(addr, size, _MADV_POPULATE_WRITE) != nil {
+		touch(addr, size)
+	}
+}
+
+// decommit relies on MADV_DONTNEED zero filling private anonymous memory.
+func decommit(addr uintptr, size int) error {
+	if err := madvise(addr, size, syscall.MADV_DONTNEED); err != nil {
+		return err
+	}
+
+	return mprotect(addr, size, syscall.PROT_NONE)
+}
+
+// purge releases the physical memory of the range, which stays accessible and
+// reads as zeroes afterwards. The OSBackend maps shared anonymous memory,
+// backed by shmem, where MADV_DONTNEED only drops the page table entries, so
+// purge punches a hole using MADV_REMOVE instead.
+func purge(addr uintptr, size int) error { return madvise(addr, size, _MADV_REMOVE) }
+
+// mmapAligned first tries a mapping of exactly size bytes, which is often
+// already aligned as the kernel tends to place subsequent mappings next to
+// each other. Only a misaligned mapping is replaced by one from mmapTrim.
+func mmapAligned(size, align, mflags int) (uintptr, error) {
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, mflags)
+	if err != nil {
+		return 0, err
+	}
+
+	p := uintptr(unsafe.Pointer(&b[0]))
+	if p&uintptr(align-1) == 0 {
+		return p, nil
+	}
+
+	if err := unmap(p, size); err != nil {
+		return 0, err
+	}
+
+	return mmapTrim(size, align, mflags)
+}
@@ -0,0 +1,32 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build freebsd || netbsd
+// +build freebsd netbsd
+
+package memory
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/cznic/mathutil"
+)
+
+// mmapAligned uses MAP_ALIGNED to let the kernel choose an aligned address.
+// It falls back to mmapTrim if the kernel rejects the request.
+func mmapAligned(size, align, mflags int) (uintptr, error) {
+	log := mathutil.BitLen(align - 1)
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, mflags|log<<syscall.MAP_ALIGNMENT_SHIFT)
+	if err != nil {
+		return mmapTrim(size, align, mflags)
+	}
+
+	p := uintptr(unsafe.Pointer(&b[0]))
+	if p&uintptr(align-1) != 0 {
+		panic("internal error")
+	}
+
+	return p, nil
+}
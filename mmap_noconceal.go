@@ -0,0 +1,12 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || netbsd
+// +build darwin netbsd
+
+package memory
+
+const mapConceal = 0
+
+func conceal(addr uintptr, size int) error { return nil }
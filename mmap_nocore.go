@@ -0,0 +1,16 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build dragonfly || freebsd
+// +build dragonfly freebsd
+
+package memory
+
+import (
+	"syscall"
+)
+
+const mapConceal = syscall.MAP_NOCORE
+
+func conceal(addr uintptr, size int) error { return nil }
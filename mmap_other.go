@@ -0,0 +1,35 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !openbsd && !solaris && !netbsd && !windows && !wasip1
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!openbsd,!solaris,!netbsd,!windows,!wasip1
+
+package memory
+
+// Platforms without mmap use GoBackend.
+
+var (
+	pageSize = 1 << 16
+
+	goMaps GoBackend
+)
+
+// align aligned, flags are ignored.
+func mmap(size, align, flags int) (uintptr, int, error) { return goMaps.Map(size, align) }
+
+func unmap(addr uintptr, size int) error { return goMaps.Unmap(addr, size) }
+
+func reserve(size int) (uintptr, error) { return 0, ErrUnsupported }
+
+func reserveSparse(size int) (uintptr, error) { return 0, ErrUnsupported }
+
+func commit(addr uintptr, size int) error { return ErrUnsupported }
+
+func decommit(addr uintptr, size int) error { return ErrUnsupported }
+
+func release(addr uintptr, size int) error { return ErrUnsupported }
+
+func shrinkMap(addr uintptr, size, keep int) error { return ErrUnsupported }
+
+func purge(addr uintptr, size int) error { return ErrUnsupported }
@@ -0,0 +1,10 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || openbsd
+// +build darwin dragonfly openbsd
+
+package memory
+
+func mmapAligned(size, align, mflags int) (uintptr, error) { return mmapTrim(size, align, mflags) }
@@ -2,13 +2,14 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE-MMAP-GO file.
 
-// +build darwin dragonfly freebsd linux openbsd solaris netbsd
+// +build darwin dragonfly freebsd linux openbsd netbsd
 
 // Modifications (c) 2017 The Memory Authors.
 
 package memory
 
 import (
+	"os"
 	"syscall"
 	"unsafe"
 )
@@ -24,25 +25,54 @@ func unmap(addr uintptr, size int) error {
 	return nil
 }
 
-// pageSize aligned.
-func mmap(size int) (uintptr, int, error) {
+// align aligned.
+func mmap(size, align, flags int) (uintptr, int, error) {
 	size = roundup(size, osPageSize)
-	b, err := syscall.Mmap(-1, 0, size+pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_ANON)
+	mflags := syscall.MAP_SHARED | syscall.MAP_ANON
+	if flags&mmapConceal != 0 {
+		mflags |= mapConceal
+	}
+	var p uintptr
+	var err error
+	switch {
+	case flags&mmapRandom != 0:
+		p, err = mmapRandomized(size, align, mflags)
+	default:
+		p, err = mmapAligned(size, align, mflags)
+	}
 	if err != nil {
 		return 0, 0, err
 	}
 
+	if flags&mmapConceal != 0 {
+		if err := conceal(p, size); err != nil {
+			unmap(p, size)
+			return 0, 0, err
+		}
+	}
+
+	return p, size, nil
+}
+
+// mmapTrim maps size bytes aligned to align by over-allocating and unmapping
+// the excess.
+func mmapTrim(size, align, mflags int) (uintptr, error) {
+	b, err := syscall.Mmap(-1, 0, size+align, syscall.PROT_READ|syscall.PROT_WRITE, mflags)
+	if err != nil {
+		return 0, err
+	}
+
 	n := len(b)
 	p := uintptr(unsafe.Pointer(&b[0]))
 	if p&uintptr(osPageMask) != 0 {
 		panic("internal error")
 	}
 
-	mod := int(p) & pageMask
+	mod := int(p) & (align - 1)
 	if mod != 0 {
-		m := pageSize - mod
+		m := align - mod
 		if err := unmap(p, m); err != nil {
-			return 0, 0, err
+			return 0, err
 		}
 
 		b = b[m:]
@@ -50,15 +80,120 @@ func mmap(size int) (uintptr, int, error) {
 		p += uintptr(m)
 	}
 
-	if p&uintptr(pageMask) != 0 {
+	if p&uintptr(align-1) != 0 {
 		panic("internal error")
 	}
 
 	if n-size != 0 {
 		if err := unmap(p+uintptr(size), n-size); err != nil {
-			return 0, 0, err
+			return 0, err
 		}
 	}
 
-	return p, size, nil
+	return p, nil
+}
+
+// mmapRandomized maps size bytes aligned to align at one of randomSlots aligned
+// positions within a larger mapping and unmaps the rest.
+func mmapRandomized(size, align, mflags int) (uintptr, error) {
+	k := randomInt(randomSlots)
+	b, err := syscall.Mmap(-1, 0, size+(k+1)*align, syscall.PROT_READ|syscall.PROT_WRITE, mflags)
+	if err != nil {
+		return 0, err
+	}
+
+	lo := uintptr(unsafe.Pointer(&b[0]))
+	hi := lo + uintptr(len(b))
+	p := uintptr(roundup(int(lo), align) + k*align)
+	if p > lo {
+		if err := unmap(lo, int(p-lo)); err != nil {
+			return 0, err
+		}
+	}
+
+	if end := p + uintptr(size); hi > end {
+		if err := unmap(end, int(hi-end)); err != nil {
+			return 0, err
+		}
+	}
+
+	return p, nil
+}
+
+func reserve(size int) (uintptr, error) {
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_NONE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return 0, err
+	}
+
+	return uintptr(unsafe.Pointer(&b[0])), nil
+}
+
+// reserveSparse maps the range accessible without reserving swap for it where
+// the platform supports that, see Sparse.
+func reserveSparse(size int) (uintptr, error) {
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON|mapNoReserve)
+	if err != nil {
+		return 0, err
+	}
+
+	return uintptr(unsafe.Pointer(&b[0])), nil
+}
+
+func commit(addr uintptr, size int) error {
+	return mprotect(addr, size, syscall.PROT_READ|syscall.PROT_WRITE)
+}
+
+func release(addr uintptr, size int) error { return unmap(addr, size) }
+
+// shrinkMap unmaps the part of the mapping at addr of size bytes past its
+// first keep bytes.
+func shrinkMap(addr uintptr, size, keep int) error {
+	return unmap(addr+uintptr(keep), size-keep)
+}
+
+func mprotect(addr uintptr, size, prot int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MPROTECT, addr, uintptr(size), uintptr(prot))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func madvise(addr uintptr, size, advice int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MADVISE, addr, uintptr(size), uintptr(advice))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// syncFile writes the modified pages of a file mapping to the file.
+func syncFile(f *os.File, addr uintptr, size int) error {
+	_, _, errno := syscall.Syscall(sysMsync, addr, uintptr(size), msSync)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func mlock(addr uintptr, size int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MLOCK, addr, uintptr(size), 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func munlock(addr uintptr, size int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MUNLOCK, addr, uintptr(size), 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
 }
@@ -0,0 +1,39 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build wasip1
+// +build wasip1
+
+package memory
+
+// WASI has no mmap. The linear memory of a WebAssembly module only grows in
+// units of 64kB wasm pages and is never returned to the host, so the pages are
+// taken from the Go heap, which is itself backed by the linear memory, and the
+// page size matches the wasm page size to keep the waste of small heaps low.
+// Memory released by unmap is reused by the Go runtime.
+
+var (
+	pageSize = 1 << 16
+
+	wasmMaps GoBackend
+)
+
+// align aligned, flags are ignored.
+func mmap(size, align, flags int) (uintptr, int, error) { return wasmMaps.Map(size, align) }
+
+func unmap(addr uintptr, size int) error { return wasmMaps.Unmap(addr, size) }
+
+func reserve(size int) (uintptr, error) { return 0, ErrUnsupported }
+
+func reserveSparse(size int) (uintptr, error) { return 0, ErrUnsupported }
+
+func commit(addr uintptr, size int) error { return ErrUnsupported }
+
+func decommit(addr uintptr, size int) error { return ErrUnsupported }
+
+func release(addr uintptr, size int) error { return ErrUnsupported }
+
+func shrinkMap(addr uintptr, size, keep int) error { return ErrUnsupported }
+
+func purge(addr uintptr, size int) error { return ErrUnsupported }
@@ -6,6 +6,7 @@ package memory
 
 import (
 	"syscall"
+	"unsafe"
 )
 
 const (
@@ -13,27 +14,114 @@ const (
 	_MEM_RESERVE  = 0x2000
 	_MEM_DECOMMIT = 0x4000
 	_MEM_RELEASE  = 0x8000
+	_MEM_RESET    = 0x80000
 
 	_PAGE_READWRITE = 0x0004
 	_PAGE_NOACCESS  = 0x0001
+
+	_MemExtendedParameterAddressRequirements = 1
 )
 
+// MEM_ADDRESS_REQUIREMENTS
+type memAddressRequirements struct {
+	lowestStartingAddress uintptr
+	highestEndingAddress  uintptr
+	alignment             uintptr
+}
+
+// MEM_EXTENDED_PARAMETER
+type memExtendedParameter struct {
+	typ     uint64
+	pointer unsafe.Pointer
+	_       [8 - unsafe.Sizeof(uintptr(0))]byte
+}
+
 var (
 	pageSize = 1 << 16
 
 	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	modkernelbase    = syscall.NewLazyDLL("kernelbase.dll")
 	procVirtualAlloc = modkernel32.NewProc("VirtualAlloc")
 	procVirtualFree  = modkernel32.NewProc("VirtualFree")
+
+	// Windows 10+.
+	procVirtualAlloc2 = modkernelbase.NewProc("VirtualAlloc2")
 )
 
-// pageSize aligned.
-func mmap(size int) (uintptr, int, error) {
+// mmap maps size bytes aligned to align. Alignments above the 64kB allocation
+// granularity require VirtualAlloc2, ie. Windows 10 or later.
+//
+// Address space is reserved in multiples of the allocation granularity, but
+// only size rounded up to the OS page size is committed, so a small dedicated
+// mapping is not charged the commit of a whole 64kB region.
+func mmap(size, align, flags int) (uintptr, int, error) {
+	n := roundup(size, osPageSize)
 	size = roundup(size, pageSize)
-	addr, _, err := procVirtualAlloc.Call(0, uintptr(size), _MEM_COMMIT|_MEM_RESERVE, _PAGE_READWRITE)
-	if err.(syscall.Errno) != 0 || addr == 0 {
-		return addr, size, err
+	typ := uintptr(_MEM_COMMIT | _MEM_RESERVE)
+	if n < size {
+		typ = _MEM_RESERVE
+	}
+	addr, err := mmapReserve(size, align, flags, typ)
+	if addr == 0 {
+		return 0, 0, err
 	}
-	return addr, size, nil
+
+	if typ == _MEM_RESERVE {
+		if err := commit(addr, n); err != nil {
+			unmap(addr, size)
+			return 0, 0, err
+		}
+	}
+	return addr, n, nil
+}
+
+// mmapReserve allocates size bytes of address space aligned to align using
+// the VirtualAlloc allocation type typ.
+func mmapReserve(size, align, flags int, typ uintptr) (uintptr, error) {
+	if align > 1<<16 {
+		return mmap2(size, align, typ)
+	}
+
+	if flags&mmapRandom != 0 {
+		for i := 0; i < 8; i++ {
+			if addr := mmapHint(size, align, typ); addr != 0 {
+				return addr, nil
+			}
+		}
+	}
+
+	addr, _, err := procVirtualAlloc.Call(0, uintptr(size), typ, _PAGE_READWRITE)
+	if addr == 0 {
+		return 0, err
+	}
+	return addr, nil
+}
+
+// mmapHint tries to map size bytes at a random address aligned to align. It
+// returns zero if the address is not available.
+func mmapHint(size, align int, typ uintptr) uintptr {
+	var lo, n uint64 = 1 << 28, 3 << 28 // 32 bit address space.
+	if ^uintptr(0)>>63 != 0 {
+		lo, n = 1<<40, 1<<46
+	}
+	hint := uintptr(lo + uint64(randomInt(int(n/uint64(align))))*uint64(align))
+	addr, _, _ := procVirtualAlloc.Call(hint, uintptr(size), typ, _PAGE_READWRITE)
+	return addr
+}
+
+func mmap2(size, align int, typ uintptr) (uintptr, error) {
+	if procVirtualAlloc2.Find() != nil {
+		return 0, syscall.EINVAL
+	}
+
+	req := &memAddressRequirements{alignment: uintptr(align)}
+	param := &memExtendedParameter{typ: _MemExtendedParameterAddressRequirements, pointer: unsafe.Pointer(req)}
+	addr, _, err := procVirtualAlloc2.Call(0, 0, uintptr(size), typ, _PAGE_READWRITE, uintptr(unsafe.Pointer(param)), 1)
+	if addr == 0 {
+		return 0, err
+	}
+
+	return addr, nil
 }
 
 func unmap(addr uintptr, size int) error {
@@ -44,3 +132,53 @@ func unmap(addr uintptr, size int) error {
 
 	return nil
 }
+
+func reserve(size int) (uintptr, error) {
+	addr, _, err := procVirtualAlloc.Call(0, uintptr(size), _MEM_RESERVE, _PAGE_NOACCESS)
+	if addr == 0 {
+		return 0, err
+	}
+
+	return addr, nil
+}
+
+// reserveSparse only reserves the range, see Sparse.
+func reserveSparse(size int) (uintptr, error) { return reserve(size) }
+
+func commit(addr uintptr, size int) error {
+	r, _, err := procVirtualAlloc.Call(addr, uintptr(size), _MEM_COMMIT, _PAGE_READWRITE)
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func decommit(addr uintptr, size int) error {
+	r, _, err := procVirtualFree.Call(addr, uintptr(size), _MEM_DECOMMIT)
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func release(addr uintptr, size int) error { return unmap(addr, size) }
+
+// shrinkMap decommits the part of the mapping at addr of size bytes past its
+// first keep bytes. The address range stays reserved until unmap releases the
+// whole mapping.
+func shrinkMap(addr uintptr, size, keep int) error {
+	return decommit(addr+uintptr(keep), size-keep)
+}
+
+// purge marks the range as no longer of interest using MEM_RESET. It stays
+// accessible, its contents are undefined afterwards.
+func purge(addr uintptr, size int) error {
+	r, _, err := procVirtualAlloc.Call(addr, uintptr(size), _MEM_RESET, _PAGE_READWRITE)
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
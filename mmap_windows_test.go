@@ -0,0 +1,79 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+)
+
+// A dedicated mapping smaller than the allocation granularity is charged only
+// its committed OS pages and growing it past them moves the block to a mapping
+// committing the new size.
+func TestWindowsCommit(t *testing.T) {
+	var alloc Allocator
+	CheckLeaks(t, &alloc)
+	defer alloc.Close()
+
+	size := maxSlotSize + 1
+	committed := roundup(size+headerSize, osPageSize)
+	if committed >= pageSize {
+		t.Skipf("no partially committed mappings with %v byte OS pages", osPageSize)
+	}
+
+	b, err := alloc.Malloc(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := alloc.Stats().Bytes, committed; g != e {
+		t.Fatalf("got %v, expected %v", g, e)
+	}
+
+	us := UsableSize(&b[0])
+	if g, e := us, committed-headerSize; g != e {
+		t.Fatalf("got %v, expected %v", g, e)
+	}
+
+	b = b[:us]
+	for i := range b {
+		b[i] = byte(i)
+	}
+
+	// Within the committed size the block stays in place.
+	p := &b[0]
+	if b, err = alloc.Realloc(b, us-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if &b[0] != p {
+		t.Fatal("block moved")
+	}
+
+	if b, err = alloc.Realloc(b[:us], us+1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range b[:us] {
+		if v != byte(i) {
+			t.Fatalf("%#x: %#x", i, v)
+		}
+	}
+	b[us] = 0xff // Faults unless committed.
+	if g, e := alloc.Stats().Bytes, roundup(us+1+headerSize, osPageSize); g != e {
+		t.Fatalf("got %v, expected %v", g, e)
+	}
+
+	if n := UsableSize(&b[0]); n < us+1 {
+		t.Fatal(n)
+	}
+
+	if err := alloc.Free(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := alloc.Stats().Bytes; g != 0 {
+		t.Fatal(g)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build msan
+// +build msan
+
+package memory
+
+/*
+#include <sanitizer/msan_interface.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+const sanEnabled = true
+
+// sanPoison marks the size bytes at p as uninitialized for the memory
+// sanitizer.
+func sanPoison(p uintptr, size int) { C.__msan_poison(unsafe.Pointer(p), C.size_t(size)) }
+
+// sanUnpoison marks the size bytes at p as initialized for the memory
+// sanitizer.
+func sanUnpoison(p uintptr, size int) { C.__msan_unpoison(unsafe.Pointer(p), C.size_t(size)) }
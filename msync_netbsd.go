@@ -0,0 +1,10 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+const (
+	sysMsync = 277 // SYS___MSYNC13
+	msSync   = 4   // MS_SYNC
+)
@@ -0,0 +1,18 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+// untag returns p without its memory tag.
+func untag(p uintptr) uintptr { return p &^ tagMask }
+
+// tagging reports whether a tags its allocations, see Options.MemoryTagging.
+func (a *Allocator) tagging() bool {
+	if !a.MemoryTagging || !mteSupported() {
+		return false
+	}
+
+	_, ok := a.backend().(*OSBackend)
+	return ok
+}
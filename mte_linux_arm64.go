@@ -0,0 +1,68 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sync"
+	"syscall"
+)
+
+const (
+	// Tag bits of an address with the Memory Tagging Extension.
+	tagMask = uintptr(0xf) << 56
+
+	prMTETagShift        = 3
+	prMTETCFSync         = 1 << 1
+	prSetTaggedAddrCtrl  = 55
+	prTaggedAddrEnable   = 1
+	protMTE              = 0x20
+	mteGranule           = 16
+	mteTagsExcludingZero = 0xfffe
+)
+
+var (
+	mteOnce sync.Once
+	mteOK   bool
+)
+
+// mteSupported enables the tagged address ABI with synchronous tag check
+// faults and reports whether it succeeded. Tag 0, used by the allocator for
+// its own memory, is excluded from the random tags. The setting applies to
+// the calling thread and to threads it creates later.
+func mteSupported() bool {
+	mteOnce.Do(func() {
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetTaggedAddrCtrl, prTaggedAddrEnable|prMTETCFSync|mteTagsExcludingZero<<prMTETagShift, 0, 0, 0, 0)
+		mteOK = errno == 0
+	})
+	return mteOK
+}
+
+// mteProtect enables tag checking for the size bytes of memory at p.
+func mteProtect(p uintptr, size int) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_MPROTECT, p, uintptr(size), syscall.PROT_READ|syscall.PROT_WRITE|protMTE); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// mteTag sets a random tag for the size bytes at p and returns p tagged with
+// it.
+func mteTag(p uintptr, size int) uintptr {
+	p = irg(p)
+	stg(p, size)
+	return p
+}
+
+// mteClear resets the tag of the size bytes at p to zero, so stale tagged
+// pointers to them fault.
+func mteClear(p uintptr, size int) { stg(untag(p), size) }
+
+// irg returns p with a random tag.
+func irg(p uintptr) uintptr
+
+// stg sets the tag of the size bytes at p, which must be a multiple of
+// mteGranule, to the tag of p.
+func stg(p uintptr, size int)
@@ -0,0 +1,26 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// func irg(p uintptr) uintptr
+TEXT ·irg(SB), NOSPLIT, $0-16
+	MOVD	p+0(FP), R0
+	WORD	$0x9adf1000 // IRG X0, X0
+	MOVD	R0, ret+8(FP)
+	RET
+
+// func stg(p uintptr, size int)
+TEXT ·stg(SB), NOSPLIT, $0-16
+	MOVD	p+0(FP), R0
+	MOVD	size+8(FP), R1
+	ADD	R0, R1, R1
+loop:
+	CMP	R1, R0
+	BHS	done
+	WORD	$0xd9200800 // STG X0, [X0]
+	ADD	$16, R0
+	B	loop
+done:
+	RET
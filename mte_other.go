@@ -0,0 +1,18 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux || !arm64
+// +build !linux !arm64
+
+package memory
+
+const tagMask = 0
+
+func mteSupported() bool { return false }
+
+func mteProtect(p uintptr, size int) error { return nil }
+
+func mteTag(p uintptr, size int) uintptr { return p }
+
+func mteClear(p uintptr, size int) {}
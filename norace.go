@@ -0,0 +1,14 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !race
+// +build !race
+
+package memory
+
+const raceEnabled = false
+
+func raceAlloc(p uintptr) {}
+
+func raceFree(p uintptr, size int) {}
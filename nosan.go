@@ -0,0 +1,14 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !asan && !msan
+// +build !asan,!msan
+
+package memory
+
+const sanEnabled = false
+
+func sanPoison(p uintptr, size int) {}
+
+func sanUnpoison(p uintptr, size int) {}
@@ -0,0 +1,50 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// addRange inserts the registered page pg into a.ranges.
+func (a *Allocator) addRange(pg *page) {
+	p := uintptr(unsafe.Pointer(pg))
+	i := sort.Search(len(a.ranges), func(i int) bool { return uintptr(unsafe.Pointer(a.ranges[i])) > p })
+	a.ranges = append(a.ranges, nil)
+	copy(a.ranges[i+1:], a.ranges[i:])
+	a.ranges[i] = pg
+}
+
+// removeRange removes the page pg from a.ranges.
+func (a *Allocator) removeRange(pg *page) {
+	p := uintptr(unsafe.Pointer(pg))
+	i := sort.Search(len(a.ranges), func(i int) bool { return uintptr(unsafe.Pointer(a.ranges[i])) >= p })
+	if i == len(a.ranges) || a.ranges[i] != pg {
+		return
+	}
+
+	copy(a.ranges[i:], a.ranges[i+1:])
+	a.ranges[len(a.ranges)-1] = nil
+	a.ranges = a.ranges[:len(a.ranges)-1]
+}
+
+// owner returns the registered page of a whose memory contains p or nil if
+// there's none. Unlike pageOf it does not read the memory at p, so it can be
+// used for arbitrary addresses, including interior pointers and addresses
+// not mapped at all.
+func (a *Allocator) owner(p uintptr) *page {
+	p = untag(p)
+	i := sort.Search(len(a.ranges), func(i int) bool { return uintptr(unsafe.Pointer(a.ranges[i])) > p })
+	if i == 0 {
+		return nil
+	}
+
+	if pg := a.ranges[i-1]; p-uintptr(unsafe.Pointer(pg)) < uintptr(pg.size) {
+		return pg
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// MallocPageAligned is like Malloc except the returned block occupies a
+// mapping of its own, which starts at an OS page boundary, and the capacity of
+// the returned slice is a multiple of the OS page size. The memory is zeroed.
+// It's intended for buffers of O_DIRECT reads and writes and other APIs
+// requiring page aligned memory. The block is headerless, as if
+// Options.Headerless was set, and it's freed by Free. Realloc does not
+// preserve the alignment of a block it moves.
+func (a *Allocator) MallocPageAligned(size int) (r []byte, err error) {
+	p, err := a.UintptrMallocPageAligned(size)
+	if p == 0 || err != nil {
+		return nil, err
+	}
+
+	return a.slice(p, size), nil
+}
+
+// UintptrMallocPageAligned is like MallocPageAligned except it returns an
+// uintptr.
+func (a *Allocator) UintptrMallocPageAligned(size int) (r uintptr, err error) {
+	if trace {
+		defer func() {
+			fmt.Fprintf(os.Stderr, "MallocPageAligned(%#x) %#x, %v\n", size, r, err)
+		}()
+	}
+	return a.mallocPageAligned(size, a.pageSize())
+}
+
+// mallocPageAligned allocates a headerless block of size bytes in a mapping of
+// its own aligned to align, which must be a multiple of the OS page size.
+func (a *Allocator) mallocPageAligned(size, align int) (r uintptr, err error) {
+	if size < 0 {
+		return 0, a.invalidSize("malloc", size)
+	}
+
+	if size == 0 {
+		return 0, nil
+	}
+
+	if err := a.checkSize(size); err != nil {
+		return 0, err
+	}
+
+	if r, err = a.mallocBare(size, align); err != nil {
+		if !a.retryOOM(size, err) {
+			return 0, err
+		}
+
+		if r, err = a.mallocBare(size, align); err != nil {
+			return 0, err
+		}
+	}
+
+	a.noteAlloc(r, size)
+	if a.tagging() {
+		r = mteTag(r, a.usable(r))
+	}
+	return r, nil
+}
+
+// UnsafeMallocPageAligned is like MallocPageAligned except it returns an
+// unsafe.Pointer.
+func (a *Allocator) UnsafeMallocPageAligned(size int) (r unsafe.Pointer, err error) {
+	p, err := a.UintptrMallocPageAligned(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Pointer(p), nil
+}
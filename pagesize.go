@@ -0,0 +1,109 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/cznic/mathutil"
+)
+
+const (
+	minPageShift = 16
+	minPageSize  = 1 << minPageShift // Smallest Options.PageSize.
+	maxPageSize  = 1 << 30           // Largest Options.PageSize.
+)
+
+// Pages of allocators using a page size different from pageSize, keyed by
+// address >> minPageShift. Shared pages are registered for every
+// minPageSize sized granule they span, dedicated pages for their first
+// granule, which holds the allocation start.
+var (
+	pageIndex struct {
+		sync.RWMutex
+		m map[uintptr]*page
+	}
+	indexed atomic.Int64 // Number of pages in pageIndex.
+)
+
+// pageSize returns the size and alignment of the pages of a, see
+// Options.PageSize.
+func (a *Allocator) pageSize() int {
+	switch n := a.PageSize; {
+	case n == 0 || n == pageSize:
+		return pageSize
+	case n <= minPageSize:
+		return minPageSize
+	case n >= maxPageSize:
+		return maxPageSize
+	default:
+		return 1 << mathutil.BitLen(n-1)
+	}
+}
+
+// maxSlot returns the size of the largest size class of a.
+func (a *Allocator) maxSlot() int { return (a.pageSize() - headerSize) >> 1 }
+
+// pageOf returns the page of a holding the allocation at p.
+func (a *Allocator) pageOf(p uintptr) *page {
+	return (*page)(unsafe.Pointer(untag(p) &^ uintptr(a.pageSize()-1)))
+}
+
+// pageOf returns the page holding the allocation at p, which may belong to any
+// Allocator.
+func pageOf(p uintptr) *page {
+	p = untag(p)
+	if indexed.Load() != 0 {
+		pageIndex.RLock()
+		pg := pageIndex.m[p>>minPageShift]
+		pageIndex.RUnlock()
+		if pg != nil {
+			return pg
+		}
+	}
+
+	return (*page)(unsafe.Pointer(p &^ uintptr(pageMask)))
+}
+
+// indexPage registers pg, mapped by an allocator with page size ps, in
+// pageIndex.
+func indexPage(pg *page, ps int) {
+	p := uintptr(unsafe.Pointer(pg))
+	n := mathutil.Min(pg.size, ps)
+	pageIndex.Lock()
+	if pageIndex.m == nil {
+		pageIndex.m = map[uintptr]*page{}
+	}
+	for off := 0; off < n; off += minPageSize {
+		pageIndex.m[(p+uintptr(off))>>minPageShift] = pg
+	}
+	pageIndex.Unlock()
+	indexed.Add(1)
+}
+
+// unindexPage removes pg, registered by indexPage, from pageIndex.
+func unindexPage(pg *page, ps int) {
+	p := uintptr(unsafe.Pointer(pg))
+	n := mathutil.Min(pg.size, ps)
+	pageIndex.Lock()
+	for off := 0; off < n; off += minPageSize {
+		delete(pageIndex.m, (p+uintptr(off))>>minPageShift)
+	}
+	pageIndex.Unlock()
+	indexed.Add(-1)
+}
+
+// maxSize returns the largest allocation size of a which does not overflow
+// the size computations.
+func (a *Allocator) maxSize() int {
+	if ps := a.pageSize(); ps > pageSize {
+		return math.MaxInt - headerSize - 2*ps
+	}
+
+	return maxMalloc
+}
@@ -0,0 +1,246 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"unsafe"
+)
+
+// Relocation maps addresses of a saved Allocator to the corresponding
+// addresses of the restored one.
+type Relocation struct {
+	pages []relocPage // Ordered by old.
+}
+
+type relocPage struct {
+	old, new uintptr
+	size     int
+}
+
+// Addr returns the address corresponding to old or zero if old is not within
+// the relocated memory.
+func (r *Relocation) Addr(old uintptr) uintptr {
+	i := sort.Search(len(r.pages), func(i int) bool { return r.pages[i].old+uintptr(r.pages[i].size) > old })
+	if i == len(r.pages) || old < r.pages[i].old {
+		return 0
+	}
+
+	return r.pages[i].new + old - r.pages[i].old
+}
+
+// Save writes a snapshot of a, including the contents of all its pages, to w.
+// The snapshot is a heap dump as written by DumpHeap.
+func (a *Allocator) Save(w io.Writer) error { return a.DumpHeap(w, true) }
+
+// Restore reconstructs in a the allocator saved by Save to r. The allocator a
+// must not have any memory mapped. The allocations of the saved allocator are
+// present in a with the same contents, at the addresses reported by the
+// returned Relocation, and can be freed or reallocated as usual. Pointers
+// stored in the allocations are not adjusted. Requested sizes tracked when
+// Options.TrackSizes is set and the pages of the LargeCache are not restored.
+func (a *Allocator) Restore(r io.Reader) (*Relocation, error) {
+	if len(a.regs) != 0 {
+		return nil, fmt.Errorf("memory: restore into an allocator in use")
+	}
+
+	d, err := ReadHeapDump(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.PageSize != a.pageSize() || d.HeaderSize != headerSize {
+		return nil, fmt.Errorf("memory: incompatible heap dump: page size %#x, header size %#x", d.PageSize, d.HeaderSize)
+	}
+
+	reloc := &Relocation{}
+	for i := range d.Pages {
+		dp := &d.Pages[i]
+		if dp.Cached {
+			continue
+		}
+
+		if dp.Data == nil {
+			a.Close()
+			return nil, fmt.Errorf("memory: heap dump without contents")
+		}
+
+		pg, err := a.mmap(dp.Size)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+
+		size, reg := pg.size, pg.reg
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(pg)), dp.Size), dp.Data)
+		*pg = page{brk: dp.Brk, log: dp.Log, size: size, used: dp.Used, reg: reg}
+		if pg.log != 0 {
+			a.cap[pg.log] = (a.pageSize() - slotBase(pg.log)) >> pg.log
+			switch {
+			case pg.brk == 0 && a.pages[pg.log] != nil:
+				a.spare[pg.log] = append(a.spare[pg.log], pg)
+			case pg.brk < a.cap[pg.log]:
+				if p := a.pages[pg.log]; p != nil && p.brk == 0 {
+					a.spare[pg.log] = append(a.spare[pg.log], p)
+				}
+				a.pages[pg.log] = pg
+				a.dirty[pg.log] = true
+			}
+		}
+		reloc.pages = append(reloc.pages, relocPage{uintptr(dp.Addr), uintptr(unsafe.Pointer(pg)), dp.Size})
+	}
+	for log, l := range d.Lists {
+		// Append pages and slots to preserve the order of the dump.
+		var last *page
+		tails := map[*page]*node{}
+		for _, v := range l {
+			p := reloc.Addr(uintptr(v))
+			if p == 0 {
+				a.Close()
+				return nil, fmt.Errorf("memory: invalid heap dump free list")
+			}
+
+			pg := a.pageOf(p)
+			n := (*node)(unsafe.Pointer(p))
+			n.next = nil
+			if t := tails[pg]; t != nil {
+				t.next = n
+				tails[pg] = n
+				continue
+			}
+
+			pg.free, pg.prev, pg.next = n, last, nil
+			if last != nil {
+				last.next = pg
+			} else {
+				a.lists[log] = pg
+			}
+			last = pg
+			tails[pg] = n
+		}
+	}
+	if sanEnabled {
+		for _, pg := range a.regs {
+			sanPoisonFree(pg)
+		}
+	}
+	s := d.Stats
+	a.allocs.Store(int64(s.Allocs))
+	a.mallocs.Store(s.Mallocs)
+	a.frees.Store(s.Frees)
+	a.reallocs.Store(s.Reallocs)
+	a.allocated.Store(s.BytesAllocated)
+	a.freed.Store(s.BytesFreed)
+	return reloc, nil
+}
+
+// Clone returns a new Allocator with the same Options as a, whose live
+// allocations are copies of those of a, at the addresses reported by the
+// returned Relocation. The free lists, counters, tracked sizes and quotas of
+// a are cloned as well. Pointers stored in the allocations are not adjusted.
+// The debugging records of a, ie. the marks of Mark, the lifetime samples and
+// the heap profile samples, are not cloned. Cloning an allocator with
+// headerless blocks or adopted regions, or one using MemoryTagging, is not
+// supported.
+func (a *Allocator) Clone() (*Allocator, *Relocation, error) {
+	if a.tagging() || len(a.bare) != 0 || len(a.adopted) != 0 {
+		return nil, nil, &Error{Op: "clone", Kind: ErrUnsupported}
+	}
+
+	c := &Allocator{Options: a.Options}
+	reloc := &Relocation{}
+	for _, pg := range a.sortedPages() {
+		np, err := c.mmap(pg.size)
+		if err != nil {
+			c.Close()
+			return nil, nil, err
+		}
+
+		size, reg := np.size, np.reg
+		if sanEnabled {
+			sanUnpoisonPage(pg)
+		}
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(np)), pg.size), unsafe.Slice((*byte)(unsafe.Pointer(pg)), pg.size))
+		if sanEnabled {
+			sanPoisonFree(pg)
+		}
+		np.size, np.reg = size, reg
+		reloc.pages = append(reloc.pages, relocPage{uintptr(unsafe.Pointer(pg)), uintptr(unsafe.Pointer(np)), pg.size})
+	}
+	c.cap, c.dirty = a.cap, a.dirty
+	for log, pg := range a.pages {
+		if pg != nil {
+			c.pages[log] = (*page)(unsafe.Pointer(reloc.Addr(uintptr(unsafe.Pointer(pg)))))
+		}
+	}
+	for log, l := range a.spare {
+		for _, pg := range l {
+			c.spare[log] = append(c.spare[log], (*page)(unsafe.Pointer(reloc.Addr(uintptr(unsafe.Pointer(pg))))))
+		}
+	}
+	for log, pg := range a.empty {
+		if pg != nil {
+			c.empty[log] = (*page)(unsafe.Pointer(reloc.Addr(uintptr(unsafe.Pointer(pg)))))
+		}
+	}
+	c.emptyAt = a.emptyAt
+	for log, l := range a.lists {
+		var prev *page
+		for pg := l; pg != nil; pg = pg.next {
+			np := (*page)(unsafe.Pointer(reloc.Addr(uintptr(unsafe.Pointer(pg)))))
+			np.prev, np.next, np.free = prev, nil, nil
+			if prev != nil {
+				prev.next = np
+			} else {
+				c.lists[log] = np
+			}
+			prev = np
+			var last *node
+			for x := pg.free; x != nil; x = x.next {
+				n := (*node)(unsafe.Pointer(reloc.Addr(uintptr(unsafe.Pointer(x)))))
+				n.next = nil
+				if last != nil {
+					last.next = n
+				} else {
+					np.free = n
+				}
+				last = n
+			}
+		}
+	}
+	if a.sizes != nil {
+		c.sizes = make(map[uintptr]int, len(a.sizes))
+		for p, n := range a.sizes {
+			c.sizes[reloc.Addr(p)] = n
+		}
+	}
+	if a.quotas != nil {
+		c.quotas = make(map[string]*tagQuota, len(a.quotas))
+		for tag, q := range a.quotas {
+			nq := *q
+			c.quotas[tag] = &nq
+		}
+		c.tagged = make(map[uintptr]taggedAlloc, len(a.tagged))
+		for p, t := range a.tagged {
+			c.tagged[reloc.Addr(p)] = taggedAlloc{c.quotas[t.q.tag], t.size}
+		}
+	}
+	if sanEnabled {
+		for _, pg := range c.regs {
+			sanPoisonFree(pg)
+		}
+	}
+	c.requested = a.requested
+	c.allocs.Store(a.allocs.Load())
+	c.mallocs.Store(a.mallocs.Load())
+	c.frees.Store(a.frees.Load())
+	c.reallocs.Store(a.reallocs.Load())
+	c.allocated.Store(a.allocated.Load())
+	c.freed.Store(a.freed.Load())
+	c.reclaimed.Store(a.reclaimed.Load())
+	return c, reloc, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/cznic/mathutil"
+)
+
+// Pool recycles byte slices allocated from an Allocator. Slices passed to Put
+// are kept by size class and handed out again by Get, so that a workload
+// repeatedly allocating buffers of similar sizes does not go to the Allocator
+// for every buffer. Unlike sync.Pool, the kept slices are not evicted by the
+// garbage collector, they are released by Close.
+//
+// A Pool is safe for concurrent use by multiple goroutines, provided its
+// Allocator is not used by anything else at the same time.
+type Pool struct {
+	a    *Allocator
+	free [64][]uintptr // Idle blocks by the floor of log2 of their usable size.
+	max  int
+	mu   sync.Mutex
+}
+
+// NewPool returns a Pool allocating from a. At most max idle slices of every
+// size class are kept, further slices passed to Put are freed. Zero max means
+// no limit.
+func NewPool(a *Allocator, max int) *Pool { return &Pool{a: a, max: max} }
+
+// Close frees all idle slices of p. The Pool can be used again afterwards.
+func (p *Pool) Close() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for log, l := range p.free {
+		for _, v := range l {
+			if e := p.a.UintptrFree(v); e != nil && err == nil {
+				err = e
+			}
+		}
+		p.free[log] = nil
+	}
+	return err
+}
+
+// Get returns a slice of size bytes. It's taken from the idle slices of p, if
+// there's one large enough, otherwise it's allocated by Malloc. The contents
+// of the slice are undefined. Zero size returns (nil, nil).
+func (p *Pool) Get(size int) (r []byte, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Pooled blocks would be handed out with sizes their canaries do not
+	// match, see MEMORY_DEBUG.
+	if size > 0 && size <= maxMalloc && debugFlags&debugCanary == 0 {
+		log := mathutil.BitLen(roundup(size, mallocAllign) - 1)
+		if n := len(p.free[log]); n != 0 {
+			q := p.free[log][n-1]
+			p.free[log] = p.free[log][:n-1]
+			return p.a.slice(q, size), nil
+		}
+
+		// Blocks larger than the largest size class are not powers of
+		// two, the previous class may hold one large enough.
+		if log--; size > p.a.maxSlot() {
+			l := p.free[log]
+			for i := len(l) - 1; i >= 0; i-- {
+				if q := l[i]; p.a.UintptrUsableSize(q) >= size {
+					p.free[log] = append(l[:i], l[i+1:]...)
+					return p.a.slice(q, size), nil
+				}
+			}
+		}
+	}
+
+	return p.a.Malloc(size)
+}
+
+// Put returns b, which must have been obtained from Get of p or from Malloc,
+// Calloc or Realloc of its Allocator, to the pool. The caller must not use b
+// afterwards.
+func (p *Pool) Put(b []byte) error {
+	if b = b[:cap(b)]; len(b) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	q := uintptr(unsafe.Pointer(&b[0]))
+	// Every Get of a size up to 1<<log can use the block.
+	log := mathutil.BitLen(len(b)) - 1
+	if p.max > 0 && len(p.free[log]) >= p.max || debugFlags&debugCanary != 0 {
+		return p.a.UintptrFree(q)
+	}
+
+	p.free[log] = append(p.free[log], q)
+	return nil
+}
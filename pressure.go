@@ -0,0 +1,138 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// psiThreshold is the memory stall percentage above which MaybeTrim considers
+// the process to be under memory pressure when Options.Pressure is nil.
+const psiThreshold = 10
+
+// MemoryPressure returns the percentage of the last 10 seconds during which
+// some tasks were stalled waiting for memory, as reported by the Linux
+// pressure stall information in /proc/pressure/memory. It returns an error
+// wrapping ErrUnsupported on other platforms.
+func MemoryPressure() (float64, error) {
+	if runtime.GOOS != "linux" {
+		return 0, &Error{Op: "pressure", Kind: ErrUnsupported}
+	}
+
+	b, err := os.ReadFile("/proc/pressure/memory")
+	if err != nil {
+		return 0, &Error{Op: "pressure", Kind: ErrUnsupported, Err: err}
+	}
+
+	return parsePSI(string(b))
+}
+
+// parsePSI returns the avg10 value of the "some" line of s.
+func parsePSI(s string) (float64, error) {
+	for _, line := range strings.Split(s, "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 || f[0] != "some" {
+			continue
+		}
+
+		for _, v := range f[1:] {
+			if strings.HasPrefix(v, "avg10=") {
+				return strconv.ParseFloat(v[len("avg10="):], 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("memory: invalid pressure stall information")
+}
+
+// MaybeTrim calls Trim if the process is under memory pressure and reports
+// whether it did. The pressure is determined by Options.Pressure or, if it's
+// nil, by MemoryPressure exceeding 10%. Without a way to determine the
+// pressure MaybeTrim does nothing. It's intended to be called periodically or
+// at convenient points of a program, eg. between requests.
+func (a *Allocator) MaybeTrim() (trimmed bool, err error) {
+	switch {
+	case a.Pressure != nil:
+		if !a.Pressure() {
+			return false, nil
+		}
+	default:
+		p, err := MemoryPressure()
+		if err != nil || p < psiThreshold {
+			return false, nil
+		}
+	}
+
+	_, err = a.Trim()
+	return true, err
+}
+
+// Trim returns memory held by a but not used by any allocation to the OS. It
+// unmaps the pages of the LargeCache, the empty pages retained by Reset or
+// due to Options.RetainEmpty and, if a uses the OS backend on Linux or
+// Windows, releases the physical memory of the parts of free slots spanning
+// whole OS pages. The slots stay available for allocation. Trim returns the
+// number of bytes released.
+func (a *Allocator) Trim() (n int, err error) {
+	n, err = a.dropCache()
+	for log, l := range a.spare {
+		for _, pg := range l {
+			n += pg.size
+			a.bytes.Add(-int64(pg.size))
+			if e := a.unmap(pg); e != nil && err == nil {
+				err = e
+			}
+		}
+		a.spare[log], a.empty[log] = nil, nil
+		if pg := a.pages[log]; pg != nil && pg.used == 0 {
+			n += pg.size
+			a.bytes.Add(-int64(pg.size))
+			if e := a.unmap(pg); e != nil && err == nil {
+				err = e
+			}
+			a.pages[log] = nil
+		}
+	}
+	if _, ok := a.backend().(*OSBackend); !ok {
+		return n, err
+	}
+
+	for log := range a.lists {
+		if 1<<log < 2*osPageSize {
+			continue
+		}
+
+		for pg := a.lists[log]; pg != nil; pg = pg.next {
+			for x := pg.free; x != nil; x = x.next {
+				// Keep the OS page holding the free list node.
+				p := uintptr(unsafe.Pointer(x))
+				lo := roundup(int(p)+int(unsafe.Sizeof(node{})), osPageSize)
+				hi := int(p+1<<log) &^ osPageMask
+				if hi <= lo {
+					continue
+				}
+
+				if e := purge(uintptr(lo), hi-lo); e != nil {
+					if errors.Is(e, ErrUnsupported) {
+						return n, err
+					}
+
+					if err == nil {
+						err = e
+					}
+					continue
+				}
+
+				n += hi - lo
+			}
+		}
+	}
+	return n, err
+}
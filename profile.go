@@ -0,0 +1,58 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+)
+
+// HeapSample describes a live allocation sampled for the heap profile, see
+// Options.ProfileRate.
+type HeapSample struct {
+	Addr  uintptr
+	Size  int       // Requested size.
+	Bytes int       // Estimate of the allocated bytes the sample stands for.
+	Stack []uintptr // Return program counters of the allocating call stack, see Options.ProfileStacks.
+}
+
+// HeapProfile returns the sampled live allocations of a, ordered by address.
+// The sum of their Bytes fields estimates the size of the live heap and its
+// attribution to the call sites. See runtime.CallersFrames for translating
+// the Stack of a sample.
+func (a *Allocator) HeapProfile() []HeapSample {
+	r := make([]HeapSample, 0, len(a.samples))
+	for _, v := range a.samples {
+		r = append(r, *v)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Addr < r[j].Addr })
+	return r
+}
+
+func (a *Allocator) sampleHeap(p uintptr, size int) {
+	if a.nextSample -= size; a.nextSample > 0 {
+		return
+	}
+
+	// The intervals between samples are exponentially distributed, so that
+	// every allocated byte has the same chance to be sampled.
+	rate := float64(a.ProfileRate)
+	a.nextSample = int(rand.ExpFloat64()*rate) + 1
+	s := &HeapSample{Addr: p, Size: size, Bytes: size}
+	if q := 1 - math.Exp(-float64(size)/rate); q > 0 {
+		s.Bytes = int(float64(size) / q)
+	}
+	if a.ProfileStacks {
+		var pc [32]uintptr
+		n := runtime.Callers(4, pc[:])
+		s.Stack = append([]uintptr(nil), pc[:n]...)
+	}
+	if a.samples == nil {
+		a.samples = map[uintptr]*HeapSample{}
+	}
+	a.samples[p] = s
+}
@@ -0,0 +1,141 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// QuotaError describes an allocation exceeding the quota of its tag, see
+// Allocator.SetQuota. It's reported as the Err of an *Error of Kind ErrLimit.
+type QuotaError struct {
+	Tag   string // The tag of the allocation.
+	Limit int    // The quota of Tag.
+	Used  int    // Bytes allocated with Tag before the allocation.
+	Size  int    // Requested size.
+}
+
+// Error implements error.
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tag %q: quota %#x, used %#x, requested %#x", e.Tag, e.Limit, e.Used, e.Size)
+}
+
+// tagQuota is the accounting of a tag.
+type tagQuota struct {
+	tag   string
+	limit int
+	used  int
+}
+
+// taggedAlloc is the tag of an allocation and the size charged to it.
+type taggedAlloc struct {
+	q    *tagQuota
+	size int
+}
+
+// SetQuota limits the sum of the requested sizes of the live allocations
+// tagged with tag, see MallocTag, to limit bytes. Allocations exceeding the
+// quota fail with an *Error of Kind ErrLimit wrapping a *QuotaError. A zero or
+// negative limit removes the quota. Setting a quota below the current usage
+// does not affect the existing allocations.
+func (a *Allocator) SetQuota(tag string, limit int) { a.tagQuota(tag).limit = limit }
+
+// TagUsage returns the sum of the requested sizes of the live allocations
+// tagged with tag.
+func (a *Allocator) TagUsage(tag string) int {
+	if q := a.quotas[tag]; q != nil {
+		return q.used
+	}
+
+	return 0
+}
+
+// TagOf returns the tag of the allocation at p or an empty string if it has
+// none.
+func (a *Allocator) TagOf(p uintptr) string {
+	if t, ok := a.tagged[untag(p)]; ok {
+		return t.q.tag
+	}
+
+	return ""
+}
+
+// MallocTag is like Malloc except the allocation is tagged with tag and
+// charged to its quota, see SetQuota. Realloc keeps the tag, Free releases the
+// charge. An empty tag is like no tag.
+func (a *Allocator) MallocTag(tag string, size int) (r []byte, err error) {
+	p, err := a.UintptrMallocTag(tag, size)
+	if p == 0 || err != nil {
+		return nil, err
+	}
+
+	return a.slice(p, size), nil
+}
+
+// UintptrMallocTag is like MallocTag except it returns an uintptr.
+func (a *Allocator) UintptrMallocTag(tag string, size int) (r uintptr, err error) {
+	if tag == "" {
+		return a.UintptrMalloc(size)
+	}
+
+	return a.mallocTag(a.tagQuota(tag), size)
+}
+
+// UnsafeMallocTag is like MallocTag except it returns an unsafe.Pointer.
+func (a *Allocator) UnsafeMallocTag(tag string, size int) (r unsafe.Pointer, err error) {
+	p, err := a.UintptrMallocTag(tag, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Pointer(p), nil
+}
+
+func (a *Allocator) tagQuota(tag string) *tagQuota {
+	q := a.quotas[tag]
+	if q == nil {
+		if a.quotas == nil {
+			a.quotas = map[string]*tagQuota{}
+		}
+		q = &tagQuota{tag: tag}
+		a.quotas[tag] = q
+	}
+	return q
+}
+
+func (a *Allocator) mallocTag(q *tagQuota, size int) (r uintptr, err error) {
+	if err := q.check(size); err != nil {
+		return 0, err
+	}
+
+	if r, err = a.UintptrMalloc(size); r == 0 || err != nil {
+		return r, err
+	}
+
+	if a.tagged == nil {
+		a.tagged = map[uintptr]taggedAlloc{}
+	}
+	a.tagged[untag(r)] = taggedAlloc{q, size}
+	q.used += size
+	return r, nil
+}
+
+// check returns an error if charging size more bytes to q exceeds its limit.
+func (q *tagQuota) check(size int) error {
+	if q.limit > 0 && size > q.limit-q.used {
+		return &Error{Op: "malloc", Size: size, Kind: ErrLimit, Err: &QuotaError{Tag: q.tag, Limit: q.limit, Used: q.used, Size: size}}
+	}
+
+	return nil
+}
+
+// untagAlloc releases the charge of the allocation at p, if any.
+func (a *Allocator) untagAlloc(p uintptr) {
+	if t, ok := a.tagged[p]; ok {
+		t.q.used -= t.size
+		delete(a.tagged, p)
+	}
+}
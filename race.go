@@ -0,0 +1,27 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build race
+// +build race
+
+package memory
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+const raceEnabled = true
+
+// raceAlloc tells the race detector that the block at p, about to be handed
+// out, is ordered after its last free.
+func raceAlloc(p uintptr) { runtime.RaceAcquire(unsafe.Pointer(p)) }
+
+// raceFree tells the race detector that the size bytes at p are being freed.
+// The free is recorded as a write, so accesses racing with it are reported,
+// and as a release to be acquired by raceAlloc when the block is reused.
+func raceFree(p uintptr, size int) {
+	runtime.RaceWriteRange(unsafe.Pointer(p), size)
+	runtime.RaceReleaseMerge(unsafe.Pointer(p))
+}
@@ -0,0 +1,80 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// refHeader precedes the memory of a RefCounted allocation.
+type refHeader struct {
+	refs int64
+	size int64
+}
+
+var refHeaderSize = roundup(int(unsafe.Sizeof(refHeader{})), mallocAllign)
+
+// RefCounted is a reference counted allocation shared by multiple owners. The
+// count lives in allocator memory next to the allocation, all copies of a
+// RefCounted refer to the same count. Retain and Release are safe for
+// concurrent use, but the Release dropping the last reference frees the
+// memory and must be serialized with other uses of the Allocator.
+type RefCounted struct {
+	a *Allocator
+	h *refHeader
+}
+
+// NewRefCounted allocates size bytes of zeroed memory with a reference count
+// of one.
+func (a *Allocator) NewRefCounted(size int) (RefCounted, error) {
+	if size < 0 {
+		return RefCounted{}, a.invalidSize("malloc", size)
+	}
+
+	if size > maxMalloc-refHeaderSize {
+		return RefCounted{}, &Error{Op: "malloc", Size: size, Kind: ErrOOM}
+	}
+
+	p, err := a.UnsafeCalloc(refHeaderSize + size)
+	if err != nil {
+		return RefCounted{}, err
+	}
+
+	h := (*refHeader)(p)
+	h.refs, h.size = 1, int64(size)
+	return RefCounted{a, h}, nil
+}
+
+// Bytes returns the memory of r.
+func (r RefCounted) Bytes() []byte { return unsafe.Slice((*byte)(r.Pointer()), r.h.size) }
+
+// Pointer returns the address of the memory of r.
+func (r RefCounted) Pointer() unsafe.Pointer { return unsafe.Add(unsafe.Pointer(r.h), refHeaderSize) }
+
+// Refs returns the current reference count of r.
+func (r RefCounted) Refs() int { return int(atomic.LoadInt64(&r.h.refs)) }
+
+// Release drops a reference to r and frees its memory when the count reaches
+// zero, reporting whether it did. r must not be used after its last Release.
+func (r RefCounted) Release() (freed bool, err error) {
+	switch n := atomic.AddInt64(&r.h.refs, -1); {
+	case n > 0:
+		return false, nil
+	case n < 0:
+		return false, &Error{Op: "release", Addr: uintptr(r.Pointer()), Kind: ErrCorrupted}
+	}
+
+	return true, r.a.UnsafeFree(unsafe.Pointer(r.h))
+}
+
+// Retain adds a reference to r and returns r.
+func (r RefCounted) Retain() RefCounted {
+	atomic.AddInt64(&r.h.refs, 1)
+	return r
+}
+
+// Size returns the size of the memory of r.
+func (r RefCounted) Size() int { return int(r.h.size) }
@@ -0,0 +1,69 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// Reset frees all allocations of a at once. Unlike Close, it keeps the shared
+// pages mapped, so that a can be reused, eg. between the phases of a program,
+// without asking the OS for memory again. Pages of allocations larger than the
+// largest size class, including headerless ones, are unmapped. The contents of
+// the retained pages are not zeroed, unless Options.ZeroOnFree is set. Adopted
+// regions are released.
+//
+// All memory allocated by a before the call becomes invalid, including that
+// of Auto values and of pending DeferFree calls. The cumulative counters
+// reported by Stats account for the released allocations as freed.
+func (a *Allocator) Reset() (err error) {
+	a.releaseAdopted()
+	a.spare, a.empty = [64][]*page{}, [64]*page{}
+	for p, n := range a.bare {
+		if e := a.unmapBare(p, n); e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, pg := range a.pageOrder() {
+		if pg.log == 0 {
+			a.bytes.Add(-int64(pg.size))
+			if e := a.unmap(pg); e != nil && err == nil {
+				err = e
+			}
+			continue
+		}
+
+		if a.ZeroOnFree {
+			a.wipeRange(uintptr(unsafe.Pointer(pg))+uintptr(slotBase(pg.log)), pg.brk<<pg.log)
+		}
+		pg.brk, pg.used = 0, 0
+		pg.free, pg.prev, pg.next = nil, nil, nil
+		if a.pages[pg.log] == nil {
+			a.pages[pg.log] = pg
+			a.dirty[pg.log] = true
+			continue
+		}
+
+		if a.pages[pg.log] == pg {
+			a.dirty[pg.log] = true
+			continue
+		}
+
+		a.spare[pg.log] = append(a.spare[pg.log], pg)
+	}
+	a.lists = [64]*page{}
+	a.requested, a.sizes = 0, nil
+	a.allocs.Store(0)
+	a.frees.Store(a.mallocs.Load())
+	a.freed.Store(a.allocated.Load())
+	a.deferred, a.orphans = nil, nil
+	a.marked, a.marks = nil, nil
+	a.born, a.samples = nil, nil
+	a.tagged = nil
+	for _, q := range a.quotas {
+		q.used = 0
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"time"
+)
+
+// retainPage keeps the empty shared page pg mapped as the spare page of its
+// size class, releasing the page retained before, if any.
+func (a *Allocator) retainPage(pg *page) error {
+	now := time.Now()
+	err := a.expireEmpty(now)
+	log := pg.log
+	if a.empty[log] != nil {
+		if e := a.dropEmpty(log); e != nil && err == nil {
+			err = e
+		}
+	}
+	pg.brk = 0
+	a.spare[log] = append(a.spare[log], pg)
+	a.empty[log], a.emptyAt[log] = pg, now
+	return err
+}
+
+// expireEmpty releases the retained pages older than Options.RetainEmpty.
+func (a *Allocator) expireEmpty(now time.Time) (err error) {
+	if a.RetainEmpty <= 0 {
+		return nil
+	}
+
+	for log, pg := range a.empty {
+		if pg != nil && now.Sub(a.emptyAt[log]) > a.RetainEmpty {
+			if e := a.dropEmpty(uint(log)); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// dropEmpty unmaps the retained page of size class log.
+func (a *Allocator) dropEmpty(log uint) error {
+	pg := a.empty[log]
+	a.empty[log] = nil
+	l := a.spare[log]
+	for i, v := range l {
+		if v == pg {
+			a.spare[log] = append(l[:i], l[i+1:]...)
+			break
+		}
+	}
+	a.bytes.Add(-int64(pg.size))
+	return a.unmap(pg)
+}
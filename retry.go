@@ -0,0 +1,58 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryPolicy configures retrying of failed requests for memory from the
+// Backend, which can help to survive transient address space or commit charge
+// pressure.
+type RetryPolicy struct {
+	Retries int           // Number of retries after the first failure.
+	Backoff time.Duration // Delay before the first retry, doubled for every next one.
+	Trim    bool          // Call Trim before every retry.
+}
+
+// LastMmapError returns the error of the last failed request for memory from
+// the backend, eg. a syscall.Errno, or nil if there was none. Stats reports
+// the number of failures.
+func (a *Allocator) LastMmapError() error { return a.mmapErr }
+
+// retryOOM reports whether the allocation of size bytes, which failed with
+// err, should be retried, see Options.OnOOM.
+func (a *Allocator) retryOOM(size int, err error) bool {
+	return a.OnOOM != nil && (errors.Is(err, ErrOOM) || errors.Is(err, ErrLimit)) && a.OnOOM(size)
+}
+
+// mapRetry maps size bytes aligned to align, retrying according to
+// a.MmapRetry.
+func (a *Allocator) mapRetry(size, align int) (p uintptr, n int, err error) {
+	backoff := a.MmapRetry.Backoff
+	for i := 0; ; i++ {
+		if a.MmapFault != nil {
+			err = a.MmapFault(size, int(a.bytes.Load()))
+		}
+		if err == nil {
+			if p, n, err = a.backend().Map(size, align); err == nil {
+				return p, n, nil
+			}
+		}
+
+		a.mmapFailures.Add(1)
+		a.mmapErr = err
+		if i >= a.MmapRetry.Retries {
+			return 0, 0, err
+		}
+
+		if a.MmapRetry.Trim {
+			a.Trim()
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// RingBuffer returns a buffer for wrap around free ring buffers. The returned
+// slice has length 2*n, where n is size rounded up to a multiple of the OS page
+// size, and its two halves are mappings of the same memory, so b[i] and b[i+n]
+// are the same byte for every i < n. Reads and writes of up to n bytes
+// starting anywhere in the first half are thus contiguous even when they wrap
+// around the end of the ring. The memory is zeroed.
+//
+// RingBuffer is supported on Linux, elsewhere it returns ErrUnsupported. The
+// buffer must be released by FreeRingBuffer.
+func RingBuffer(size int) (b []byte, err error) {
+	if size <= 0 || size > maxMalloc/2 {
+		return nil, &Error{Op: "ring", Size: size, Kind: ErrInvalidSize}
+	}
+
+	size = roundup(size, osPageSize)
+	p, err := mapRing(size)
+	if err != nil {
+		return nil, &Error{Op: "ring", Size: size, Kind: ErrOOM, Err: err}
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), 2*size), nil
+}
+
+// FreeRingBuffer releases a buffer returned by RingBuffer.
+func FreeRingBuffer(b []byte) error {
+	if len(b) == 0 || len(b) != cap(b) || len(b)%(2*osPageSize) != 0 {
+		return syscall.EINVAL
+	}
+
+	return unmap(uintptr(unsafe.Pointer(&b[0])), len(b))
+}
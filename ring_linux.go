@@ -0,0 +1,47 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	_MREMAP_MAYMOVE = 1
+	_MREMAP_FIXED   = 2
+)
+
+// mapRing reserves 2*size bytes of address space and replaces both of its
+// halves by duplicates of a shared anonymous mapping. Calling mremap with
+// old_size zero creates a new mapping of the same pages of a shared mapping.
+func mapRing(size int) (uintptr, error) {
+	r, err := syscall.Mmap(-1, 0, 2*size, syscall.PROT_NONE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return 0, err
+	}
+
+	base := uintptr(unsafe.Pointer(&r[0]))
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_ANON)
+	if err != nil {
+		unmap(base, 2*size)
+		return 0, err
+	}
+
+	p := uintptr(unsafe.Pointer(&b[0]))
+	defer unmap(p, size)
+
+	for _, addr := range []uintptr{base, base + uintptr(size)} {
+		q, _, errno := syscall.Syscall6(syscall.SYS_MREMAP, p, 0, uintptr(size), _MREMAP_MAYMOVE|_MREMAP_FIXED, addr, 0)
+		if errno != 0 || q != addr {
+			unmap(base, 2*size)
+			if errno == 0 {
+				errno = syscall.EINVAL
+			}
+			return 0, errno
+		}
+	}
+	return base, nil
+}
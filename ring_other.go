@@ -0,0 +1,10 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package memory
+
+func mapRing(size int) (uintptr, error) { return 0, ErrUnsupported }
@@ -0,0 +1,33 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// sanLink is the size of the head of a free slot used by the allocator to link
+// it, which is never poisoned.
+const sanLink = 8
+
+// sanFree poisons the block of size bytes at p, which is being freed, except
+// its link word.
+func sanFree(p uintptr, size int) { sanPoison(p+sanLink, size-sanLink) }
+
+// sanPoisonFree poisons the free slots of the shared page pg.
+func sanPoisonFree(pg *page) {
+	if pg.log == 0 {
+		return
+	}
+
+	for n := pg.free; n != nil; n = n.next {
+		sanFree(uintptr(unsafe.Pointer(n)), 1<<pg.log)
+	}
+}
+
+// sanUnpoisonPage makes all of the page pg accessible.
+func sanUnpoisonPage(pg *page) {
+	sanUnpoison(uintptr(unsafe.Pointer(pg))+uintptr(headerSize), pg.size-headerSize)
+}
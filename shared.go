@@ -0,0 +1,327 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/cznic/mathutil"
+)
+
+const (
+	sharedMagic    = 0x3130_4d48_534d454d // "MEMSHM01"
+	sharedBlock    = 16                   // Size of the block header preceding every allocation.
+	sharedMinLog   = 5                    // Smallest block is 32 bytes.
+	sharedInit     = 1                    // sharedHeader.state: being initialized.
+	sharedReady    = 2                    // sharedHeader.state: initialized.
+	sharedGenShift = 48                   // Position of the generation in a Handle.
+	sharedGenMask  = 1<<16 - 1
+	sharedOffMask  = 1<<sharedGenShift - 1
+)
+
+// The block header holds the size class of the block in its first word and
+// the generation of the block in the second one. The generation is
+// incremented by every Malloc and Free of the block, it is odd for allocated
+// blocks and even for free ones, so Handles of freed blocks no longer match
+// it.
+
+// sharedHeader is at offset 0 of a shared heap. All positions are offsets
+// from the start of the mapping.
+type sharedHeader struct {
+	magic uint64
+	state uint32
+	alock uint32 // Allocator lock.
+	ulock uint32 // User lock, see SharedHeap.Lock.
+	_     uint32
+	size  uint64
+	brk   uint64
+	root  uint64
+	lists [64]uint64 // Free blocks by size class, linked through their first word.
+}
+
+// SharedHeap is an allocator in named shared memory. Cooperating processes
+// opening the same name see the same heap, although usually at different
+// addresses. Allocations are therefore identified by Handles, offsets from
+// the start of the heap, which are valid in all processes. Objects in the heap
+// must refer to each other by Handles as well.
+//
+// The allocator state lives in the shared memory and is protected by a spin
+// lock, so the methods of SharedHeap may be used concurrently by any number of
+// processes and goroutines. The contents of the objects are not protected,
+// Lock and Unlock provide a process shared lock for that purpose. A process
+// dying while holding a lock leaves it locked.
+//
+// Blocks are power of two sized and never coalesced, SharedHeap suits heaps of
+// similarly sized objects better than general purpose use.
+//
+// Handles returned by Malloc, Calloc and Handle carry the generation of their
+// block in their top 16 bits, the offset is in the lower 48 bits. Resolving or
+// freeing such a Handle after its block was freed fails, even when the block
+// was reused in the meantime, instead of aliasing the new object. Handles with
+// a zero generation are not checked by Resolve, Free rejects them for free
+// blocks.
+type SharedHeap struct {
+	b    []byte
+	f    *os.File
+	hdr  *sharedHeader
+	base uintptr
+}
+
+// SharedHeapPath returns the file backing the shared heap name. On Linux that
+// is /dev/shm/name, like shm_open does, elsewhere name is located in
+// os.TempDir. Absolute names are returned as is.
+func SharedHeapPath(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+
+	if runtime.GOOS == "linux" {
+		if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+			return filepath.Join("/dev/shm", name)
+		}
+	}
+
+	return filepath.Join(os.TempDir(), name)
+}
+
+// OpenSharedHeap opens the shared heap name, creating it with the given size
+// if it doesn't exist. The size of an existing heap is not changed.
+func OpenSharedHeap(name string, size int) (*SharedHeap, error) {
+	f, err := os.OpenFile(SharedHeapPath(name), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	hsize := roundup(int(unsafe.Sizeof(sharedHeader{})), osPageSize)
+	if fi.Size() == 0 {
+		if size < hsize || size > maxMalloc {
+			f.Close()
+			return nil, &Error{Op: "open", Size: size, Kind: ErrInvalidSize}
+		}
+
+		if err := f.Truncate(int64(size)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	} else {
+		if size = int(fi.Size()); size < hsize {
+			f.Close()
+			return nil, fmt.Errorf("memory: %s is not a shared heap", name)
+		}
+	}
+
+	b, err := mapFile(f, 0, size, MapWrite)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	h := &SharedHeap{b: b, f: f, hdr: (*sharedHeader)(unsafe.Pointer(&b[0])), base: uintptr(unsafe.Pointer(&b[0]))}
+	switch {
+	case atomic.CompareAndSwapUint32(&h.hdr.state, 0, sharedInit):
+		h.hdr.magic = sharedMagic
+		h.hdr.size = uint64(size)
+		h.hdr.brk = uint64(hsize)
+		atomic.StoreUint32(&h.hdr.state, sharedReady)
+	default:
+		for atomic.LoadUint32(&h.hdr.state) != sharedReady {
+			runtime.Gosched()
+		}
+	}
+	if h.hdr.magic != sharedMagic || h.hdr.size != uint64(size) {
+		h.Close()
+		return nil, fmt.Errorf("memory: %s is not a shared heap", name)
+	}
+
+	return h, nil
+}
+
+// RemoveSharedHeap removes the shared heap name. Processes which have it open
+// can continue to use it.
+func RemoveSharedHeap(name string) error { return os.Remove(SharedHeapPath(name)) }
+
+// Close unmaps the shared heap. The heap itself persists until removed by
+// RemoveSharedHeap.
+func (h *SharedHeap) Close() error {
+	err := unmapFile(h.b)
+	if e := h.f.Close(); e != nil && err == nil {
+		err = e
+	}
+	*h = SharedHeap{}
+	return err
+}
+
+// Calloc is like Malloc except the allocated memory is zeroed.
+func (h *SharedHeap) Calloc(size int) (Handle, error) {
+	r, err := h.Malloc(size)
+	if err != nil || r == 0 {
+		return r, err
+	}
+
+	clear(unsafe.Slice((*byte)(unsafe.Pointer(h.Resolve(r))), size))
+	return r, nil
+}
+
+// Free releases the allocation r.
+func (h *SharedHeap) Free(r Handle) error {
+	if r == 0 {
+		return nil
+	}
+
+	off := uint64(r) & sharedOffMask
+	if off < sharedBlock || off >= h.hdr.size || off&(sharedBlock-1) != 0 {
+		return &Error{Op: "free", Addr: uintptr(r), Kind: ErrInvalidPointer}
+	}
+
+	blk := off - sharedBlock
+	log := *h.word(blk)
+	if log < sharedMinLog || log >= 64 || blk+1<<log > h.hdr.size {
+		return &Error{Op: "free", Addr: uintptr(r), Kind: ErrCorrupted}
+	}
+
+	h.lock()
+	gen := atomic.LoadUint64(h.word(blk + 8))
+	if g := uint64(r) >> sharedGenShift; gen&1 == 0 || g != 0 && g != gen {
+		h.unlock()
+		return &Error{Op: "free", Addr: uintptr(r), Kind: ErrStale}
+	}
+
+	atomic.StoreUint64(h.word(blk+8), (gen+1)&sharedGenMask)
+	*h.word(off) = h.hdr.lists[log]
+	h.hdr.lists[log] = blk
+	h.unlock()
+	return nil
+}
+
+// Flush writes the pages of h overlapping [p, p+size) to the file backing h.
+// Changes to the heap are usually written by the OS eventually, Flush makes
+// them durable when it returns.
+func (h *SharedHeap) Flush(p unsafe.Pointer, size int) error {
+	off := uintptr(p) - h.base
+	if size < 0 || off >= uintptr(len(h.b)) || size > len(h.b)-int(off) {
+		return &Error{Op: "flush", Addr: uintptr(p), Size: size, Kind: ErrInvalidPointer}
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	lo := off &^ uintptr(osPageMask)
+	hi := roundup(int(off)+size, osPageSize)
+	return syncFile(h.f, h.base+lo, hi-int(lo))
+}
+
+// FlushAll writes all pages of h to the file backing h.
+func (h *SharedHeap) FlushAll() error { return syncFile(h.f, h.base, len(h.b)) }
+
+// Handle returns the Handle of p, which must be the address of an allocated
+// object of h as returned by Resolve, or zero if p is not in h. The Handle
+// carries the current generation of the block of p.
+func (h *SharedHeap) Handle(p uintptr) Handle {
+	off := uint64(p - h.base)
+	if off >= uint64(len(h.b)) {
+		return 0
+	}
+
+	if off < sharedBlock || off&(sharedBlock-1) != 0 {
+		return Handle(off)
+	}
+
+	return Handle(atomic.LoadUint64(h.word(off-sharedBlock+8))<<sharedGenShift | off)
+}
+
+// Lock acquires the user lock of h, shared by all processes using h.
+func (h *SharedHeap) Lock() { spinLock(&h.hdr.ulock) }
+
+// Malloc allocates size bytes and returns their Handle. The memory is not
+// zeroed. Malloc returns a zero Handle for a zero size.
+func (h *SharedHeap) Malloc(size int) (Handle, error) {
+	if size < 0 || size > maxMalloc {
+		return 0, &Error{Op: "malloc", Size: size, Kind: ErrInvalidSize}
+	}
+
+	if size == 0 {
+		return 0, nil
+	}
+
+	log := uint64(mathutil.BitLen(roundup(size+sharedBlock, sharedBlock) - 1))
+	if log < sharedMinLog {
+		log = sharedMinLog
+	}
+	h.lock()
+	defer h.unlock()
+
+	blk := h.hdr.lists[log]
+	switch {
+	case blk != 0:
+		h.hdr.lists[log] = *h.word(blk + sharedBlock)
+	case h.hdr.size-h.hdr.brk >= 1<<log:
+		blk = h.hdr.brk
+		h.hdr.brk += 1 << log
+	default:
+		return 0, &Error{Op: "malloc", Size: size, Kind: ErrOOM}
+	}
+	*h.word(blk) = log
+	gen := (atomic.LoadUint64(h.word(blk+8)) + 1) & sharedGenMask
+	atomic.StoreUint64(h.word(blk+8), gen)
+	return Handle(gen<<sharedGenShift | (blk + sharedBlock)), nil
+}
+
+// Resolve returns the address of r in this process or zero if r is zero, out
+// of range or stale.
+func (h *SharedHeap) Resolve(r Handle) uintptr {
+	off := uint64(r) & sharedOffMask
+	if r == 0 || off >= uint64(len(h.b)) {
+		return 0
+	}
+
+	if g := uint64(r) >> sharedGenShift; g != 0 {
+		if off < sharedBlock || off&(sharedBlock-1) != 0 || atomic.LoadUint64(h.word(off-sharedBlock+8)) != g {
+			return 0
+		}
+	}
+
+	return h.base + uintptr(off)
+}
+
+// Root returns the Handle last set by SetRoot, a well known object through
+// which processes can find the other objects in h.
+func (h *SharedHeap) Root() Handle { return Handle(atomic.LoadUint64(&h.hdr.root)) }
+
+// SetRoot sets the Handle returned by Root.
+func (h *SharedHeap) SetRoot(r Handle) { atomic.StoreUint64(&h.hdr.root, uint64(r)) }
+
+// Size returns the size of h.
+func (h *SharedHeap) Size() int { return len(h.b) }
+
+// Unlock releases the user lock of h.
+func (h *SharedHeap) Unlock() { atomic.StoreUint32(&h.hdr.ulock, 0) }
+
+func (h *SharedHeap) lock() { spinLock(&h.hdr.alock) }
+
+func (h *SharedHeap) unlock() { atomic.StoreUint32(&h.hdr.alock, 0) }
+
+func (h *SharedHeap) word(off uint64) *uint64 {
+	return (*uint64)(unsafe.Pointer(h.base + uintptr(off)))
+}
+
+func spinLock(p *uint32) {
+	for i := 0; !atomic.CompareAndSwapUint32(p, 0, 1); i++ {
+		if i >= 100 {
+			runtime.Gosched()
+		}
+	}
+}
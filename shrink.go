@@ -0,0 +1,60 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// shrinkInPlace returns the OS pages of the block p, which has a mapping of
+// its own, past its first size bytes to the OS, provided at least half of the
+// block becomes unused. On Unix systems the tail of the mapping is unmapped,
+// on Windows it is decommitted and stays reserved. Elsewhere, and for
+// backends other than OSBackend, the block is left as it is.
+func (a *Allocator) shrinkInPlace(p uintptr, size int) {
+	if _, ok := a.backend().(*OSBackend); !ok || a.tagging() {
+		return
+	}
+
+	var pg *page
+	base := p
+	n, bare := a.bare[p]
+	if !bare {
+		if pg = a.pageOf(p); pg.log != 0 {
+			return
+		}
+
+		base, n = uintptr(unsafe.Pointer(pg)), pg.size
+	}
+	off := int(p - base)
+	keep := roundup(off+size, osPageSize)
+	if n-keep < osPageSize || 2*size > n-off {
+		return
+	}
+
+	ps := a.pageSize()
+	if pg != nil && ps != pageSize {
+		unindexPage(pg, ps)
+	}
+	if sanEnabled {
+		sanUnpoison(base+uintptr(keep), n-keep)
+	}
+	if a.ZeroOnFree {
+		a.wipeRange(base+uintptr(keep), n-keep)
+	}
+	if shrinkMap(base, n, keep) == nil {
+		a.bytes.Add(-int64(n - keep))
+		a.freed.Add(uint64(n - keep))
+		switch {
+		case bare:
+			a.bare[p] = keep
+		default:
+			pg.size = keep
+		}
+	}
+	if pg != nil && ps != pageSize {
+		indexPage(pg, ps)
+	}
+}
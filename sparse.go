@@ -0,0 +1,102 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// Sparse is a large range of address space for sparse data structures, eg.
+// huge hash tables or tables indexed by address, of which only a fraction is
+// ever touched. On Unix systems the range is mapped readable and writable,
+// with MAP_NORESERVE on Linux, and physical memory is assigned to its pages on
+// first access. On Windows the range is only reserved, with PAGE_NOACCESS,
+// and its parts must be committed by Commit before they are accessed.
+// Portable code therefore commits every part of the range before its first
+// use.
+//
+// Sparse is not safe for concurrent use.
+type Sparse struct {
+	base uintptr
+	size int
+}
+
+// NewSparse maps a Sparse range of size bytes, rounded up to the OS page size.
+// The memory of the range is zeroed. It returns an error wrapping
+// ErrUnsupported on platforms which can not map memory lazily.
+func NewSparse(size int) (*Sparse, error) {
+	if size <= 0 || size > maxMalloc {
+		return nil, &Error{Op: "reserve", Size: size, Kind: ErrInvalidSize}
+	}
+
+	size = roundup(size, osPageSize)
+	p, err := reserveSparse(size)
+	if err != nil {
+		return nil, &Error{Op: "reserve", Size: size, Kind: ErrOOM, Err: err}
+	}
+
+	return &Sparse{base: p, size: size}, nil
+}
+
+// Base returns the address of the range.
+func (s *Sparse) Base() uintptr { return s.base }
+
+// Size returns the size of the range.
+func (s *Sparse) Size() int { return s.size }
+
+// Bytes returns the range as a slice.
+func (s *Sparse) Bytes() []byte {
+	if s.size == 0 {
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(s.base)), s.size)
+}
+
+// pages returns the OS pages covering size bytes at offset off of the range.
+func (s *Sparse) pages(op string, off, size int) (uintptr, int, error) {
+	if off < 0 || size < 0 || off > s.size || size > s.size-off {
+		return 0, 0, &Error{Op: op, Addr: s.base + uintptr(off), Size: size, Kind: ErrInvalidSize}
+	}
+
+	lo := off &^ osPageMask
+	return s.base + uintptr(lo), roundup(off+size, osPageSize) - lo, nil
+}
+
+// Commit makes size bytes at offset off of the range, extended to whole OS
+// pages, accessible. Committing an accessible part has no effect on its
+// contents.
+func (s *Sparse) Commit(off, size int) error {
+	p, n, err := s.pages("commit", off, size)
+	if err != nil || n == 0 {
+		return err
+	}
+
+	return commit(p, n)
+}
+
+// Decommit releases the physical memory of size bytes at offset off of the
+// range, extended to whole OS pages, which must be committed. The part must
+// not be accessed until it is committed again, after which it reads as
+// zeroes.
+func (s *Sparse) Decommit(off, size int) error {
+	p, n, err := s.pages("decommit", off, size)
+	if err != nil || n == 0 {
+		return err
+	}
+
+	return decommit(p, n)
+}
+
+// Close unmaps the range.
+func (s *Sparse) Close() error {
+	if s.size == 0 {
+		return nil
+	}
+
+	err := release(s.base, s.size)
+	s.base, s.size = 0, 0
+	return err
+}
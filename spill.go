@@ -0,0 +1,112 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"io"
+	"os"
+)
+
+// SpillBuffer is a FIFO byte buffer with Read and Write methods. Written data
+// is kept in memory of an Allocator until its size would exceed a threshold,
+// the data written after that goes to a temporary file. Reads return the data
+// in the order it was written, first from memory, then from the file. It's
+// intended for large intermediate results, eg. of sorting, which usually fit
+// in memory, but need not.
+//
+// A SpillBuffer must be released by Close.
+type SpillBuffer struct {
+	dir       string
+	f         *os.File // Nil if not spilled.
+	mem       *Buffer
+	roff      int64 // Read position in f.
+	threshold int
+	woff      int64 // Size of f.
+}
+
+// NewSpillBuffer returns a SpillBuffer allocating from a. At most threshold
+// bytes are kept in memory, zero or negative threshold means no limit. The
+// temporary file is created in dir, or in the default directory for
+// temporary files if dir is empty.
+func NewSpillBuffer(a *Allocator, threshold int, dir string) *SpillBuffer {
+	return &SpillBuffer{dir: dir, mem: NewBuffer(a), threshold: threshold}
+}
+
+// Close releases the memory of b and removes its temporary file, if any.
+func (b *SpillBuffer) Close() error {
+	err := b.mem.Close()
+	if b.f != nil {
+		if e := b.removeFile(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (b *SpillBuffer) removeFile() error {
+	f := b.f
+	b.f, b.roff, b.woff = nil, 0, 0
+	err := f.Close()
+	if e := os.Remove(f.Name()); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Len returns the number of unread bytes of b.
+func (b *SpillBuffer) Len() int64 { return int64(b.mem.Len()) + b.woff - b.roff }
+
+// Read implements io.Reader.
+func (b *SpillBuffer) Read(p []byte) (n int, err error) {
+	if b.mem.Len() != 0 {
+		return b.mem.Read(p)
+	}
+
+	if b.roff == b.woff {
+		if b.f != nil {
+			// Drained, continue in memory.
+			if err := b.removeFile(); err != nil {
+				return 0, err
+			}
+		}
+		return b.mem.Read(p)
+	}
+
+	if m := b.woff - b.roff; int64(len(p)) > m {
+		p = p[:m]
+	}
+	n, err = b.f.ReadAt(p, b.roff)
+	b.roff += int64(n)
+	if err == io.EOF && n != 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Spilled reports whether b currently uses a temporary file.
+func (b *SpillBuffer) Spilled() bool { return b.f != nil }
+
+// Write implements io.Writer.
+func (b *SpillBuffer) Write(p []byte) (n int, err error) {
+	if b.f == nil {
+		n = len(p)
+		if b.threshold > 0 {
+			if room := b.threshold - b.mem.Len(); n > room {
+				n = room
+			}
+		}
+		if n, err = b.mem.Write(p[:n]); err != nil || n == len(p) {
+			return n, err
+		}
+
+		if b.f, err = os.CreateTemp(b.dir, "memory-spill-*"); err != nil {
+			return n, err
+		}
+	}
+
+	m, err := b.f.Write(p[n:])
+	b.woff += int64(m)
+	return n + m, err
+}
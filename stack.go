@@ -0,0 +1,202 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// stackChunkSize is the minimum size of a Stack chunk.
+const stackChunkSize = 64 << 10
+
+// Stack is a LIFO scratch allocator. Push bumps a pointer within chunks
+// allocated from an Allocator and Pop moves it back, which makes the pair the
+// cheapest way of obtaining temporary memory, eg. for the scratch space of
+// recursive algorithms. Blocks must be popped in the reverse order of their
+// pushing. When MEMORY_DEBUG is set, Pop enforces that and fails for any
+// block other than the last one pushed. Otherwise popping a block pops all
+// the blocks pushed after it as well.
+//
+// A Stack is not safe for concurrent use. It must be released by Close.
+type Stack struct {
+	a      *Allocator
+	chunks []stackChunk
+	end    uintptr   // End of the current chunk.
+	live   []uintptr // Pushed blocks, tracked only when MEMORY_DEBUG is set.
+	spare  uintptr   // An emptied chunk kept for reuse.
+	sp     uintptr   // Next free byte of the current chunk.
+}
+
+type stackChunk struct {
+	base uintptr
+	prev uintptr // sp of the previous chunk.
+}
+
+// NewStack returns a Stack allocating from a.
+func NewStack(a *Allocator) *Stack { return &Stack{a: a} }
+
+// Push returns a block of size bytes. The contents of the block are
+// undefined. Zero size returns (nil, nil).
+func (s *Stack) Push(size int) ([]byte, error) {
+	p, err := s.UintptrPush(size)
+	if p == 0 || err != nil {
+		return nil, err
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), size), nil
+}
+
+// UintptrPush is like Push except it returns an uintptr.
+func (s *Stack) UintptrPush(size int) (r uintptr, err error) {
+	if size <= 0 || size > maxMalloc {
+		if size == 0 {
+			return 0, nil
+		}
+
+		return 0, s.a.invalidSize("push", size)
+	}
+
+	n := uintptr(roundup(size, mallocAllign))
+	if s.end-s.sp < n {
+		if err := s.grow(int(n)); err != nil {
+			return 0, err
+		}
+	}
+
+	r = s.sp
+	s.sp += n
+	if debugFlags != 0 {
+		s.live = append(s.live, r)
+	}
+	return r, nil
+}
+
+// UnsafePush is like Push except it returns an unsafe.Pointer.
+func (s *Stack) UnsafePush(size int) (unsafe.Pointer, error) {
+	p, err := s.UintptrPush(size)
+	return unsafe.Pointer(p), err
+}
+
+// Pop pops the block b. Pop of a nil slice is a nop.
+func (s *Stack) Pop(b []byte) error {
+	if cap(b) == 0 {
+		return nil
+	}
+
+	return s.UintptrPop(uintptr(unsafe.Pointer(&b[:1][0])))
+}
+
+// UintptrPop is like Pop except its argument is an uintptr.
+func (s *Stack) UintptrPop(p uintptr) error {
+	if p == 0 {
+		return nil
+	}
+
+	if debugFlags != 0 {
+		if n := len(s.live); n == 0 || s.live[n-1] != p {
+			return &Error{Op: "pop", Addr: p, Kind: ErrInvalidPointer}
+		}
+
+		s.live = s.live[:len(s.live)-1]
+	}
+
+	i := len(s.chunks) - 1
+	for top := s.sp; i >= 0; i-- {
+		c := s.chunks[i]
+		if p >= c.base && p < top {
+			break
+		}
+
+		top = c.prev
+	}
+	if i < 0 {
+		return &Error{Op: "pop", Addr: p, Kind: ErrInvalidPointer}
+	}
+
+	var err error
+	for len(s.chunks) > i+1 {
+		if e := s.shrink(); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.sp = p
+	if p == s.chunks[i].base {
+		if e := s.shrink(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// UnsafePop is like Pop except its argument is an unsafe.Pointer.
+func (s *Stack) UnsafePop(p unsafe.Pointer) error { return s.UintptrPop(uintptr(p)) }
+
+// Reset pops all blocks. One chunk is retained for reuse.
+func (s *Stack) Reset() (err error) {
+	for len(s.chunks) != 0 {
+		if e := s.shrink(); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.live = s.live[:0]
+	return err
+}
+
+// Close pops all blocks and releases the memory of the stack.
+func (s *Stack) Close() error {
+	err := s.Reset()
+	if s.spare != 0 {
+		if e := s.a.UintptrFree(s.spare); e != nil && err == nil {
+			err = e
+		}
+		s.spare = 0
+	}
+	s.live = nil
+	return err
+}
+
+// grow starts a new chunk able to hold n bytes.
+func (s *Stack) grow(n int) error {
+	size := stackChunkSize
+	if n > size {
+		size = n
+	}
+	p := s.spare
+	switch {
+	case p != 0 && s.a.UintptrUsableSize(p) >= size:
+		s.spare = 0
+	default:
+		var err error
+		if p, err = s.a.UintptrMalloc(size); err != nil {
+			return err
+		}
+	}
+
+	s.chunks = append(s.chunks, stackChunk{p, s.sp})
+	s.sp, s.end = p, p+uintptr(s.a.UintptrUsableSize(p))
+	return nil
+}
+
+// shrink drops the current chunk, keeping it as the spare one if it's larger
+// than the spare chunk.
+func (s *Stack) shrink() (err error) {
+	c := s.chunks[len(s.chunks)-1]
+	s.chunks = s.chunks[:len(s.chunks)-1]
+	s.sp, s.end = c.prev, 0
+	if n := len(s.chunks); n != 0 {
+		prev := s.chunks[n-1].base
+		s.end = prev + uintptr(s.a.UintptrUsableSize(prev))
+	}
+	switch {
+	case s.spare == 0:
+		s.spare = c.base
+	case s.a.UintptrUsableSize(c.base) > s.a.UintptrUsableSize(s.spare):
+		s.spare, c.base = c.base, s.spare
+		fallthrough
+	default:
+		err = s.a.UintptrFree(c.base)
+	}
+	return err
+}
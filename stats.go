@@ -0,0 +1,148 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sort"
+	"time"
+)
+
+// Stats reports the state of an Allocator.
+//
+// Allocs, Bytes and Mmaps are current balances. The remaining fields are
+// cumulative counters which never decrease during the lifetime of the
+// Allocator, ie. until it is closed. They are suitable for computing rates.
+// Byte counters reflect the usable size of the blocks, which can be larger
+// than the size requested.
+type Stats struct {
+	Allocs int // Number of live allocations.
+	Bytes  int // Bytes currently mapped from the OS.
+	Mmaps  int // Number of current OS mappings.
+
+	Mallocs        uint64 // Successful allocations, including those done by Calloc and Realloc.
+	Frees          uint64 // Deallocations, including those done by Realloc.
+	Reallocs       uint64 // Calls to Realloc.
+	BytesAllocated uint64 // Total bytes allocated.
+	BytesFreed     uint64 // Total bytes freed.
+	Reclaimed      uint64 // Allocations of unreachable Auto values freed by Reclaim.
+	MmapFailures   uint64 // Failed requests for memory from the backend, including retried ones.
+}
+
+// Stats returns the current statistics of a. The counters are updated
+// atomically, so Stats may be called concurrently with other methods of a,
+// eg. by a monitoring goroutine. The counters are read one by one, the result
+// is not a consistent snapshot of a changing Allocator.
+func (a *Allocator) Stats() Stats {
+	return Stats{
+		Allocs:         int(a.allocs.Load()),
+		Bytes:          int(a.bytes.Load()),
+		Mmaps:          int(a.mmaps.Load()),
+		Mallocs:        a.mallocs.Load(),
+		Frees:          a.frees.Load(),
+		Reallocs:       a.reallocs.Load(),
+		BytesAllocated: a.allocated.Load(),
+		BytesFreed:     a.freed.Load(),
+		Reclaimed:      a.reclaimed.Load(),
+		MmapFailures:   a.mmapFailures.Load(),
+	}
+}
+
+// Add returns the field-wise sum of s and t.
+func (s Stats) Add(t Stats) Stats {
+	return Stats{
+		Allocs:         s.Allocs + t.Allocs,
+		Bytes:          s.Bytes + t.Bytes,
+		Mmaps:          s.Mmaps + t.Mmaps,
+		Mallocs:        s.Mallocs + t.Mallocs,
+		Frees:          s.Frees + t.Frees,
+		Reallocs:       s.Reallocs + t.Reallocs,
+		BytesAllocated: s.BytesAllocated + t.BytesAllocated,
+		BytesFreed:     s.BytesFreed + t.BytesFreed,
+		Reclaimed:      s.Reclaimed + t.Reclaimed,
+		MmapFailures:   s.MmapFailures + t.MmapFailures,
+	}
+}
+
+// Sub returns the field-wise difference of s and t. The balances of the
+// result, Allocs, Bytes and Mmaps, may be negative. The cumulative counters of
+// s must not be smaller than those of t, ie. t must be an earlier Stats of the
+// same Allocator.
+func (s Stats) Sub(t Stats) Stats {
+	return Stats{
+		Allocs:         s.Allocs - t.Allocs,
+		Bytes:          s.Bytes - t.Bytes,
+		Mmaps:          s.Mmaps - t.Mmaps,
+		Mallocs:        s.Mallocs - t.Mallocs,
+		Frees:          s.Frees - t.Frees,
+		Reallocs:       s.Reallocs - t.Reallocs,
+		BytesAllocated: s.BytesAllocated - t.BytesAllocated,
+		BytesFreed:     s.BytesFreed - t.BytesFreed,
+		Reclaimed:      s.Reclaimed - t.Reclaimed,
+		MmapFailures:   s.MmapFailures - t.MmapFailures,
+	}
+}
+
+// Snapshot is a Stats taken at a point in time.
+type Snapshot struct {
+	Stats
+	Time time.Time
+}
+
+// Snapshot returns the current statistics of a along with the current time.
+// Like Stats it may be called concurrently with other methods of a.
+func (a *Allocator) Snapshot() Snapshot { return Snapshot{a.Stats(), time.Now()} }
+
+// Sub returns the change of the statistics between prev and s.
+func (s Snapshot) Sub(prev Snapshot) Delta {
+	return Delta{s.Stats.Sub(prev.Stats), s.Time.Sub(prev.Time)}
+}
+
+// Delta is the change of the statistics of an Allocator over Elapsed.
+type Delta struct {
+	Stats
+	Elapsed time.Duration
+}
+
+// Rate returns n per second of d.Elapsed, eg. d.Rate(d.Mallocs) is the number
+// of allocations per second. It returns zero if d.Elapsed is not positive.
+func (d Delta) Rate(n uint64) float64 {
+	if d.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(n) / d.Elapsed.Seconds()
+}
+
+// StatsTree reports the statistics of an Allocator and its children, see
+// NewChild.
+type StatsTree struct {
+	Allocator *Allocator  // The Allocator described.
+	Own       Stats       // Statistics of Allocator alone.
+	Total     Stats       // Sum of Own and of the Total of all Children.
+	Children  []StatsTree // Children with memory mapped, largest Total.Bytes first.
+}
+
+// StatsTree returns the statistics of a and, recursively, of its children.
+// It may be called concurrently with the methods of the children, the
+// statistics of the children are then a best effort view like those reported
+// by Stats.
+func (a *Allocator) StatsTree() StatsTree {
+	r := StatsTree{Allocator: a, Own: a.Stats()}
+	r.Total = r.Own
+	a.childMu.Lock()
+	children := make([]*Allocator, 0, len(a.children))
+	for c := range a.children {
+		children = append(children, c)
+	}
+	a.childMu.Unlock()
+
+	for _, c := range children {
+		t := c.StatsTree()
+		r.Total = r.Total.Add(t.Total)
+		r.Children = append(r.Children, t)
+	}
+	sort.Slice(r.Children, func(i, j int) bool { return r.Children[i].Total.Bytes > r.Children[j].Total.Bytes })
+	return r
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unicode/utf8"
+	"unsafe"
+)
+
+// StringBuilder builds strings in memory of an Allocator, like
+// strings.Builder, avoiding garbage in the Go heap when constructing many
+// large strings. The result is obtained either as a Go string by String or as
+// a NUL-terminated C string in memory of the Allocator by CString.
+//
+// A StringBuilder must be released by Close.
+type StringBuilder struct {
+	b Buffer
+}
+
+// NewStringBuilder returns a StringBuilder allocating from a.
+func NewStringBuilder(a *Allocator) *StringBuilder { return &StringBuilder{Buffer{a: a}} }
+
+// Bytes returns the accumulated bytes. The slice is valid only until the next
+// modification of the builder.
+func (s *StringBuilder) Bytes() []byte { return s.b.Bytes() }
+
+// Cap returns the capacity of the builder.
+func (s *StringBuilder) Cap() int { return s.b.Cap() }
+
+// Close releases the memory of the builder and resets it to be empty.
+func (s *StringBuilder) Close() error { return s.b.Close() }
+
+// CString returns the accumulated bytes followed by a NUL byte as a C string
+// in memory of the Allocator of the builder, which must be freed by the
+// Allocator. The memory of the builder is handed over to the string, the
+// builder becomes empty.
+func (s *StringBuilder) CString() (uintptr, error) {
+	if err := s.b.WriteByte(0); err != nil {
+		return 0, err
+	}
+
+	p := uintptr(unsafe.Pointer(&s.b.buf[0]))
+	s.b.buf, s.b.off = nil, 0
+	return p, nil
+}
+
+// Grow grows the capacity of the builder, if necessary, to guarantee space
+// for another n bytes.
+func (s *StringBuilder) Grow(n int) error { return s.b.Grow(n) }
+
+// Len returns the number of accumulated bytes.
+func (s *StringBuilder) Len() int { return s.b.Len() }
+
+// Reset resets the builder to be empty but retains its memory.
+func (s *StringBuilder) Reset() { s.b.Reset() }
+
+// String returns the accumulated bytes as a string in the Go heap.
+func (s *StringBuilder) String() string { return s.b.String() }
+
+// Write appends p to the builder. It implements io.Writer.
+func (s *StringBuilder) Write(p []byte) (int, error) { return s.b.Write(p) }
+
+// WriteByte appends c to the builder. It implements io.ByteWriter.
+func (s *StringBuilder) WriteByte(c byte) error { return s.b.WriteByte(c) }
+
+// WriteRune appends the UTF-8 encoding of r to the builder.
+func (s *StringBuilder) WriteRune(r rune) (int, error) {
+	if err := s.b.Grow(utf8.UTFMax); err != nil {
+		return 0, err
+	}
+
+	n := len(s.b.buf)
+	s.b.buf = utf8.AppendRune(s.b.buf, r)
+	return len(s.b.buf) - n, nil
+}
+
+// WriteString appends str to the builder. It implements io.StringWriter.
+func (s *StringBuilder) WriteString(str string) (int, error) { return s.b.WriteString(str) }
+
+// GoString returns a copy of the NUL-terminated C string at p in the Go heap.
+func GoString(p uintptr) string {
+	if p == 0 {
+		return ""
+	}
+
+	var n uintptr
+	for *(*byte)(unsafe.Pointer(p + n)) != 0 {
+		n++
+	}
+	return string(unsafe.Slice((*byte)(unsafe.Pointer(p)), n))
+}
@@ -0,0 +1,539 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/cznic/mathutil"
+)
+
+const (
+	// Packing of a slot address and an ABA counter into an lfstack head.
+	// Slots are 16 byte aligned and user space addresses usually fit in
+	// 48 bits on 64 bit platforms. Slots at higher addresses, eg. with
+	// 5-level paging, are kept by the class lock instead, see
+	// SyncAllocator.push.
+	lfAddrBits  = 32 + 16*(^uintptr(0)>>63)
+	lfCountBits = lfAddrBits - 4
+)
+
+// lfstack is a lock-free stack of free slots. The head packs the address of
+// the top slot with a counter incremented by every push, which prevents the
+// ABA problem. The link to the next slot is stored in the first 8 bytes of
+// the slot.
+type lfstack uint64
+
+func lfPack(p uintptr, cnt uint64) uint64 { return uint64(p>>4) | cnt<<lfCountBits }
+
+func lfAddr(v uint64) uintptr { return uintptr(v&(1<<lfCountBits-1)) << 4 }
+
+// push pushes p onto s and reports whether it could. It fails if p cannot be
+// packed into the head.
+func (s *lfstack) push(p uintptr) bool {
+	if lfAddr(lfPack(p, 0)) != p {
+		return false
+	}
+
+	head := (*uint64)(s)
+	next := (*uint64)(unsafe.Pointer(p))
+	for {
+		old := atomic.LoadUint64(head)
+		v := lfPack(p, old>>lfCountBits+1)
+		atomic.StoreUint64(next, old)
+		if atomic.CompareAndSwapUint64(head, old, v) {
+			return true
+		}
+	}
+}
+
+func (s *lfstack) pop() uintptr {
+	head := (*uint64)(s)
+	for {
+		old := atomic.LoadUint64(head)
+		p := lfAddr(old)
+		if p == 0 {
+			return 0
+		}
+
+		// The slot may be popped and reused concurrently, the read
+		// value is then discarded by the failing CAS. A page is not
+		// unmapped while a pop which may have seen one of its slots is in
+		// progress, see SyncAllocator.release, so the read is safe.
+		next := atomic.LoadUint64((*uint64)(unsafe.Pointer(p)))
+		if atomic.CompareAndSwapUint64(head, old, next&(1<<lfCountBits-1)|old&^(1<<lfCountBits-1)) {
+			return p
+		}
+	}
+}
+
+// SyncAllocator is an allocator safe for concurrent use by multiple
+// goroutines. Free slots of shared pages are kept on lock-free stacks, one per
+// size class, so that allocating and freeing small blocks does not take a
+// lock. New slots are carved from the pages of a size class under a lock of
+// that class only, so that allocations of different sizes do not serialize. A
+// global mutex protects the mapping of pages and the allocations larger than
+// the largest size class, which occupy a page of their own.
+//
+// When the number of free slots of a size class grows large, the free slots
+// are collected under the lock of the class and the pages without any used
+// slot are returned to the OS.
+//
+// Its zero value is ready for use, NewSyncAllocator configures it. The checks
+// enabled by the MEMORY_DEBUG environment variable are not performed by a
+// SyncAllocator.
+type SyncAllocator struct {
+	free [64]lfstack // First for 64 bit alignment.
+
+	// Counters, accessed atomically, see Stats.
+	allocated uint64
+	freed     uint64
+	frees     uint64
+	mallocs   uint64
+	reallocs  uint64
+
+	classes [64]classLock // Protect alloc.cap[log] and alloc.pages[log].
+	mu      sync.Mutex
+	alloc   Allocator // Pages and large allocations, protected by mu.
+}
+
+// NewSyncAllocator returns a SyncAllocator using the Options o. Of the
+// Options, NoPanic, MaxAlloc, ZeroOnFree, ScrubOnClose, Backend, Limit,
+// SoftLimit, MmapFault, MmapRetry, OnOOM, LargeCache and LargeCacheAge are
+// supported, the others are ignored. OnOOM is called without any lock held.
+func NewSyncAllocator(o Options) *SyncAllocator {
+	s := &SyncAllocator{}
+	s.alloc.Options = Options{
+		NoPanic:       o.NoPanic,
+		MaxAlloc:      o.MaxAlloc,
+		ZeroOnFree:    o.ZeroOnFree,
+		ScrubOnClose:  o.ScrubOnClose,
+		Backend:       o.Backend,
+		Limit:         o.Limit,
+		SoftLimit:     o.SoftLimit,
+		MmapFault:     o.MmapFault,
+		MmapRetry:     o.MmapRetry,
+		OnOOM:         o.OnOOM,
+		LargeCache:    o.LargeCache,
+		LargeCacheAge: o.LargeCacheAge,
+	}
+	return s
+}
+
+type classLock struct {
+	sync.Mutex
+	spill  []uintptr       // Free slots not fitting the lfstack of the class.
+	nfree  atomic.Int64    // Free slots on the lfstack and the spill list.
+	trimAt atomic.Int64    // Value of nfree triggering release.
+	pops   [2]atomic.Int32 // Pops in progress by epoch, see release.
+	epoch  atomic.Uint32
+	_      [4]byte // Avoid false sharing.
+}
+
+// Calloc is like Allocator.Calloc.
+func (s *SyncAllocator) Calloc(size int) (r []byte, err error) {
+	p, err := s.UintptrCalloc(size)
+	if p == 0 || err != nil {
+		return nil, err
+	}
+
+	return slice(p, size), nil
+}
+
+// Close releases all OS resources used by s and sets it to its zero value,
+// except for the Options it was created with. It must not be called
+// concurrently with other methods of s.
+func (s *SyncAllocator) Close() (err error) {
+	s.mu.Lock()
+	err = s.alloc.Close()
+	s.mu.Unlock()
+	o := s.alloc.Options
+	*s = SyncAllocator{}
+	s.alloc.Options = o
+	return err
+}
+
+// Free is like Allocator.Free.
+func (s *SyncAllocator) Free(b []byte) (err error) {
+	if b = b[:cap(b)]; len(b) == 0 {
+		return nil
+	}
+
+	return s.UintptrFree(uintptr(unsafe.Pointer(&b[0])))
+}
+
+// Malloc is like Allocator.Malloc.
+func (s *SyncAllocator) Malloc(size int) (r []byte, err error) {
+	p, err := s.UintptrMalloc(size)
+	if p == 0 || err != nil {
+		return nil, err
+	}
+
+	return slice(p, size), nil
+}
+
+// Realloc is like Allocator.Realloc.
+func (s *SyncAllocator) Realloc(b []byte, size int) (r []byte, err error) {
+	var p uintptr
+	if b = b[:cap(b)]; len(b) != 0 {
+		p = uintptr(unsafe.Pointer(&b[0]))
+	}
+	if p, err = s.UintptrRealloc(p, size); p == 0 || err != nil {
+		return nil, err
+	}
+
+	return slice(p, size), nil
+}
+
+// Stats returns the current statistics of s. It does not take any lock.
+func (s *SyncAllocator) Stats() Stats {
+	frees := atomic.LoadUint64(&s.frees)
+	mallocs := atomic.LoadUint64(&s.mallocs)
+	return Stats{
+		Allocs:         int(mallocs - frees),
+		Bytes:          int(s.alloc.bytes.Load()),
+		Mmaps:          int(s.alloc.mmaps.Load()),
+		Mallocs:        mallocs,
+		Frees:          frees,
+		Reallocs:       atomic.LoadUint64(&s.reallocs),
+		BytesAllocated: atomic.LoadUint64(&s.allocated),
+		BytesFreed:     atomic.LoadUint64(&s.freed),
+		Reclaimed:      s.alloc.reclaimed.Load(),
+		MmapFailures:   s.alloc.mmapFailures.Load(),
+	}
+}
+
+// UintptrCalloc is like Calloc except it returns an uintptr.
+func (s *SyncAllocator) UintptrCalloc(size int) (r uintptr, err error) {
+	if trace {
+		defer func() {
+			fmt.Fprintf(os.Stderr, "SyncCalloc(%#x) %#x, %v\n", size, r, err)
+		}()
+	}
+	return s.uintptrMalloc(size, true)
+}
+
+// UintptrFree is like Free except its argument is an uintptr.
+func (s *SyncAllocator) UintptrFree(p uintptr) (err error) {
+	if trace {
+		defer func() {
+			fmt.Fprintf(os.Stderr, "SyncFree(%#x) %v\n", p, err)
+		}()
+	}
+	if p == 0 {
+		return nil
+	}
+
+	if p&(mallocAllign-1) != 0 {
+		return &Error{Op: "free", Addr: p, Kind: ErrInvalidPointer}
+	}
+
+	pg := (*page)(unsafe.Pointer(p &^ uintptr(pageMask)))
+	log := pg.log
+	if log == 0 {
+		s.mu.Lock()
+		us := usableSize(p)
+		err = s.alloc.UintptrFree(p)
+		s.mu.Unlock()
+		if err == nil {
+			atomic.AddUint64(&s.frees, 1)
+			atomic.AddUint64(&s.freed, uint64(us))
+		}
+		return err
+	}
+
+	if log >= 64 {
+		return &Error{Op: "free", Addr: p, Kind: ErrCorrupted}
+	}
+
+	if s.alloc.ZeroOnFree {
+		wipe(p, 1<<log)
+	}
+	if raceEnabled {
+		raceFree(p, 1<<log)
+	}
+	if sanEnabled {
+		sanFree(p, 1<<log)
+	}
+	s.push(log, p)
+	atomic.AddUint64(&s.frees, 1)
+	atomic.AddUint64(&s.freed, 1<<log)
+	if c := &s.classes[log]; c.nfree.Load() >= c.trimAt.Load() && c.TryLock() {
+		err = s.release(log)
+		c.Unlock()
+	}
+	return err
+}
+
+// UintptrMalloc is like Malloc except it returns an uintptr.
+func (s *SyncAllocator) UintptrMalloc(size int) (r uintptr, err error) {
+	if trace {
+		defer func() {
+			fmt.Fprintf(os.Stderr, "SyncMalloc(%#x) %#x, %v\n", size, r, err)
+		}()
+	}
+	return s.uintptrMalloc(size, false)
+}
+
+// uintptrMalloc implements UintptrMalloc and, if zero is set, UintptrCalloc.
+func (s *SyncAllocator) uintptrMalloc(size int, zero bool) (r uintptr, err error) {
+	if size < 0 {
+		return 0, s.alloc.invalidSize("malloc", size)
+	}
+
+	if size == 0 {
+		return 0, nil
+	}
+
+	if err := s.alloc.checkSize(size); err != nil {
+		return 0, err
+	}
+
+	if r, err = s.malloc(size, zero); err != nil && s.alloc.retryOOM(size, err) {
+		r, err = s.malloc(size, zero)
+	}
+	return r, err
+}
+
+func (s *SyncAllocator) malloc(size int, zero bool) (r uintptr, err error) {
+	log := uint(mathutil.BitLen(roundup(size, mallocAllign) - 1))
+	if uint64(1)<<log <= uint64(maxSlotSize) {
+		fresh := false
+		if r = s.pop(log); r == 0 {
+			if r, fresh, err = s.slot(log); err != nil {
+				return 0, err
+			}
+		}
+		if raceEnabled {
+			raceAlloc(r)
+		}
+		if sanEnabled {
+			sanUnpoison(r, 1<<log)
+		}
+		if zero && !fresh {
+			clear(unsafe.Slice((*byte)(unsafe.Pointer(r)), size))
+		}
+
+		atomic.AddUint64(&s.mallocs, 1)
+		atomic.AddUint64(&s.allocated, 1<<log)
+		return r, nil
+	}
+
+	var fresh bool
+	s.mu.Lock()
+	r, fresh, err = s.alloc.mallocFresh(size)
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if raceEnabled {
+		raceAlloc(r)
+	}
+	if sanEnabled {
+		sanUnpoison(r, usableSize(r))
+	}
+	if zero && !fresh {
+		clear(unsafe.Slice((*byte)(unsafe.Pointer(r)), size))
+	}
+
+	atomic.AddUint64(&s.mallocs, 1)
+	atomic.AddUint64(&s.allocated, uint64(usableSize(r)))
+	return r, nil
+}
+
+// push puts the free slot p of size class log on the lfstack of the class or,
+// if its address does not fit, on the spill list of the class.
+func (s *SyncAllocator) push(log uint, p uintptr) {
+	s.classes[log].nfree.Add(1)
+	if !s.free[log].push(p) {
+		c := &s.classes[log]
+		c.Lock()
+		c.spill = append(c.spill, p)
+		c.Unlock()
+	}
+}
+
+// pop returns a free slot of size class log from its lfstack or zero if
+// there's none.
+func (s *SyncAllocator) pop(log uint) uintptr {
+	c := &s.classes[log]
+	e := c.epoch.Load() & 1
+	c.pops[e].Add(1)
+	r := s.free[log].pop()
+	c.pops[e].Add(-1)
+	if r != 0 {
+		c.nfree.Add(-1)
+	}
+	return r
+}
+
+// release returns the pages of size class log without used slots to the OS.
+// It must be called with the lock of the class held.
+//
+// All free slots of the class are popped first. A page whose free slots
+// include all slots handed out from it has no used slots, none of its slots
+// can be pushed again and it can be unmapped once the pops in progress, which
+// may still read one of its slots, complete. Pops starting later see only
+// slots of the pages kept.
+func (s *SyncAllocator) release(log uint) (err error) {
+	c := &s.classes[log]
+	free := c.spill
+	c.spill = nil
+	for p := s.free[log].pop(); p != 0; p = s.free[log].pop() {
+		free = append(free, p)
+	}
+	c.nfree.Add(-int64(len(free)))
+	pages := map[*page]int{}
+	for _, p := range free {
+		pages[(*page)(unsafe.Pointer(p&^uintptr(pageMask)))]++
+	}
+	for pg, n := range pages {
+		if n < pg.brk || pg == s.alloc.pages[log] {
+			delete(pages, pg)
+		}
+	}
+	kept := 0
+	for _, p := range free {
+		if _, ok := pages[(*page)(unsafe.Pointer(p&^uintptr(pageMask)))]; ok {
+			continue
+		}
+
+		if !s.free[log].push(p) {
+			c.spill = append(c.spill, p)
+		}
+		kept++
+	}
+	c.nfree.Add(int64(kept))
+	c.trimAt.Store(int64(mathutil.Max(2*s.alloc.cap[log], 2*kept)))
+	if len(pages) == 0 {
+		return nil
+	}
+
+	epoch := c.epoch.Add(1) - 1
+	for c.pops[epoch&1].Load() != 0 {
+		runtime.Gosched()
+	}
+	s.mu.Lock()
+	for pg := range pages {
+		s.alloc.bytes.Add(-int64(pg.size))
+		if e := s.alloc.unmap(pg); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// slot returns a spilled or a new slot of size class log and reports whether
+// it is known to be zeroed.
+func (s *SyncAllocator) slot(log uint) (uintptr, bool, error) {
+	c := &s.classes[log]
+	c.Lock()
+	defer c.Unlock()
+
+	if n := len(c.spill); n != 0 {
+		r := c.spill[n-1]
+		c.spill = c.spill[:n-1]
+		c.nfree.Add(-1)
+		return r, false, nil
+	}
+
+	p := s.alloc.pages[log]
+	if p == nil {
+		var err error
+		s.mu.Lock()
+		p, err = s.alloc.newSharedPage(log)
+		s.mu.Unlock()
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	if c.trimAt.Load() == 0 {
+		c.trimAt.Store(int64(2 * s.alloc.cap[log]))
+	}
+	fresh := !s.alloc.dirty[log]
+	p.used++
+	p.brk++
+	if p.brk == s.alloc.cap[log] {
+		s.alloc.pages[log] = nil
+	}
+	return uintptr(unsafe.Pointer(p)) + uintptr(slotBase(log)+(p.brk-1)<<log), fresh, nil
+}
+
+// UintptrRealloc is like Realloc except its first argument is an uintptr.
+func (s *SyncAllocator) UintptrRealloc(p uintptr, size int) (r uintptr, err error) {
+	if trace {
+		defer func() {
+			fmt.Fprintf(os.Stderr, "SyncRealloc(%#x, %#x) %#x, %v\n", p, size, r, err)
+		}()
+	}
+	if size < 0 {
+		return 0, s.alloc.invalidSize("realloc", size)
+	}
+
+	atomic.AddUint64(&s.reallocs, 1)
+	switch {
+	case p == 0:
+		return s.UintptrMalloc(size)
+	case size == 0 && p != 0:
+		return 0, s.UintptrFree(p)
+	}
+
+	us := UintptrUsableSize(p)
+	if us > size {
+		return p, nil
+	}
+
+	if r, err = s.UintptrMalloc(size); err != nil {
+		return 0, err
+	}
+
+	if us < size {
+		size = us
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(r)), size), unsafe.Slice((*byte)(unsafe.Pointer(p)), size))
+	return r, s.UintptrFree(p)
+}
+
+// UnsafeCalloc is like Calloc except it returns an unsafe.Pointer.
+func (s *SyncAllocator) UnsafeCalloc(size int) (r unsafe.Pointer, err error) {
+	p, err := s.UintptrCalloc(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Pointer(p), nil
+}
+
+// UnsafeFree is like Free except its argument is an unsafe.Pointer.
+func (s *SyncAllocator) UnsafeFree(p unsafe.Pointer) (err error) { return s.UintptrFree(uintptr(p)) }
+
+// UnsafeMalloc is like Malloc except it returns an unsafe.Pointer.
+func (s *SyncAllocator) UnsafeMalloc(size int) (r unsafe.Pointer, err error) {
+	p, err := s.UintptrMalloc(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Pointer(p), nil
+}
+
+// UnsafeRealloc is like Realloc except its first argument is an
+// unsafe.Pointer.
+func (s *SyncAllocator) UnsafeRealloc(p unsafe.Pointer, size int) (r unsafe.Pointer, err error) {
+	q, err := s.UintptrRealloc(uintptr(p), size)
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Pointer(q), nil
+}
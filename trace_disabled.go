@@ -6,4 +6,4 @@
 
 package memory
 
-const trace = false
+var trace = debugFlags&debugTrace != 0
@@ -0,0 +1,114 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Transfer moves the ownership of b from a to dst without copying. The
+// memory of b stays valid and must be freed by dst afterwards. Only
+// allocations larger than the largest size class, which occupy a page of
+// their own, can be transferred. Both allocators must use the same Backend
+// and page size.
+func (a *Allocator) Transfer(dst *Allocator, b []byte) error {
+	if cap(b) == 0 {
+		return nil
+	}
+
+	return a.UintptrTransfer(dst, uintptr(unsafe.Pointer(&b[:1][0])))
+}
+
+// UintptrTransfer is like Transfer except its argument is an uintptr.
+func (a *Allocator) UintptrTransfer(dst *Allocator, p uintptr) error {
+	if p == 0 || dst == a {
+		return nil
+	}
+
+	p = untag(p)
+	var pg *page
+	size, bare := a.bare[p]
+	if !bare {
+		if pg = a.owner(p); pg == nil {
+			return &Error{Op: "transfer", Addr: p, Kind: ErrInvalidPointer}
+		}
+
+		if pg.log != 0 {
+			return &Error{Op: "transfer", Addr: p, Size: 1 << pg.log, Kind: ErrInvalidSize}
+		}
+
+		if p != uintptr(unsafe.Pointer(pg))+uintptr(headerSize) {
+			return &Error{Op: "transfer", Addr: p, Kind: ErrInvalidPointer}
+		}
+
+		size = pg.size
+	}
+
+	if !sameBackend(a.backend(), dst.backend()) || a.pageSize() != dst.pageSize() {
+		return &Error{Op: "transfer", Addr: p, Kind: ErrUnsupported}
+	}
+
+	us := uint64(size)
+	switch {
+	case bare:
+		delete(a.bare, p)
+		if dst.bare == nil {
+			dst.bare = map[uintptr]int{}
+		}
+		dst.bare[p] = size
+	default:
+		us -= uint64(headerSize)
+		a.unregister(pg)
+		dst.register(pg)
+	}
+	a.mmaps.Add(-1)
+	a.bytes.Add(-int64(size))
+	a.allocs.Add(-1)
+	a.frees.Add(1)
+	a.freed.Add(us)
+
+	dst.mmaps.Add(1)
+	dst.bytes.Add(int64(size))
+	dst.allocs.Add(1)
+	dst.mallocs.Add(1)
+	dst.allocated.Add(us)
+	dst.noteHighwater()
+
+	if n, ok := a.sizes[p]; ok {
+		a.untrackSize(p)
+		dst.trackSize(p, n)
+	}
+	if a.marked != nil {
+		delete(a.marked, p)
+	}
+	if a.born != nil {
+		delete(a.born, p)
+	}
+	if a.samples != nil {
+		delete(a.samples, p)
+	}
+	if a.tagged != nil {
+		a.untagAlloc(p)
+	}
+	if dst.marks != nil {
+		dst.markAlloc(p)
+	}
+	return nil
+}
+
+// sameBackend reports whether memory mapped by x can be unmapped by y.
+func sameBackend(x, y Backend) bool {
+	if _, ok := x.(*OSBackend); ok {
+		_, ok = y.(*OSBackend)
+		return ok
+	}
+
+	if t := reflect.TypeOf(x); t != reflect.TypeOf(y) || !t.Comparable() {
+		return false
+	}
+
+	return x == y
+}
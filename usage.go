@@ -0,0 +1,43 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+// The methods in this file mirror sqlite3_memory_used,
+// sqlite3_memory_highwater and sqlite3_soft_heap_limit64.
+
+// MemoryUsed returns the number of bytes of the live allocations of a, ie.
+// Stats.BytesAllocated - Stats.BytesFreed. Like Stats it may be called
+// concurrently with other methods of a.
+func (a *Allocator) MemoryUsed() int { return int(a.allocated.Load() - a.freed.Load()) }
+
+// MemoryHighwater returns the maximum value of MemoryUsed since a was created
+// or closed, or since the last call of MemoryHighwater with reset set. If
+// reset is true, the high-water mark is set to the current value of
+// MemoryUsed.
+func (a *Allocator) MemoryHighwater(reset bool) int {
+	if reset {
+		return int(a.highwater.Swap(a.allocated.Load() - a.freed.Load()))
+	}
+
+	return int(a.highwater.Load())
+}
+
+// noteHighwater updates the high-water mark of a after an allocation.
+func (a *Allocator) noteHighwater() {
+	if n := a.allocated.Load() - a.freed.Load(); n > a.highwater.Load() {
+		a.highwater.Store(n)
+	}
+}
+
+// SoftHeapLimit sets Options.SoftLimit to n, if n is not negative, and
+// returns its previous value. SoftHeapLimit(-1) only queries the limit. Zero
+// disables it.
+func (a *Allocator) SoftHeapLimit(n int) int {
+	r := a.SoftLimit
+	if n >= 0 {
+		a.SoftLimit = n
+	}
+	return r
+}
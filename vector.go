@@ -0,0 +1,145 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Vector is a growable array of T, like a slice, in memory of an Allocator.
+// The Go garbage collector does not see the memory of a Vector, so T must not
+// contain Go pointers, including strings, slices, maps, channels, functions
+// and interfaces. NewVector rejects such types.
+//
+// A Vector must be released by Close.
+type Vector[T any] struct {
+	a *Allocator
+	s []T
+}
+
+// NewVector returns a Vector allocating from a. It returns an error if T
+// contains Go pointers.
+func NewVector[T any](a *Allocator) (*Vector[T], error) {
+	if err := checkPointerFree(reflect.TypeOf((*T)(nil)).Elem()); err != nil {
+		return nil, err
+	}
+
+	return &Vector[T]{a: a}, nil
+}
+
+// Append appends v to the vector, growing it if necessary.
+func (v *Vector[T]) Append(e ...T) error {
+	if err := v.Reserve(len(e)); err != nil {
+		return err
+	}
+
+	v.s = append(v.s, e...)
+	return nil
+}
+
+// At returns the element at index i.
+func (v *Vector[T]) At(i int) T { return v.s[i] }
+
+// Cap returns the number of elements the vector can hold without growing.
+func (v *Vector[T]) Cap() int { return cap(v.s) }
+
+// Close releases the memory of the vector and resets it to be empty.
+func (v *Vector[T]) Close() (err error) {
+	var zero T
+	if cap(v.s) != 0 && unsafe.Sizeof(zero) != 0 {
+		err = v.a.UnsafeFree(unsafe.Pointer(&v.s[:1][0]))
+	}
+	v.s = nil
+	return err
+}
+
+// Len returns the number of elements of the vector.
+func (v *Vector[T]) Len() int { return len(v.s) }
+
+// Ptr returns a pointer to the element at index i. The pointer is valid only
+// until the vector grows.
+func (v *Vector[T]) Ptr(i int) *T { return &v.s[i] }
+
+// Reserve grows the capacity of the vector, if necessary, to guarantee space
+// for another n elements. Growth is amortized, the capacity at least doubles.
+func (v *Vector[T]) Reserve(n int) error {
+	if n < 0 {
+		return v.a.invalidSize("reserve", n)
+	}
+
+	if cap(v.s)-len(v.s) >= n {
+		return nil
+	}
+
+	var zero T
+	sz := int(unsafe.Sizeof(zero))
+	if sz == 0 {
+		v.s = append(v.s, make([]T, n)...)[:len(v.s)]
+		return nil
+	}
+
+	c := 2*cap(v.s) + n
+	if c < 4 {
+		c = 4
+	}
+	if n > (maxMalloc/sz-len(v.s))/2 || c > maxMalloc/sz {
+		return &Error{Op: "reserve", Size: n, Kind: ErrOOM}
+	}
+
+	var p unsafe.Pointer
+	if cap(v.s) != 0 {
+		p = unsafe.Pointer(&v.s[:1][0])
+	}
+	p, err := v.a.UnsafeRealloc(p, c*sz)
+	if err != nil {
+		return err
+	}
+
+	v.s = unsafe.Slice((*T)(p), c)[:len(v.s)]
+	return nil
+}
+
+// Set sets the element at index i to e.
+func (v *Vector[T]) Set(i int, e T) { v.s[i] = e }
+
+// Slice returns the elements of the vector. The slice is valid only until the
+// vector grows or is closed.
+func (v *Vector[T]) Slice() []T { return v.s }
+
+// Truncate discards all but the first n elements of the vector. The capacity
+// is retained.
+func (v *Vector[T]) Truncate(n int) { v.s = v.s[:n] }
+
+// checkPointerFree returns an error if values of t contain Go pointers.
+func checkPointerFree(t reflect.Type) error {
+	if hasPointers(t) {
+		return fmt.Errorf("memory: type %v contains Go pointers", t)
+	}
+
+	return nil
+}
+
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return t.Len() != 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2026 The Memory Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"unsafe"
+)
+
+// wipe zeroes the size bytes at p. It's never inlined, so that the compiler
+// cannot drop the stores to memory which is not read afterwards.
+//
+//go:noinline
+func wipe(p uintptr, size int) { clear(unsafe.Slice((*byte)(unsafe.Pointer(p)), size)) }
+
+// wipeRange zeroes the size bytes at p for Options.ZeroOnFree, making them
+// accessible first if needed.
+func (a *Allocator) wipeRange(p uintptr, size int) {
+	if sanEnabled {
+		sanUnpoison(p, size)
+	}
+	if a.tagging() {
+		mteClear(p, size)
+	}
+	wipe(p, size)
+}
+
+// wipePage zeroes the contents of the page pg, except for its header.
+func (a *Allocator) wipePage(pg *page) {
+	a.wipeRange(uintptr(unsafe.Pointer(pg))+uintptr(headerSize), pg.size-headerSize)
+}